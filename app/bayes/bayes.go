@@ -0,0 +1,115 @@
+// Package bayes implements multinomial naive Bayes classifier for two classes, spam and ham.
+// Documents are given as token frequencies, tokenization is up to the caller.
+package bayes
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// Class of a document
+type Class string
+
+// enum of all classes
+const (
+	Spam Class = "spam"
+	Ham  Class = "ham"
+)
+
+// Classifier keeps token counts per class. Zero value is not usable, use New or Load.
+type Classifier struct {
+	Docs   map[Class]int            `json:"docs"`   // number of learned documents
+	Tokens map[Class]map[string]int `json:"tokens"` // token frequencies
+	Totals map[Class]int            `json:"totals"` // sum of token frequencies
+	vocab  map[string]bool
+}
+
+// New makes an empty classifier
+func New() *Classifier {
+	return &Classifier{
+		Docs:   map[Class]int{},
+		Tokens: map[Class]map[string]int{Spam: {}, Ham: {}},
+		Totals: map[Class]int{},
+		vocab:  map[string]bool{},
+	}
+}
+
+// Learn adds document with token frequencies to the class
+func (c *Classifier) Learn(class Class, tokens map[string]int) {
+	if len(tokens) == 0 {
+		return
+	}
+	c.Docs[class]++
+	for t, n := range tokens {
+		c.Tokens[class][t] += n
+		c.Totals[class] += n
+		c.vocab[t] = true
+	}
+}
+
+// Ready returns true if both classes learned
+func (c *Classifier) Ready() bool {
+	return c.Docs[Spam] > 0 && c.Docs[Ham] > 0
+}
+
+// SpamProbability returns probability of the document to be spam, with Laplace smoothing.
+// Class priors are ignored, as ham corpus usually is much bigger than spam one and doesn't reflect the real ratio.
+// Tokens never seen in training don't affect the result. Returns 0 if classifier is not ready.
+func (c *Classifier) SpamProbability(tokens map[string]int) float64 {
+	if !c.Ready() {
+		return 0
+	}
+	vocabSize := float64(len(c.vocab))
+	logSpam, logHam := 0.0, 0.0
+	for t, n := range tokens {
+		if !c.vocab[t] {
+			continue
+		}
+		logSpam += float64(n) * math.Log((float64(c.Tokens[Spam][t])+1)/(float64(c.Totals[Spam])+vocabSize))
+		logHam += float64(n) * math.Log((float64(c.Tokens[Ham][t])+1)/(float64(c.Totals[Ham])+vocabSize))
+	}
+	return 1 / (1 + math.Exp(logHam-logSpam))
+}
+
+// Save writes the model to json file
+func (c *Classifier) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("can't make directory for %s: %w", path, err)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("can't marshal model: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("can't write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("can't rename %s to %s: %w", tmp, path, err)
+	}
+	return nil
+}
+
+// Load reads the model saved by Save
+func Load(path string) (*Classifier, error) {
+	data, err := os.ReadFile(path) // nolint
+	if err != nil {
+		return nil, fmt.Errorf("can't read %s: %w", path, err)
+	}
+	res := New()
+	if err := json.Unmarshal(data, res); err != nil {
+		return nil, fmt.Errorf("can't unmarshal model from %s: %w", path, err)
+	}
+	for _, class := range []Class{Spam, Ham} {
+		if res.Tokens[class] == nil {
+			res.Tokens[class] = map[string]int{}
+		}
+		for t := range res.Tokens[class] {
+			res.vocab[t] = true
+		}
+	}
+	return res, nil
+}
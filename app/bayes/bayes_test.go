@@ -0,0 +1,49 @@
+package bayes
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tokens(s string) map[string]int {
+	res := map[string]int{}
+	for _, t := range strings.Fields(s) {
+		res[t]++
+	}
+	return res
+}
+
+func TestClassifier(t *testing.T) {
+	c := New()
+	assert.False(t, c.Ready())
+	assert.Equal(t, 0.0, c.SpamProbability(tokens("win free iphone")), "not ready")
+
+	for _, s := range []string{"win free iphone now", "free crypto signals join channel", "earn money remote work write me"} {
+		c.Learn(Spam, tokens(s))
+	}
+	for _, s := range []string{"new episode is out", "free software is great", "who is going to the meetup",
+		"podcast about go and rust", "i work remote too"} {
+		c.Learn(Ham, tokens(s))
+	}
+	c.Learn(Ham, tokens(""))
+	assert.True(t, c.Ready())
+	assert.Equal(t, 5, c.Docs[Ham], "empty document ignored")
+
+	assert.Greater(t, c.SpamProbability(tokens("join crypto channel and earn money")), 0.9)
+	assert.Less(t, c.SpamProbability(tokens("new podcast episode about rust")), 0.1)
+	assert.InDelta(t, 0.5, c.SpamProbability(tokens("completely unknown words")), 0.001, "unknown tokens ignored")
+
+	fname := filepath.Join(t.TempDir(), "model", "spam.json")
+	require.NoError(t, c.Save(fname))
+	loaded, err := Load(fname)
+	require.NoError(t, err)
+	assert.Equal(t, c.Docs, loaded.Docs)
+	assert.InDelta(t, c.SpamProbability(tokens("join crypto channel")), loaded.SpamProbability(tokens("join crypto channel")), 1e-9)
+
+	_, err = Load(filepath.Join(t.TempDir(), "nothing.json"))
+	assert.Error(t, err)
+}
@@ -1,10 +1,13 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
 	"log"
-	"sort"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -12,18 +15,22 @@ import (
 
 //go:generate moq --out mocks/tg_ban_client.go --pkg mocks --skip-ensure . TgBanClient:TgBanClient
 
-// Banhammer bot, allows (superusers only) to ban or unban anyone
+// Banhammer bot, allows (superusers only) to ban, mute or unban anyone
 type Banhammer struct {
 	tgClient  TgBanClient
 	superUser SuperUser
+	users     *UserDirectory
+	modLog    *ModLog    // optional, journal of all bans
+	blocklist *Blocklist // optional, known spammers, fed by permanent bans of users
 
-	maxRecentUsers int
-	recentUsers    map[string]userInfo
+	lock    sync.Mutex
+	pending *pendingBan // successful ban or mute waiting for id of the notice to be journaled
 }
 
-type userInfo struct {
-	User
-	ts time.Time
+// pendingBan is a journal entry of the ban made on the message, journaled by OnSent with id of the bot's notice
+type pendingBan struct {
+	msgID int
+	entry ModEntry
 }
 
 // TgBanClient is a subset of tg api limited to ban-related operations only
@@ -31,90 +38,372 @@ type TgBanClient interface {
 	Request(c tbapi.Chattable) (*tbapi.APIResponse, error)
 }
 
-// NewBanhammer makes a bot for admins reacting on ban!user unban!user
-func NewBanhammer(tgClient TgBanClient, superUser SuperUser, maxRecentUsers int) *Banhammer {
-	log.Printf("[INFO] Banhammer bot, max users to keep: %d, supers: %v", maxRecentUsers, superUser)
-	return &Banhammer{tgClient: tgClient, superUser: superUser, recentUsers: map[string]userInfo{}, maxRecentUsers: maxRecentUsers}
+// banTarget is a user or a channel to ban
+type banTarget struct {
+	User
+	ChannelID int64
+	Name      string // as it should be shown in the reply
+}
+
+// banRequest is a parsed ban!, mute! or unban! command
+type banRequest struct {
+	cmd      string
+	target   banTarget
+	duration time.Duration // 0 for permanent
+	reason   string
+}
+
+// NewBanhammer makes a bot for admins reacting on ban!user unban!user.
+// Users directory translates username to ID, mandatory for tg kick/unban. ModLog and Blocklist are optional
+func NewBanhammer(tgClient TgBanClient, superUser SuperUser, users *UserDirectory, modLog *ModLog,
+	blocklist *Blocklist) *Banhammer {
+	log.Printf("[INFO] Banhammer bot, supers: %v, journal: %v, blocklist: %v", superUser, modLog != nil, blocklist != nil)
+	return &Banhammer{tgClient: tgClient, superUser: superUser, users: users, modLog: modLog, blocklist: blocklist}
 }
 
 // Help returns help message
 func (b *Banhammer) Help() string {
-	return GenHelpMsg(b.ReactOn(), "забанить/разбанить (только для админов)")
+	return GenHelpMsg(b.ReactOn(), "забанить/заглушить/разбанить (только для админов): "+
+		"ban! @user 2h причина, или ответом на сообщение")
 }
 
 // ReactOn keys
 func (b *Banhammer) ReactOn() []string {
-	return []string{"ban!", "unban!"}
+	return []string{"ban!", "unban!", "mute!"}
 }
 
-// OnMessage pass msg to all bots and collects responses
-// In order to translate username to ID (mandatory for tg kick/unban) collect up to maxRecentUsers recently seen users
+// OnMessage bans, mutes or unbans user or channel. Target is set by username or id, or by reply to the message.
+// Optional duration (30m, 2h, 1d, 1w) and reason follow the target, no duration means forever.
+// Unban also works as a reply to the bot's ban notice, if the ban is in the journal.
 func (b *Banhammer) OnMessage(msg Message) (response Response) {
+	ok, cmd, args := b.parse(msg.Text)
+	if !ok || !b.superUser.IsSuper(msg.From.Username) { // only super may ban/unban
+		return Response{}
+	}
+	b.flush() // notice of the previous ban wasn't sent, journal it without notice id
 
-	// update list of recent users
-	b.recentUsers[msg.From.Username] = userInfo{User: msg.From, ts: time.Now()}
-	if len(b.recentUsers) > b.maxRecentUsers {
-		b.cleanup()
+	req, err := b.request(cmd, args, msg)
+	if err != nil {
+		log.Printf("[WARN] can't make %s request from %q, %v", cmd, msg.Text, err)
+		return Response{Text: err.Error(), Send: true, ReplyTo: msg.ID}
 	}
 
-	ok, cmd, name := b.parse(msg.Text)
-	if !ok || !b.superUser.IsSuper(msg.From.Username) { // only super may ban/unban
+	if req.target.ChannelID == 0 && b.superUser.IsSuper(req.target.Username) { // super can't be banned by another super
 		return Response{}
 	}
 
-	if b.superUser.IsSuper(strings.TrimPrefix(name, "@")) { // super can't be banned by another super
-		return Response{}
+	err = b.apply(req, msg.ChatID)
+	b.journal(req, msg, err)
+	b.block(req, err)
+	if err != nil {
+		log.Printf("[WARN] failed to %s %s, %v", req.cmd, req.target.Name, err)
+		return Response{Text: fmt.Sprintf("не удалось выполнить %s для %s: %s", req.cmd,
+			EscapeMarkDownV1Text(req.target.Name), EscapeMarkDownV1Text(err.Error())), Send: true, ReplyTo: msg.ID}
 	}
+	log.Printf("[INFO] %s %+v for %v by %+v, reason: %q", req.cmd, req.target, req.duration, msg.From, req.reason)
+	return Response{Text: req.text(), Send: true}
+}
 
-	user, found := b.recentUsers[strings.TrimPrefix(name, "@")]
-	if !found {
-		log.Printf("[WARN] can't get ID for user %s", name)
-		return Response{}
+// request makes banRequest from command arguments and replied message
+func (b *Banhammer) request(cmd string, args []string, msg Message) (banRequest, error) {
+	res := banRequest{cmd: cmd}
+
+	isName := len(args) > 0 && (strings.HasPrefix(args[0], "@") || isNumeric(args[0]))
+	isReply := msg.ReplyTo.From.ID != 0 || msg.ReplyTo.SenderChat.ID != 0
+	notice, isNotice := b.findNotice(cmd, msg)
+	switch {
+	case isNotice && !isName:
+		res.target = banTarget{User: notice.Target, ChannelID: notice.ChannelID, Name: notice.TargetName()}
+	case isName || (!isReply && len(args) > 0):
+		name := args[0]
+		args = args[1:]
+		user, found := b.users.Lookup(name)
+		id, _ := strconv.ParseInt(name, 10, 64)
+		switch {
+		case found:
+			res.target = banTarget{User: user.User, Name: name}
+			if id != 0 && user.Username != "" {
+				res.target.Name = "@" + user.Username
+			}
+		case id < 0: // unknown numeric id, negative ones are channels
+			res.target = banTarget{ChannelID: id, Name: name}
+		case id > 0:
+			res.target = banTarget{User: User{ID: id}, Name: name}
+		default:
+			return res, fmt.Errorf("не знаю пользователя %s", EscapeMarkDownV1Text(name))
+		}
+	case isReply && msg.ReplyTo.SenderChat.ID != 0:
+		res.target = banTarget{ChannelID: msg.ReplyTo.SenderChat.ID, Name: "@" + msg.ReplyTo.SenderChat.UserName}
+		if msg.ReplyTo.SenderChat.UserName == "" {
+			res.target.Name = strconv.FormatInt(msg.ReplyTo.SenderChat.ID, 10)
+		}
+	case isReply:
+		u := msg.ReplyTo.From
+		res.target = banTarget{User: u, Name: "@" + u.Username}
+		if u.Username == "" {
+			res.target.Name = DisplayName(Message{From: u})
+		}
+	default:
+		return res, errors.New("кого? укажите @user или ответьте на сообщение")
 	}
 
-	switch cmd {
-	case "ban":
-		_, err := b.tgClient.Request(tbapi.KickChatMemberConfig{
-			ChatMemberConfig: tbapi.ChatMemberConfig{UserID: user.ID, ChatID: msg.ChatID},
-		})
+	if cmd == "mute" && res.target.ChannelID != 0 {
+		return res, errors.New("канал можно только забанить")
+	}
+
+	if cmd != "unban" && len(args) > 0 && isBanDuration(args[0]) {
+		d, err := parseBanDuration(args[0])
 		if err != nil {
-			log.Printf("[WARN] failed to ban %s, %v", name, err)
-			return Response{}
+			return res, fmt.Errorf("срок %s вне допустимого диапазона, от 30s до 366d", args[0])
 		}
-		log.Printf("[INFO] banned %+v by %+v", user.User, msg.From)
-		return Response{Text: fmt.Sprintf("прощай %s", name), Send: true}
-	case "unban":
-		_, err := b.tgClient.Request(tbapi.UnbanChatMemberConfig{ChatMemberConfig: tbapi.ChatMemberConfig{UserID: user.ID, ChatID: msg.ChatID}})
-		if err != nil {
-			log.Printf("[WARN] failed to unban %s, %v", name, err)
-			return Response{}
+		res.duration = d
+		args = args[1:]
+	}
+	res.reason = strings.Join(args, " ")
+	return res, nil
+}
+
+// findNotice returns journal entry for unban! sent as a reply to the bot's ban notice
+func (b *Banhammer) findNotice(cmd string, msg Message) (ModEntry, bool) {
+	if cmd != "unban" || b.modLog == nil || msg.ReplyTo.ID == 0 {
+		return ModEntry{}, false
+	}
+	return b.modLog.FindNotice(msg.ReplyTo.ID)
+}
+
+// apply makes telegram request for ban, mute or unban
+func (b *Banhammer) apply(req banRequest, chatID int64) error {
+	var untilDate int64
+	if req.duration > 0 {
+		untilDate = time.Now().Add(req.duration).Unix()
+	}
+
+	var c tbapi.Chattable
+	active := b.activeRestriction(req.target)
+	switch {
+	case req.cmd == "ban" && req.target.ChannelID != 0:
+		c = tbapi.BanChatSenderChatConfig{ChatID: chatID, SenderChatID: req.target.ChannelID, UntilDate: int(untilDate)}
+	case req.cmd == "ban":
+		c = tbapi.BanChatMemberConfig{ChatMemberConfig: tbapi.ChatMemberConfig{UserID: req.target.ID, ChatID: chatID},
+			UntilDate: untilDate}
+	case req.cmd == "mute":
+		c = tbapi.RestrictChatMemberConfig{
+			ChatMemberConfig: tbapi.ChatMemberConfig{UserID: req.target.ID, ChatID: chatID},
+			UntilDate:        untilDate,
+			Permissions: &tbapi.ChatPermissions{
+				CanSendMessages:       false,
+				CanSendMediaMessages:  false,
+				CanSendOtherMessages:  false,
+				CanAddWebPagePreviews: false,
+			},
 		}
-		log.Printf("[INFO] unbanned %+v by %+v", user.User, msg.From)
-		return Response{Text: fmt.Sprintf("амнистия для %s", name), Send: true}
+	case req.cmd == "unban" && active != nil:
+		c = LiftRequest(*active, chatID)
+	case req.cmd == "unban" && req.target.ChannelID != 0:
+		c = tbapi.UnbanChatSenderChatConfig{ChatID: chatID, SenderChatID: req.target.ChannelID}
+	case req.cmd == "unban":
+		c = tbapi.UnbanChatMemberConfig{ChatMemberConfig: tbapi.ChatMemberConfig{UserID: req.target.ID, ChatID: chatID}}
+	default:
+		return fmt.Errorf("unknown command %s", req.cmd)
 	}
 
-	return Response{}
+	resp, err := b.tgClient.Request(c)
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return fmt.Errorf("response is not Ok: %s", resp.Description)
+	}
+	return nil
 }
 
-func (b *Banhammer) cleanup() {
-	users := make([]userInfo, len(b.recentUsers))
-	for _, u := range b.recentUsers {
-		users = append(users, u)
+// activeRestriction returns restriction of the target in effect, if journal knows it
+func (b *Banhammer) activeRestriction(target banTarget) *ModEntry {
+	if b.modLog == nil {
+		return nil
 	}
-	sort.Slice(users, func(i, j int) bool { return users[i].ts.Before(users[j].ts) })
-	// remove 10% of the oldest records
-	for i := 0; i < b.maxRecentUsers/10; i++ {
-		delete(b.recentUsers, users[i].Username)
+	id := target.ChannelID
+	if id == 0 {
+		id = target.ID
+	}
+	for _, e := range b.modLog.Active(time.Now()) {
+		if e.TargetID() == id && e.Action == ModRestrict {
+			return &e
+		}
+	}
+	return nil
+}
+
+// LiftRequest makes telegram request lifting the ban or restriction from journal entry.
+// Restriction lifted by restoring permissions, as unban would remove the user from the chat.
+func LiftRequest(e ModEntry, chatID int64) tbapi.Chattable {
+	switch {
+	case e.ChannelID != 0:
+		return tbapi.UnbanChatSenderChatConfig{ChatID: chatID, SenderChatID: e.ChannelID}
+	case e.Action == ModRestrict:
+		return tbapi.RestrictChatMemberConfig{
+			ChatMemberConfig: tbapi.ChatMemberConfig{UserID: e.Target.ID, ChatID: chatID},
+			Permissions: &tbapi.ChatPermissions{
+				CanSendMessages:       true,
+				CanSendMediaMessages:  true,
+				CanSendOtherMessages:  true,
+				CanAddWebPagePreviews: true,
+			},
+		}
+	default:
+		return tbapi.UnbanChatMemberConfig{ChatMemberConfig: tbapi.ChatMemberConfig{UserID: e.Target.ID, ChatID: chatID},
+			OnlyIfBanned: true}
 	}
 }
 
-func (b *Banhammer) parse(text string) (react bool, cmd, name string) {
+// OnSent journals the ban or mute made on the message with id of the bot's notice,
+// so unban! can be sent as a reply to the notice
+func (b *Banhammer) OnSent(msg Message, sentID int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.pending == nil || b.pending.msgID != msg.ID {
+		return
+	}
+	b.pending.entry.NoticeID = sentID
+	b.add(b.pending.entry)
+	b.pending = nil
+}
 
+// flush journals pending ban without notice id
+func (b *Banhammer) flush() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.pending != nil {
+		b.add(b.pending.entry)
+		b.pending = nil
+	}
+}
+
+// journal saves the request to moderation journal. Successful ban or mute is kept pending till its notice is sent.
+func (b *Banhammer) journal(req banRequest, msg Message, actionErr error) {
+	if b.modLog == nil {
+		return
+	}
+	entry := ModEntry{Time: time.Now(), Action: map[string]ModAction{"ban": ModBan, "mute": ModRestrict, "unban": ModUnban}[req.cmd],
+		Source: "Banhammer", Actor: msg.From, Target: req.target.User, Reason: req.reason, Duration: req.duration}
+	if req.target.ChannelID != 0 {
+		entry.ChannelID, entry.ChannelName = req.target.ChannelID, strings.TrimPrefix(req.target.Name, "@")
+	}
+	if msg.ReplyTo.ID != 0 {
+		entry.MessageID, entry.Message = msg.ReplyTo.ID, msg.ReplyTo.Text
+	}
+	if actionErr != nil {
+		entry.Error = actionErr.Error()
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if actionErr == nil && req.cmd != "unban" {
+		b.pending = &pendingBan{msgID: msg.ID, entry: entry}
+		return
+	}
+	b.add(entry)
+}
+
+// block adds permanently banned user to the blocklist and removes unbanned one from it
+func (b *Banhammer) block(req banRequest, actionErr error) {
+	if b.blocklist == nil || actionErr != nil || req.target.ChannelID != 0 {
+		return
+	}
+	var err error
+	switch {
+	case req.cmd == "ban" && req.duration == 0:
+		err = b.blocklist.Add(req.target.User, "ban: "+req.reason)
+	case req.cmd == "unban":
+		err = b.blocklist.Remove(req.target.User)
+	}
+	if err != nil {
+		log.Printf("[WARN] can't update blocklist for %+v, %v", req.target.User, err)
+	}
+}
+
+// add saves the entry to moderation journal, should be called under lock
+func (b *Banhammer) add(entry ModEntry) {
+	if err := b.modLog.Add(entry); err != nil {
+		log.Printf("[WARN] can't save moderation record %+v, %v", entry, err)
+	}
+}
+
+// text makes reply for successful request
+func (r banRequest) text() string {
+	name := EscapeMarkDownV1Text(r.target.Name)
+	var res string
+	switch r.cmd {
+	case "ban":
+		res = "прощай " + name
+	case "mute":
+		res = name + " помолчит"
+	case "unban":
+		return "амнистия для " + name
+	}
+
+	if r.duration > 0 {
+		res += " на " + HumanizeDuration(r.duration)
+	} else {
+		res += " навсегда"
+	}
+	if r.reason != "" {
+		res += ", причина: " + EscapeMarkDownV1Text(r.reason)
+	}
+	return res
+}
+
+func (b *Banhammer) parse(text string) (react bool, cmd string, args []string) {
 	for _, prefix := range b.ReactOn() {
 		if strings.HasPrefix(text, prefix) {
-			return true, strings.TrimSuffix(prefix, "!"),
-				strings.Replace(strings.TrimSpace(strings.TrimPrefix(text, prefix)), " ", "+", -1)
+			return true, strings.TrimSuffix(prefix, "!"), strings.Fields(strings.TrimPrefix(text, prefix))
+		}
+	}
+	return false, "", nil
+}
+
+var (
+	banDurationRe     = regexp.MustCompile(`^(\d+[wdhms])+$`)
+	banDurationPartRe = regexp.MustCompile(`(\d+)([wdhms])`)
+	banDurationUnits  = map[string]time.Duration{"w": 7 * Day, "d": Day, "h": time.Hour, "m": time.Minute, "s": time.Second}
+)
+
+// telegram treats restrictions shorter than 30s or longer than 366 days as forever
+const (
+	minBanDuration = 30 * time.Second
+	maxBanDuration = 366 * Day
+)
+
+// isBanDuration checks if s looks like a ban duration, valid or not
+func isBanDuration(s string) bool {
+	return banDurationRe.MatchString(strings.ToLower(s))
+}
+
+// parseBanDuration parses durations like 30m, 2h, 1d12h, 1w.
+// Durations outside of [30s, 366d] rejected, as telegram would make them forever.
+func parseBanDuration(s string) (time.Duration, error) {
+	s = strings.ToLower(s)
+	if !banDurationRe.MatchString(s) {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	var res time.Duration
+	for _, m := range banDurationPartRe.FindAllStringSubmatch(s, -1) {
+		n, err := strconv.ParseInt(m[1], 10, 64)
+		unit := banDurationUnits[m[2]]
+		if err != nil || n > int64(maxBanDuration/unit) {
+			return 0, fmt.Errorf("duration %q out of range", s) // also prevents overflow
 		}
+		res += time.Duration(n) * unit
+	}
+
+	if res < minBanDuration || res > maxBanDuration {
+		return 0, fmt.Errorf("duration %q out of range", s)
 	}
-	return false, "", ""
+	return res, nil
+}
+
+func isNumeric(s string) bool {
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
 }
@@ -1,18 +1,23 @@
 package bot
 
 import (
+	"errors"
+	"path"
 	"strconv"
 	"testing"
+	"time"
 
 	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/radio-t/super-bot/app/bot/mocks"
 )
 
 func TestBanhammer_Help(t *testing.T) {
-	b := NewBanhammer(nil, nil, 10)
-	assert.Equal(t, "ban!, unban! _– забанить/разбанить (только для админов)_\n", b.Help())
+	b := NewBanhammer(nil, nil, nil, nil, nil)
+	assert.Equal(t, "ban!, unban!, mute! _– забанить/заглушить/разбанить (только для админов): "+
+		"ban! @user 2h причина, или ответом на сообщение_\n", b.Help())
 }
 
 func TestBanhammer_parse(t *testing.T) {
@@ -21,25 +26,26 @@ func TestBanhammer_parse(t *testing.T) {
 		text string
 		ok   bool
 		cmd  string
-		req  string
+		args []string
 	}{
-		{"blah", false, "", ""},
-		{"ban!someone", true, "ban", "someone"},
-		{"ban! user2", true, "ban", "user2"},
-		{"unban! user2", true, "unban", "user2"},
+		{"blah", false, "", nil},
+		{"ban!someone", true, "ban", []string{"someone"}},
+		{"ban! user2", true, "ban", []string{"user2"}},
+		{"unban! user2", true, "unban", []string{"user2"}},
+		{"mute! @user2  30m  spam links", true, "mute", []string{"@user2", "30m", "spam", "links"}},
 	}
 
 	b := &Banhammer{}
 	for i, tt := range tbl {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			ok, cmd, req := b.parse(tt.text)
+			ok, cmd, args := b.parse(tt.text)
 			if !tt.ok {
 				assert.False(t, ok)
 				return
 			}
 			assert.True(t, ok)
 			assert.Equal(t, tt.cmd, cmd)
-			assert.Equal(t, tt.req, req)
+			assert.Equal(t, tt.args, args)
 		})
 	}
 }
@@ -49,24 +55,264 @@ func TestBanhammer_OnMessage(t *testing.T) {
 	tg := &mocks.TgBanClient{RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
 		return &tbapi.APIResponse{Ok: true}, nil
 	}}
-	b := NewBanhammer(tg, su, 10)
+	users, err := NewUserDirectory(path.Join(t.TempDir(), "users.jsonl"))
+	require.NoError(t, err)
+	b := NewBanhammer(tg, su, users, nil, nil)
 
-	resp := b.OnMessage(Message{Text: "ban! user1", From: User{Username: "user1", ID: 1}})
+	msg := Message{Text: "ban! user1", From: User{Username: "user1", ID: 1}}
+	users.Observe(msg)
+	resp := b.OnMessage(msg)
 	assert.Equal(t, Response{}, resp, "not admin")
 
 	resp = b.OnMessage(Message{Text: "bawwwn! user1", From: User{Username: "admin", ID: 0}})
 	assert.Equal(t, Response{}, resp, "not a command")
 
 	resp = b.OnMessage(Message{Text: "ban! user1", From: User{Username: "admin"}, ChatID: 123})
-	assert.Equal(t, Response{Text: "прощай user1", Send: true}, resp)
+	assert.Equal(t, Response{Text: "прощай user1 навсегда", Send: true}, resp)
 
 	resp = b.OnMessage(Message{Text: "unban! user1", From: User{Username: "admin"}, ChatID: 123})
 	assert.Equal(t, Response{Text: "амнистия для user1", Send: true}, resp)
 
-	assert.Equal(t, 5, len(su.IsSuperCalls()))
+	resp = b.OnMessage(Message{ID: 7, Text: "ban! user2", From: User{Username: "admin"}, ChatID: 123})
+	assert.Equal(t, Response{Text: "не знаю пользователя user2", Send: true, ReplyTo: 7}, resp)
+
+	assert.Equal(t, 6, len(su.IsSuperCalls()))
 	assert.Equal(t, 2, len(tg.RequestCalls()))
 	assert.Equal(t, int64(1), tg.RequestCalls()[0].C.(tbapi.BanChatMemberConfig).UserID)
 	assert.Equal(t, int64(123), tg.RequestCalls()[0].C.(tbapi.BanChatMemberConfig).ChatID)
+	assert.Equal(t, int64(0), tg.RequestCalls()[0].C.(tbapi.BanChatMemberConfig).UntilDate)
 	assert.Equal(t, int64(1), tg.RequestCalls()[1].C.(tbapi.UnbanChatMemberConfig).UserID)
 	assert.Equal(t, int64(123), tg.RequestCalls()[1].C.(tbapi.UnbanChatMemberConfig).ChatID)
 }
+
+func TestBanhammer_OnMessageDurationAndReply(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	tg := &mocks.TgBanClient{RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+		return &tbapi.APIResponse{Ok: true}, nil
+	}}
+	users, err := NewUserDirectory(path.Join(t.TempDir(), "users.jsonl"))
+	require.NoError(t, err)
+	users.Observe(Message{From: User{ID: 1, Username: "user_1"}})
+	modLog, err := NewModLog(path.Join(t.TempDir(), "modlog.jsonl"))
+	require.NoError(t, err)
+	b := NewBanhammer(tg, su, users, modLog, nil)
+
+	resp := b.OnMessage(Message{Text: "ban! @user_1 2h spam links", From: User{Username: "admin"}, ChatID: 123})
+	assert.Equal(t, Response{Text: "прощай @user\\_1 на 2ч, причина: spam links", Send: true}, resp)
+	ban := tg.RequestCalls()[0].C.(tbapi.BanChatMemberConfig)
+	assert.Equal(t, int64(1), ban.UserID)
+	assert.InDelta(t, time.Now().Add(2*time.Hour).Unix(), ban.UntilDate, 5)
+
+	resp = b.OnMessage(Message{Text: "mute! 1 30m", From: User{Username: "admin"}, ChatID: 123})
+	assert.Equal(t, Response{Text: "@user\\_1 помолчит на 30мин", Send: true}, resp)
+	mute := tg.RequestCalls()[1].C.(tbapi.RestrictChatMemberConfig)
+	assert.Equal(t, int64(1), mute.UserID)
+	assert.False(t, mute.Permissions.CanSendMessages)
+	assert.InDelta(t, time.Now().Add(30*time.Minute).Unix(), mute.UntilDate, 5)
+
+	msg := Message{Text: "ban! 1d флуд", From: User{Username: "admin"}, ChatID: 123}
+	msg.ReplyTo.From = User{ID: 2, Username: "user2"}
+	resp = b.OnMessage(msg)
+	assert.Equal(t, Response{Text: "прощай @user2 на 1дн, причина: флуд", Send: true}, resp)
+	assert.Equal(t, int64(2), tg.RequestCalls()[2].C.(tbapi.BanChatMemberConfig).UserID)
+
+	msg = Message{Text: "ban!", From: User{Username: "admin"}, ChatID: 123}
+	msg.ReplyTo.From = User{ID: 136817688, Username: "Channel_Bot"}
+	msg.ReplyTo.SenderChat = SenderChat{ID: 555, UserName: "spam_channel"}
+	resp = b.OnMessage(msg)
+	assert.Equal(t, Response{Text: "прощай @spam\\_channel навсегда", Send: true}, resp)
+	assert.Equal(t, int64(555), tg.RequestCalls()[3].C.(tbapi.BanChatSenderChatConfig).SenderChatID)
+
+	msg.Text = "unban!"
+	resp = b.OnMessage(msg)
+	assert.Equal(t, Response{Text: "амнистия для @spam\\_channel", Send: true}, resp)
+	assert.Equal(t, int64(555), tg.RequestCalls()[4].C.(tbapi.UnbanChatSenderChatConfig).SenderChatID)
+
+	msg = Message{ID: 9, Text: "mute!", From: User{Username: "admin"}, ChatID: 123}
+	msg.ReplyTo.SenderChat = SenderChat{ID: 555, UserName: "spam_channel"}
+	resp = b.OnMessage(msg)
+	assert.Equal(t, Response{Text: "канал можно только забанить", Send: true, ReplyTo: 9}, resp)
+
+	resp = b.OnMessage(Message{ID: 10, Text: "ban!", From: User{Username: "admin"}, ChatID: 123})
+	assert.Equal(t, Response{Text: "кого? укажите @user или ответьте на сообщение", Send: true, ReplyTo: 10}, resp)
+
+	calls := len(tg.RequestCalls())
+	resp = b.OnMessage(Message{ID: 11, Text: "ban! @user_1 400d", From: User{Username: "admin"}, ChatID: 123})
+	assert.Equal(t, Response{Text: "срок 400d вне допустимого диапазона, от 30s до 366d", Send: true, ReplyTo: 11}, resp)
+	assert.Len(t, tg.RequestCalls(), calls, "no ban for invalid duration")
+
+	msg = Message{Text: "ban! 1h", From: User{Username: "admin"}, ChatID: 123}
+	msg.ReplyTo.From = User{ID: 3, Username: "admin"}
+	assert.Equal(t, Response{}, b.OnMessage(msg), "super can't be banned")
+	assert.Equal(t, 5, len(tg.RequestCalls()))
+
+	entries := modLog.Find(ModQuery{})
+	require.Len(t, entries, 5)
+	assert.Equal(t, ModBan, entries[0].Action)
+	assert.Equal(t, "Banhammer", entries[0].Source)
+	assert.Equal(t, "admin", entries[0].Actor.Username)
+	assert.Equal(t, int64(1), entries[0].Target.ID)
+	assert.Equal(t, 2*time.Hour, entries[0].Duration)
+	assert.Equal(t, "spam links", entries[0].Reason)
+	assert.Equal(t, ModRestrict, entries[1].Action)
+	assert.Equal(t, "флуд", entries[2].Reason)
+	assert.Equal(t, "spam_channel", entries[3].ChannelName)
+	assert.Equal(t, ModUnban, entries[4].Action)
+}
+
+func TestBanhammer_OnMessageUnbanJournaled(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	tg := &mocks.TgBanClient{RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+		return &tbapi.APIResponse{Ok: true}, nil
+	}}
+	users, err := NewUserDirectory(path.Join(t.TempDir(), "users.jsonl"))
+	require.NoError(t, err)
+	modLog, err := NewModLog(path.Join(t.TempDir(), "modlog.jsonl"))
+	require.NoError(t, err)
+	require.NoError(t, modLog.Add(ModEntry{Action: ModRestrict, Source: "WTF", Target: User{ID: 1, Username: "user1"},
+		Duration: time.Hour, NoticeID: 77}))
+	b := NewBanhammer(tg, su, users, modLog, nil)
+
+	msg := Message{ID: 10, Text: "unban!", From: User{Username: "admin"}, ChatID: 123}
+	msg.ReplyTo.ID = 77
+	msg.ReplyTo.From = User{ID: 999, Username: "bot"}
+	resp := b.OnMessage(msg)
+	assert.Equal(t, Response{Text: "амнистия для @user1", Send: true}, resp, "reply to ban notice")
+	lift := tg.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig)
+	assert.Equal(t, int64(1), lift.UserID)
+	assert.True(t, lift.Permissions.CanSendMessages, "restriction lifted by permissions")
+	assert.Empty(t, modLog.Active(time.Now()))
+
+	resp = b.OnMessage(Message{Text: "unban! 12345", From: User{Username: "admin"}, ChatID: 123})
+	assert.Equal(t, Response{Text: "амнистия для 12345", Send: true}, resp, "unknown user id")
+	assert.Equal(t, int64(12345), tg.RequestCalls()[1].C.(tbapi.UnbanChatMemberConfig).UserID)
+
+	resp = b.OnMessage(Message{Text: "unban! -100500", From: User{Username: "admin"}, ChatID: 123})
+	assert.Equal(t, Response{Text: "амнистия для -100500", Send: true}, resp, "unknown channel id")
+	assert.Equal(t, int64(-100500), tg.RequestCalls()[2].C.(tbapi.UnbanChatSenderChatConfig).SenderChatID)
+}
+
+func TestBanhammer_OnSent(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	tg := &mocks.TgBanClient{RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+		return &tbapi.APIResponse{Ok: true}, nil
+	}}
+	users, err := NewUserDirectory(path.Join(t.TempDir(), "users.jsonl"))
+	require.NoError(t, err)
+	users.Observe(Message{From: User{ID: 1, Username: "user1"}})
+	modLog, err := NewModLog(path.Join(t.TempDir(), "modlog.jsonl"))
+	require.NoError(t, err)
+	b := NewBanhammer(tg, su, users, modLog, nil)
+
+	msg := Message{ID: 10, Text: "mute! @user1 1h", From: User{Username: "admin"}, ChatID: 123}
+	require.True(t, b.OnMessage(msg).Send)
+	assert.Empty(t, modLog.Find(ModQuery{}), "journaled when the notice sent")
+	b.OnSent(Message{ID: 11}, 100)
+	assert.Empty(t, modLog.Find(ModQuery{}), "notice for other message")
+	b.OnSent(msg, 100)
+	e, found := modLog.FindNotice(100)
+	require.True(t, found)
+	assert.Equal(t, int64(1), e.Target.ID)
+	assert.Equal(t, ModRestrict, e.Action)
+
+	unban := Message{ID: 12, Text: "unban!", From: User{Username: "admin"}, ChatID: 123}
+	unban.ReplyTo.ID, unban.ReplyTo.From = 100, User{ID: 999, Username: "bot"}
+	assert.Equal(t, Response{Text: "амнистия для @user1", Send: true}, b.OnMessage(unban), "reply to the notice")
+	assert.Empty(t, modLog.Active(time.Now()))
+
+	require.True(t, b.OnMessage(Message{ID: 13, Text: "ban! @user1", From: User{Username: "admin"}, ChatID: 123}).Send)
+	require.True(t, b.OnMessage(Message{ID: 14, Text: "unban! @user1", From: User{Username: "admin"}, ChatID: 123}).Send)
+	entries := modLog.Find(ModQuery{})
+	require.Len(t, entries, 4, "ban journaled without notice if it wasn't sent")
+	assert.Equal(t, ModBan, entries[2].Action)
+	assert.Equal(t, 0, entries[2].NoticeID)
+}
+
+func TestLiftRequest(t *testing.T) {
+	assert.Equal(t, tbapi.UnbanChatSenderChatConfig{ChatID: 123, SenderChatID: -100500},
+		LiftRequest(ModEntry{Action: ModBan, ChannelID: -100500}, 123))
+	assert.Equal(t, tbapi.UnbanChatMemberConfig{ChatMemberConfig: tbapi.ChatMemberConfig{UserID: 1, ChatID: 123}, OnlyIfBanned: true},
+		LiftRequest(ModEntry{Action: ModBan, Target: User{ID: 1}}, 123))
+	restrict := LiftRequest(ModEntry{Action: ModRestrict, Target: User{ID: 1}}, 123).(tbapi.RestrictChatMemberConfig)
+	assert.Equal(t, int64(1), restrict.UserID)
+	assert.True(t, restrict.Permissions.CanSendMessages)
+}
+
+func TestBanhammer_OnMessageFailed(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	users, err := NewUserDirectory(path.Join(t.TempDir(), "users.jsonl"))
+	require.NoError(t, err)
+	users.Observe(Message{From: User{ID: 1, Username: "user1"}})
+
+	tg := &mocks.TgBanClient{RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+		return nil, errors.New("Bad Request: not enough rights")
+	}}
+	b := NewBanhammer(tg, su, users, nil, nil)
+	resp := b.OnMessage(Message{ID: 5, Text: "ban! user1 1h", From: User{Username: "admin"}, ChatID: 123})
+	assert.Equal(t, Response{Text: "не удалось выполнить ban для user1: Bad Request: not enough rights", Send: true, ReplyTo: 5}, resp)
+
+	tg.RequestFunc = func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+		return &tbapi.APIResponse{Ok: false, Description: "user is an administrator"}, nil
+	}
+	resp = b.OnMessage(Message{ID: 6, Text: "mute! user1 1h", From: User{Username: "admin"}, ChatID: 123})
+	assert.Equal(t, Response{Text: "не удалось выполнить mute для user1: response is not Ok: user is an administrator",
+		Send: true, ReplyTo: 6}, resp)
+}
+
+func TestParseBanDuration(t *testing.T) {
+	tbl := []struct {
+		in  string
+		res time.Duration
+		err bool
+	}{
+		{"30m", 30 * time.Minute, false},
+		{"2H", 2 * time.Hour, false},
+		{"1d12h", 36 * time.Hour, false},
+		{"1w", 7 * Day, false},
+		{"30s", 30 * time.Second, false},
+		{"366d", 366 * Day, false},
+		{"10s", 0, true},
+		{"400d", 0, true},
+		{"53w", 0, true},
+		{"99999999999w", 0, true},
+		{"99999999999999999999s", 0, true},
+		{"1d9999999999999999h", 0, true},
+		{"spam", 0, true},
+		{"2", 0, true},
+		{"h2", 0, true},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.in, func(t *testing.T) {
+			res, err := parseBanDuration(tt.in)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.res, res)
+		})
+	}
+}
+
+func TestBanhammer_OnMessageBlocklist(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	tg := &mocks.TgBanClient{RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+		return &tbapi.APIResponse{Ok: true}, nil
+	}}
+	users, err := NewUserDirectory(path.Join(t.TempDir(), "users.jsonl"))
+	require.NoError(t, err)
+	users.Observe(Message{From: User{ID: 1, Username: "user_1"}})
+	users.Observe(Message{From: User{ID: 2, Username: "user_2"}})
+	blocklist, err := NewBlocklist(path.Join(t.TempDir(), "blocklist.jsonl"))
+	require.NoError(t, err)
+	b := NewBanhammer(tg, su, users, nil, blocklist)
+
+	b.OnMessage(Message{Text: "ban! @user_1 спам", From: User{Username: "admin"}, ChatID: 123})
+	assert.True(t, blocklist.Contains(1), "banned forever")
+	b.OnMessage(Message{Text: "ban! @user_2 1d флуд", From: User{Username: "admin"}, ChatID: 123})
+	assert.False(t, blocklist.Contains(2), "temporary ban is not blocklisted")
+
+	b.OnMessage(Message{Text: "unban! @user_1", From: User{Username: "admin"}, ChatID: 123})
+	assert.False(t, blocklist.Contains(1), "removed on unban")
+	assert.Len(t, tg.RequestCalls(), 3)
+}
@@ -0,0 +1,137 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// BlockedUser is a record of local blocklist
+type BlockedUser struct {
+	User    User      `json:"user"`
+	Time    time.Time `json:"time"`
+	Reason  string    `json:"reason,omitempty"`
+	Removed bool      `json:"removed,omitempty"` // set when user unblocked, like on ham!
+}
+
+// Blocklist is a persistent set of known spammers, checked before CAS.
+// The file can be shared between bots in different chats, changes made by others are reloaded on check.
+type Blocklist struct {
+	file    *storage.JSONL[BlockedUser]
+	lock    sync.Mutex
+	users   map[int64]BlockedUser // only blocked, removed are excluded
+	modTime time.Time             // of the file when loaded or saved
+	size    int64                 // of the file when loaded or saved
+}
+
+// NewBlocklist loads blocklist from the file
+func NewBlocklist(path string) (*Blocklist, error) {
+	file, err := storage.NewJSONL[BlockedUser](path)
+	if err != nil {
+		return nil, err
+	}
+	res := &Blocklist{file: file, users: map[int64]BlockedUser{}}
+	if err := res.load(); err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] loaded %d blocked users from %s", len(res.users), path)
+	return res, nil
+}
+
+// Add blocks the user, does nothing if already blocked
+func (b *Blocklist) Add(u User, reason string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refresh()
+	if _, found := b.users[u.ID]; found || u.ID == 0 {
+		return nil
+	}
+	rec := BlockedUser{User: u, Time: time.Now(), Reason: reason}
+	if err := b.append(rec); err != nil {
+		return err
+	}
+	b.users[u.ID] = rec
+	return nil
+}
+
+// Remove unblocks the user, does nothing if not blocked
+func (b *Blocklist) Remove(u User) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refresh()
+	rec, found := b.users[u.ID]
+	if !found {
+		return nil
+	}
+	rec.Time, rec.Removed = time.Now(), true
+	if err := b.append(rec); err != nil {
+		return err
+	}
+	delete(b.users, u.ID)
+	return nil
+}
+
+// Contains checks if user is blocked
+func (b *Blocklist) Contains(userID int64) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refresh()
+	_, found := b.users[userID]
+	return found
+}
+
+// Len returns number of blocked users
+func (b *Blocklist) Len() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.users)
+}
+
+// append saves the record and keeps modification time, so own changes don't cause reload
+func (b *Blocklist) append(rec BlockedUser) error {
+	if err := b.file.Append(rec); err != nil {
+		return fmt.Errorf("can't save blocked user %d: %w", rec.User.ID, err)
+	}
+	b.keepStat()
+	return nil
+}
+
+// refresh reloads the file if it was changed by someone else
+func (b *Blocklist) refresh() {
+	fi, err := os.Stat(b.file.Path())
+	if err != nil || (fi.ModTime().Equal(b.modTime) && fi.Size() == b.size) {
+		return
+	}
+	if err := b.load(); err != nil {
+		log.Printf("[WARN] can't reload blocklist, %v", err)
+	}
+}
+
+// load reads all records, the last record of the user wins
+func (b *Blocklist) load() error {
+	b.keepStat()
+	recs, err := b.file.Load()
+	if err != nil {
+		return fmt.Errorf("can't load blocklist: %w", err)
+	}
+	users := map[int64]BlockedUser{}
+	for _, r := range recs {
+		if r.Removed {
+			delete(users, r.User.ID)
+			continue
+		}
+		users[r.User.ID] = r
+	}
+	b.users = users
+	return nil
+}
+
+func (b *Blocklist) keepStat() {
+	if fi, err := os.Stat(b.file.Path()); err == nil {
+		b.modTime, b.size = fi.ModTime(), fi.Size()
+	}
+}
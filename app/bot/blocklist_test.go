@@ -0,0 +1,41 @@
+package bot
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlocklist(t *testing.T) {
+	fname := path.Join(t.TempDir(), "blocklist.jsonl")
+	b, err := NewBlocklist(fname)
+	require.NoError(t, err)
+	assert.False(t, b.Contains(1))
+
+	require.NoError(t, b.Add(User{ID: 1, Username: "spammer1"}, "spam: similarity"))
+	require.NoError(t, b.Add(User{ID: 1, Username: "spammer1"}, "spam: cas"), "already blocked")
+	require.NoError(t, b.Add(User{ID: 2, Username: "spammer2"}, "spam: reported"))
+	require.NoError(t, b.Add(User{}, "no id"))
+	assert.True(t, b.Contains(1))
+	assert.Equal(t, 2, b.Len())
+
+	require.NoError(t, b.Remove(User{ID: 2}))
+	require.NoError(t, b.Remove(User{ID: 3}), "not blocked")
+	assert.False(t, b.Contains(2))
+
+	shared, err := NewBlocklist(fname)
+	require.NoError(t, err)
+	assert.Equal(t, 1, shared.Len(), "removal persisted")
+	assert.True(t, shared.Contains(1))
+
+	require.NoError(t, shared.Add(User{ID: 5, Username: "spammer5"}, "spam: emoji"))
+	assert.True(t, b.Contains(5), "changes by another bot reloaded")
+
+	data, err := os.ReadFile(fname)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(fname, append(data, []byte("{\"user\":{\"ID\":5},\"removed\":true}\n")...), 0o600))
+	assert.False(t, b.Contains(5), "removed by another bot")
+}
@@ -30,6 +30,12 @@ type Interface interface {
 	Help() string
 }
 
+// SentListener is an optional interface for bots which need to know ids of sent responses,
+// like to continue a conversation on replies. Called with the message bots responded to.
+type SentListener interface {
+	OnSent(msg Message, sentID int)
+}
+
 // Response describes bot's answer on particular message
 type Response struct {
 	Text          string
@@ -43,6 +49,9 @@ type Response struct {
 	ReplyTo       int           // message to reply to, if 0 then no reply but common message
 	ParseMode     string        // parse mode for message in Telegram (we use Markdown by default)
 	DeleteReplyTo bool          // delete message what bot replays to
+	Reason        string        // reason of ban or delete, for moderation journal
+	Details       string        // optional explanation of the reason, for moderation journal
+	Source        string        // bot requested ban, delete or pin, set by MultiBot if empty
 }
 
 // HTTPClient wrap http.Client to allow mocking
@@ -78,9 +87,13 @@ type Message struct {
 	Text       string    `json:",omitempty"`
 	Entities   *[]Entity `json:",omitempty"`
 	Image      *Image    `json:",omitempty"`
+	Forwarded  bool      `json:",omitempty"` // forwarded from another chat or user
+	NewMembers []User    `json:",omitempty"` // users joined the chat
 	ReplyTo    struct {
+		ID         int `json:",omitempty"`
 		From       User
 		Text       string `json:",omitempty"`
+		Image      *Image `json:",omitempty"`
 		Sent       time.Time
 		SenderChat SenderChat `json:"sender_chat,omitempty"`
 	} `json:",omitempty"`
@@ -151,6 +164,7 @@ func (b MultiBot) OnMessage(msg Message) (response Response) {
 	var mutex = &sync.Mutex{}
 	var replyTo int
 	var deleteReplyTo int32
+	var reason, details, source string
 
 	wg := syncs.NewSizedGroup(4)
 	for _, bot := range b {
@@ -179,6 +193,16 @@ func (b MultiBot) OnMessage(msg Message) (response Response) {
 				if resp.DeleteReplyTo {
 					atomic.AddInt32(&deleteReplyTo, 1)
 				}
+				if resp.BanInterval > 0 || resp.DeleteReplyTo || resp.Pin || resp.Unpin {
+					mutex.Lock()
+					if source == "" || resp.BanInterval > 0 { // ban reason takes precedence over pin
+						reason, details, source = resp.Reason, resp.Details, resp.Source
+						if source == "" {
+							source = botName(bot)
+						}
+					}
+					mutex.Unlock()
+				}
 			}
 		})
 	}
@@ -211,6 +235,18 @@ func (b MultiBot) OnMessage(msg Message) (response Response) {
 		ChannelID:     channelID,
 		ReplyTo:       replyTo,
 		DeleteReplyTo: atomic.LoadInt32(&deleteReplyTo) > 0,
+		Reason:        reason,
+		Details:       details,
+		Source:        source,
+	}
+}
+
+// OnSent passes id of the sent response to all bots implementing SentListener
+func (b MultiBot) OnSent(msg Message, sentID int) {
+	for _, bot := range b {
+		if l, ok := bot.(SentListener); ok {
+			l.OnSent(msg, sentID)
+		}
 	}
 }
 
@@ -222,6 +258,15 @@ func (b MultiBot) ReactOn() (res []string) {
 	return res
 }
 
+// botName returns type name of the bot without package, like "WTF" for *bot.WTF
+func botName(b Interface) string {
+	name := strings.TrimPrefix(fmt.Sprintf("%T", b), "*")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
 func contains(s []string, e string) bool {
 	e = strings.TrimSpace(e)
 	for _, a := range s {
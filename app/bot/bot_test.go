@@ -3,6 +3,7 @@ package bot
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -66,3 +67,41 @@ func TestMultiBotCombinesAllBotResponses(t *testing.T) {
 	assert.Equal(t, 789, resp.ReplyTo)
 	assert.True(t, resp.DeleteReplyTo)
 }
+
+type sentRecorder struct {
+	InterfaceMock
+	sent []int
+}
+
+func (r *sentRecorder) OnSent(msg Message, sentID int) { r.sent = append(r.sent, msg.ID, sentID) }
+
+func TestMultiBotOnSent(t *testing.T) {
+	r := &sentRecorder{}
+	mb := MultiBot{&InterfaceMock{}, r}
+	mb.OnSent(Message{ID: 10}, 11)
+	assert.Equal(t, []int{10, 11}, r.sent)
+}
+
+func TestMultiBotModerationSource(t *testing.T) {
+	b1 := &InterfaceMock{
+		ReactOnFunc:   func() []string { return []string{"cmd"} },
+		OnMessageFunc: func(m Message) Response { return Response{Send: true, Text: "b1 resp", Pin: true} },
+	}
+	b3 := &InterfaceMock{
+		ReactOnFunc: func() []string { return []string{"cmd"} },
+		OnMessageFunc: func(m Message) Response {
+			return Response{Send: true, Text: "b3 resp", BanInterval: time.Hour, User: User{ID: 1}, Reason: "wtf"}
+		},
+	}
+
+	resp := MultiBot{b1, b3}.OnMessage(Message{Text: "cmd"})
+	assert.Equal(t, "wtf", resp.Reason)
+	assert.Equal(t, "InterfaceMock", resp.Source)
+
+	resp = MultiBot{b1}.OnMessage(Message{Text: "cmd"})
+	assert.Equal(t, "", resp.Reason)
+	assert.Equal(t, "InterfaceMock", resp.Source, "pin source")
+
+	assert.Equal(t, "WTF", botName(&WTF{}))
+	assert.Equal(t, "Banhammer", botName(&Banhammer{}))
+}
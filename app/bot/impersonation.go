@@ -0,0 +1,149 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/radio-t/super-bot/app/homoglyph"
+)
+
+const minImpersonationContains = 5 // protected names shorter than this match usernames exactly, not as a part
+
+// Impersonation bot detects users with display name or username looking like a superuser or a host,
+// written with lookalike characters from other alphabets. Checks authors of all messages and new members.
+type Impersonation struct {
+	superUser SuperUser
+	admins    []string          // superusers alerted on detection
+	names     map[string]string // normalized protected name -> name as is
+	restrict  time.Duration     // 0 means alert only
+
+	lock    sync.Mutex
+	alerted map[int64]bool // users reported already
+}
+
+// NewImpersonation makes a bot protecting superusers and hosts from whatsthetime.data in dataLocation.
+// Detected users are restricted for the given duration, 0 means alert only.
+func NewImpersonation(superUser SuperUser, admins []string, dataLocation string, restrict time.Duration) (*Impersonation, error) {
+	hosts, err := readLines(filepath.Join(dataLocation, "whatsthetime.data"))
+	if err != nil {
+		return nil, fmt.Errorf("can't load hosts: %w", err)
+	}
+	res := &Impersonation{superUser: superUser, admins: admins, names: map[string]string{}, restrict: restrict,
+		alerted: map[int64]bool{}}
+	for _, name := range admins {
+		if key := impersonationKey(name); key != "" {
+			res.names[key] = name
+		}
+	}
+	for _, line := range hosts { // host names override usernames, as they look nicer in alerts
+		name, _, _ := strings.Cut(line, "|")
+		if key := impersonationKey(name); key != "" {
+			res.names[key] = strings.TrimSpace(name)
+		}
+	}
+	log.Printf("[INFO] impersonation bot, %d protected names, restrict: %v", len(res.names), restrict)
+	return res, nil
+}
+
+// Help returns help message
+func (b *Impersonation) Help() string {
+	return ""
+}
+
+// ReactOn keys
+func (b *Impersonation) ReactOn() []string {
+	return []string{}
+}
+
+// OnMessage checks the author and new members, alerts superusers and restricts the first impersonator found
+func (b *Impersonation) OnMessage(msg Message) (response Response) {
+	users := append([]User{msg.From}, msg.NewMembers...)
+	for _, u := range users {
+		if u.ID == 0 || msg.SenderChat.ID != 0 || b.superUser.IsSuper(u.Username) {
+			continue
+		}
+		name, found := b.lookalike(u)
+		if !found || !b.alert(u.ID) {
+			continue
+		}
+		log.Printf("[INFO] user %+v looks like %s", u, name)
+
+		mention := u.DisplayName
+		if u.Username != "" {
+			mention = "@" + u.Username // username itself may be the lookalike, show it rather than display name
+		}
+		text := fmt.Sprintf("%s (id:%d) похож на %s, но это другой аккаунт", EscapeMarkDownV1Text(mention),
+			u.ID, EscapeMarkDownV1Text(name))
+		if b.restrict > 0 {
+			text += ", молчит " + HumanizeDuration(b.restrict)
+		}
+		if len(b.admins) > 0 {
+			text += ". " + EscapeMarkDownV1Text("@"+strings.Join(b.admins, " @"))
+		}
+		resp := Response{Text: text, Send: true, ReplyTo: msg.ID}
+		if b.restrict > 0 {
+			resp.BanInterval, resp.User, resp.Reason = b.restrict, u, "impersonation: "+name
+		}
+		return resp
+	}
+	return Response{}
+}
+
+// lookalike returns protected name the user looks like.
+// Display name or a separate word of it matches if it is a protected name written with non-latin lookalikes,
+// display name in latin matches only if it is exactly a protected name, so "Gray Smith" is not an impersonator.
+// Username matches if it is a protected name or contains it, for names long enough.
+func (b *Impersonation) lookalike(u User) (string, bool) {
+	display := strings.TrimSpace(u.DisplayName)
+	if name, found := b.names[impersonationKey(display)]; found && (strings.EqualFold(display, name) || nonLatin(display)) {
+		return name, true
+	}
+	for _, w := range strings.Fields(display) {
+		if name, found := b.names[impersonationKey(w)]; found && nonLatin(w) {
+			return name, true
+		}
+	}
+	username := impersonationKey(u.Username)
+	if username == "" {
+		return "", false
+	}
+	for key, name := range b.names {
+		if username == key || (len(key) >= minImpersonationContains && strings.Contains(username, key)) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// alert returns true for the first detection of the user
+func (b *Impersonation) alert(userID int64) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.alerted[userID] {
+		return false
+	}
+	b.alerted[userID] = true
+	return true
+}
+
+// nonLatin returns true if the text has letters or digits out of ascii, like cyrillic, accented or fullwidth ones
+func nonLatin(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool {
+		return r > unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))
+	}) >= 0
+}
+
+// impersonationKey returns homoglyph skeleton with letters and digits only, "Alek.sys" -> "aleksys"
+func impersonationKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, homoglyph.Skeleton(s))
+}
@@ -0,0 +1,62 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+)
+
+func TestImpersonation_OnMessage(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "whatsthetime.data"),
+		[]byte("Umputun|America/Chicago\nBobuk|Europe/Kiev\nGray|Europe/Kiev\nAlek.sys|Europe/London\n"), 0o600))
+	admins := []string{"umputun", "bobuk", "radio_t_admin"}
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return contains(admins, userName) }}
+	b, err := NewImpersonation(su, admins, dir, Day)
+	require.NoError(t, err)
+
+	tbl := []struct {
+		name     string
+		user     User
+		expected string // protected name, empty if not an impersonator
+	}{
+		{"regular user", User{ID: 2, Username: "john", DisplayName: "John Smith"}, ""},
+		{"cyrillic lookalikes", User{ID: 3, Username: "someone", DisplayName: "Umрutun"}, "Umputun"},
+		{"word in display name", User{ID: 4, Username: "someone", DisplayName: "Воbuk Radio-T"}, "Bobuk"},
+		{"punctuation ignored", User{ID: 5, Username: "someone", DisplayName: "Аlek sys"}, "Alek.sys"},
+		{"latin name differs", User{ID: 5, Username: "someone", DisplayName: "Alek sys"}, ""},
+		{"latin word in display name", User{ID: 5, Username: "someone", DisplayName: "Gray Smith"}, ""},
+		{"exact latin name", User{ID: 5, Username: "someone", DisplayName: "umputun"}, "Umputun"},
+		{"accented latin", User{ID: 5, Username: "someone", DisplayName: "Bóbuk"}, "Bobuk"},
+		{"username contains", User{ID: 6, Username: "umputun_official", DisplayName: "Support"}, "Umputun"},
+		{"short name as part of username", User{ID: 7, Username: "grayson", DisplayName: "Jake"}, ""},
+		{"admin username", User{ID: 8, Username: "radio_t_admin1", DisplayName: "Admin"}, "radio_t_admin"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			name, found := b.lookalike(tt.user)
+			assert.Equal(t, tt.expected != "", found)
+			assert.Equal(t, tt.expected, name)
+		})
+	}
+
+	impostor := User{ID: 10, Username: "umputun_", DisplayName: "Umputun"}
+	resp := b.OnMessage(Message{ID: 100, From: impostor, Text: "hi, write me in private"})
+	assert.Equal(t, Response{Text: "@umputun\\_ (id:10) похож на Umputun, но это другой аккаунт, молчит 1дн. " +
+		"@umputun @bobuk @radio\\_t\\_admin", Send: true, ReplyTo: 100, BanInterval: Day, User: impostor,
+		Reason: "impersonation: Umputun"}, resp)
+	assert.Equal(t, Response{}, b.OnMessage(Message{ID: 101, From: impostor, Text: "again"}), "alerted once")
+	assert.Equal(t, Response{}, b.OnMessage(Message{ID: 102, From: User{ID: 1, Username: "umputun", DisplayName: "Umputun"}}))
+
+	joined := Message{ID: 103, From: User{ID: 11, Username: "inviter", DisplayName: "Inviter"},
+		NewMembers: []User{{ID: 12, DisplayName: "Ksenks"}, {ID: 13, DisplayName: "Gray"}}}
+	alertOnly, err := NewImpersonation(su, nil, dir, 0)
+	require.NoError(t, err)
+	assert.Equal(t, Response{Text: "Gray (id:13) похож на Gray, но это другой аккаунт", Send: true, ReplyTo: 103},
+		alertOnly.OnMessage(joined), "new members checked, alert only")
+}
@@ -0,0 +1,364 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// ModAction is a kind of moderation action
+type ModAction string
+
+// enum of all moderation actions
+const (
+	ModBan      ModAction = "ban"      // user kicked or channel banned
+	ModRestrict ModAction = "restrict" // user can't send messages
+	ModUnban    ModAction = "unban"
+	ModDelete   ModAction = "delete"
+	ModPin      ModAction = "pin"
+	ModUnpin    ModAction = "unpin"
+)
+
+// ModEntry is a single moderation action
+type ModEntry struct {
+	Time        time.Time     `json:"time"`
+	Action      ModAction     `json:"action"`
+	Actor       User          `json:"actor,omitempty"`        // user whose message caused the action, could be the target itself
+	Source      string        `json:"source"`                 // bot or subsystem made the action, like WTF or bot_activity
+	Target      User          `json:"target,omitempty"`       // user banned or restricted
+	ChannelID   int64         `json:"channel_id,omitempty"`   // channel banned instead of user
+	ChannelName string        `json:"channel_name,omitempty"` // banned channel username
+	Reason      string        `json:"reason,omitempty"`
+	Details     string        `json:"details,omitempty"`    // explanation of the reason, like spam checks breakdown
+	Duration    time.Duration `json:"duration,omitempty"`   // 0 is forever for bans and restrictions
+	MessageID   int           `json:"message_id,omitempty"` // message deleted, pinned or caused the action
+	NoticeID    int           `json:"notice_id,omitempty"`  // bot message announced the action
+	Message     string        `json:"message,omitempty"`    // text of the message
+	Error       string        `json:"error,omitempty"`      // set if telegram refused the action
+}
+
+// TargetName returns mention of banned channel or user
+func (e ModEntry) TargetName() string {
+	switch {
+	case e.ChannelID != 0 && e.ChannelName != "":
+		return "@" + e.ChannelName
+	case e.ChannelID != 0:
+		return strconv.FormatInt(e.ChannelID, 10)
+	case e.Target.Username != "":
+		return "@" + e.Target.Username
+	case e.Target.DisplayName != "":
+		return e.Target.DisplayName
+	case e.Target.ID != 0:
+		return strconv.FormatInt(e.Target.ID, 10)
+	}
+	return ""
+}
+
+// TargetID returns id of banned channel or user
+func (e ModEntry) TargetID() int64 {
+	if e.ChannelID != 0 {
+		return e.ChannelID
+	}
+	return e.Target.ID
+}
+
+// Permanent returns true for bans and restrictions telegram treats as forever
+func (e ModEntry) Permanent() bool {
+	return e.Duration <= 0 || e.Duration > 366*Day
+}
+
+// Until returns expiration time of ban or restriction, zero for permanent ones
+func (e ModEntry) Until() time.Time {
+	if e.Permanent() {
+		return time.Time{}
+	}
+	return e.Time.Add(e.Duration)
+}
+
+// String returns one-line description of the entry, like
+// "2024-05-04 20:00:00 restrict @user 1ч [WTF] wtf, by @user, msg 123: wtf!"
+func (e ModEntry) String() string {
+	parts := []string{e.Time.Format("2006-01-02 15:04:05"), string(e.Action)}
+	if t := e.TargetName(); t != "" {
+		parts = append(parts, t)
+	}
+	if e.Action == ModBan || e.Action == ModRestrict {
+		duration := "навсегда"
+		if e.Duration > 0 {
+			duration = HumanizeDuration(e.Duration)
+		}
+		parts = append(parts, duration)
+	}
+	parts = append(parts, "["+e.Source+"]")
+	res := strings.Join(parts, " ")
+	if e.Reason != "" {
+		res += " " + e.Reason
+	}
+	if e.Details != "" {
+		res += " (" + e.Details + ")"
+	}
+	if e.Actor.Username != "" {
+		res += ", by @" + e.Actor.Username
+	}
+	if e.MessageID != 0 {
+		res += fmt.Sprintf(", msg %d", e.MessageID)
+	}
+	if e.Message != "" {
+		text := []rune(strings.ReplaceAll(e.Message, "\n", " "))
+		if len(text) > maxModLogMessageLen {
+			text = append(text[:maxModLogMessageLen], '…')
+		}
+		res += ": " + string(text)
+	}
+	if e.Error != "" {
+		res += ", failed: " + e.Error
+	}
+	return res
+}
+
+// maxModLogMessageLen limits text of the message in String
+const maxModLogMessageLen = 100
+
+// ModQuery filters journal entries, empty fields match all
+type ModQuery struct {
+	From, To time.Time // [From, To) interval
+	Target   string    // username, with or without "@", or id of target user or channel
+	Action   ModAction
+	Source   string
+	Limit    int // return only the last Limit entries
+}
+
+// ModLog is append-only journal of moderation actions, persisted to jsonl file
+type ModLog struct {
+	file    *storage.JSONL[ModEntry]
+	lock    sync.RWMutex
+	entries []ModEntry
+}
+
+// NewModLog loads moderation journal from the file
+func NewModLog(path string) (*ModLog, error) {
+	file, err := storage.NewJSONL[ModEntry](path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := file.Load()
+	if err != nil {
+		return nil, fmt.Errorf("can't load moderation journal: %w", err)
+	}
+	log.Printf("[INFO] loaded %d moderation records from %s", len(entries), path)
+	return &ModLog{file: file, entries: entries}, nil
+}
+
+// Add saves the entry, sets entry time to now if not set
+func (m *ModLog) Add(e ModEntry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.file.Append(e); err != nil {
+		return fmt.Errorf("can't save moderation record: %w", err)
+	}
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+// Find returns entries matching the query, oldest first
+func (m *ModLog) Find(q ModQuery) []ModEntry {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	target := strings.TrimPrefix(q.Target, "@")
+	targetID, _ := strconv.ParseInt(target, 10, 64)
+	matchTarget := func(e ModEntry) bool {
+		if target == "" {
+			return true
+		}
+		if targetID != 0 {
+			return e.Target.ID == targetID || e.ChannelID == targetID
+		}
+		return strings.EqualFold(e.Target.Username, target) || strings.EqualFold(e.ChannelName, target)
+	}
+
+	res := []ModEntry{}
+	for _, e := range m.entries {
+		if (!q.From.IsZero() && e.Time.Before(q.From)) || (!q.To.IsZero() && !e.Time.Before(q.To)) {
+			continue
+		}
+		if (q.Action != "" && e.Action != q.Action) || (q.Source != "" && !strings.EqualFold(e.Source, q.Source)) {
+			continue
+		}
+		if !matchTarget(e) {
+			continue
+		}
+		res = append(res, e)
+	}
+	if q.Limit > 0 && len(res) > q.Limit {
+		res = res[len(res)-q.Limit:]
+	}
+	return res
+}
+
+// Active returns bans and restrictions in effect at the time, the latest one per target, oldest first
+func (m *ModLog) Active(now time.Time) []ModEntry {
+	res := []ModEntry{}
+	for _, e := range m.restrictions() {
+		if e.Permanent() || e.Until().After(now) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// Expired returns temporary bans and restrictions expired in (since, now] and not lifted by unban, oldest first
+func (m *ModLog) Expired(since, now time.Time) []ModEntry {
+	res := []ModEntry{}
+	for _, e := range m.restrictions() {
+		if until := e.Until(); !e.Permanent() && until.After(since) && !until.After(now) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// FindNotice returns ban or restriction announced by the bot message
+func (m *ModLog) FindNotice(noticeID int) (ModEntry, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		e := m.entries[i]
+		if e.NoticeID == noticeID && (e.Action == ModBan || e.Action == ModRestrict) {
+			return e, true
+		}
+	}
+	return ModEntry{}, false
+}
+
+// restrictions returns the last successful ban or restriction per target not followed by unban, oldest first
+func (m *ModLog) restrictions() []ModEntry {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	last := map[int64]int{} // target id to entry index
+	for i, e := range m.entries {
+		if e.Error != "" || e.TargetID() == 0 {
+			continue
+		}
+		switch e.Action {
+		case ModBan, ModRestrict:
+			last[e.TargetID()] = i
+		case ModUnban:
+			delete(last, e.TargetID())
+		}
+	}
+
+	idx := make([]int, 0, len(last))
+	for _, i := range last {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	res := make([]ModEntry, 0, len(idx))
+	for _, i := range idx {
+		res = append(res, m.entries[i])
+	}
+	return res
+}
+
+// ModLogBot shows moderation journal to superusers
+type ModLogBot struct {
+	modLog    *ModLog
+	superUser SuperUser
+}
+
+// maxModLogEntries limits number of entries in modlog! response
+const maxModLogEntries = 10
+
+// maxActiveBans limits number of entries in bans! response
+const maxActiveBans = 30
+
+// NewModLogBot makes a bot responding on modlog! command
+func NewModLogBot(modLog *ModLog, superUser SuperUser) *ModLogBot {
+	log.Printf("[INFO] moderation journal bot")
+	return &ModLogBot{modLog: modLog, superUser: superUser}
+}
+
+// Help returns help message
+func (b *ModLogBot) Help() string {
+	return GenHelpMsg([]string{"modlog!"}, "журнал модерации: modlog!, modlog! @user, modlog! ban (только для админов)") +
+		GenHelpMsg([]string{"bans!"}, "действующие баны и ограничения (только для админов)")
+}
+
+// ReactOn keys
+func (b *ModLogBot) ReactOn() []string {
+	return []string{"modlog!", "bans!"}
+}
+
+// OnMessage shows the last entries of moderation journal, optionally filtered by target or action
+func (b *ModLogBot) OnMessage(msg Message) (response Response) {
+	fields := strings.Fields(msg.Text)
+	if len(fields) == 0 || !b.superUser.IsSuper(msg.From.Username) {
+		return Response{}
+	}
+	switch strings.ToLower(fields[0]) {
+	case "bans!":
+		return b.activeBans(msg, time.Now())
+	case "modlog!":
+	default:
+		return Response{}
+	}
+
+	q := ModQuery{Limit: maxModLogEntries}
+	for _, f := range fields[1:] {
+		switch ModAction(strings.ToLower(f)) {
+		case ModBan, ModRestrict, ModUnban, ModDelete, ModPin, ModUnpin:
+			q.Action = ModAction(strings.ToLower(f))
+		default:
+			q.Target = f
+		}
+	}
+
+	entries := b.modLog.Find(q)
+	if len(entries) == 0 {
+		return Response{Text: "в журнале модерации ничего нет", Send: true, ReplyTo: msg.ID}
+	}
+	lines := make([]string, 0, len(entries))
+	for _, e := range entries {
+		lines = append(lines, EscapeMarkDownV1Text(e.String()))
+	}
+	return Response{Text: strings.Join(lines, "\n"), Send: true, ReplyTo: msg.ID}
+}
+
+// activeBans lists bans and restrictions in effect, permanent ones marked
+func (b *ModLogBot) activeBans(msg Message, now time.Time) Response {
+	entries := b.modLog.Active(now)
+	if len(entries) == 0 {
+		return Response{Text: "действующих банов нет", Send: true, ReplyTo: msg.ID}
+	}
+	if len(entries) > maxActiveBans {
+		entries = entries[len(entries)-maxActiveBans:]
+	}
+	lines := make([]string, 0, len(entries))
+	for i, e := range entries {
+		kind := "мут"
+		if e.Action == ModBan {
+			kind = "бан"
+		}
+		until := "*навсегда*"
+		if !e.Permanent() {
+			until = "до " + e.Until().Format("02.01.2006 15:04")
+		}
+		line := fmt.Sprintf("%d. %s (id:%d) – %s %s, %s", i+1, EscapeMarkDownV1Text(e.TargetName()), e.TargetID(),
+			kind, until, EscapeMarkDownV1Text(e.Source))
+		if e.Reason != "" {
+			line += ": " + EscapeMarkDownV1Text(e.Reason)
+		}
+		lines = append(lines, line)
+	}
+	return Response{Text: strings.Join(lines, "\n"), Send: true, ReplyTo: msg.ID}
+}
@@ -0,0 +1,142 @@
+package bot
+
+import (
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+)
+
+func TestModLog(t *testing.T) {
+	fname := path.Join(t.TempDir(), "modlog.jsonl")
+	modLog, err := NewModLog(fname)
+	require.NoError(t, err)
+
+	ts := time.Date(2024, 5, 4, 20, 0, 0, 0, time.UTC)
+	require.NoError(t, modLog.Add(ModEntry{Time: ts, Action: ModRestrict, Source: "WTF", Actor: User{ID: 1, Username: "user1"},
+		Target: User{ID: 1, Username: "user1"}, Reason: "wtf", Duration: time.Hour, MessageID: 10, Message: "wtf!"}))
+	require.NoError(t, modLog.Add(ModEntry{Time: ts.Add(time.Minute), Action: ModBan, Source: "channel_ban",
+		ChannelID: -100500, ChannelName: "spam_chan", Error: "not enough rights"}))
+	require.NoError(t, modLog.Add(ModEntry{Action: ModDelete, Source: "SpamFilter", Target: User{ID: 2, Username: "user2"},
+		MessageID: 11, Message: strings.Repeat("спам ", 30)}))
+
+	modLog, err = NewModLog(fname)
+	require.NoError(t, err)
+	all := modLog.Find(ModQuery{})
+	require.Len(t, all, 3, "reloaded")
+	assert.False(t, all[2].Time.IsZero(), "time set on add")
+
+	assert.Len(t, modLog.Find(ModQuery{Target: "@USER1"}), 1)
+	assert.Len(t, modLog.Find(ModQuery{Target: "2"}), 1)
+	assert.Len(t, modLog.Find(ModQuery{Target: "-100500"}), 1)
+	assert.Len(t, modLog.Find(ModQuery{Target: "spam_chan"}), 1)
+	assert.Len(t, modLog.Find(ModQuery{Action: ModBan}), 1)
+	assert.Len(t, modLog.Find(ModQuery{Source: "wtf"}), 1)
+	assert.Len(t, modLog.Find(ModQuery{From: ts, To: ts.Add(time.Minute)}), 1)
+	last := modLog.Find(ModQuery{Limit: 2})
+	require.Len(t, last, 2)
+	assert.Equal(t, ModBan, last[0].Action, "the last entries returned")
+
+	assert.Equal(t, "2024-05-04 20:00:00 restrict @user1 1ч [WTF] wtf, by @user1, msg 10: wtf!", all[0].String())
+	assert.Equal(t, "2024-05-04 20:01:00 ban @spam_chan навсегда [channel_ban], failed: not enough rights", all[1].String())
+	assert.True(t, strings.HasSuffix(all[2].String(), "…"), all[2].String())
+	assert.Equal(t, "2024-05-04 20:00:00 restrict @user1 навсегда [SpamFilter] spam: emoji (emoji 3, len 10)",
+		ModEntry{Time: ts, Action: ModRestrict, Source: "SpamFilter", Target: User{ID: 1, Username: "user1"},
+			Reason: "spam: emoji", Details: "emoji 3, len 10"}.String())
+}
+
+func TestModLog_Active(t *testing.T) {
+	modLog, err := NewModLog(path.Join(t.TempDir(), "modlog.jsonl"))
+	require.NoError(t, err)
+	ts := time.Date(2024, 5, 4, 20, 0, 0, 0, time.UTC)
+	add := func(e ModEntry) {
+		require.NoError(t, modLog.Add(e))
+	}
+	add(ModEntry{Time: ts, Action: ModRestrict, Source: "WTF", Target: User{ID: 1}, Duration: time.Hour, NoticeID: 100})
+	add(ModEntry{Time: ts, Action: ModRestrict, Source: "all_activity", Target: User{ID: 2}, Duration: 5 * time.Minute})
+	add(ModEntry{Time: ts, Action: ModBan, Source: "channel_ban", ChannelID: -100500})
+	add(ModEntry{Time: ts, Action: ModBan, Source: "channel_ban", ChannelID: -100600, Error: "not enough rights"})
+	add(ModEntry{Time: ts, Action: ModRestrict, Source: "SpamFilter", Target: User{ID: 3}, Duration: 400 * Day})
+	add(ModEntry{Time: ts, Action: ModRestrict, Source: "WTF", Target: User{ID: 4}, Duration: time.Hour})
+	add(ModEntry{Time: ts.Add(time.Minute), Action: ModUnban, Source: "Banhammer", Target: User{ID: 4}})
+	add(ModEntry{Time: ts, Action: ModDelete, Source: "SpamFilter", Target: User{ID: 5}})
+
+	ids := func(entries []ModEntry) (res []int64) {
+		for _, e := range entries {
+			res = append(res, e.TargetID())
+		}
+		return res
+	}
+	assert.Equal(t, []int64{1, 2, -100500, 3}, ids(modLog.Active(ts.Add(time.Minute))))
+	assert.Equal(t, []int64{1, -100500, 3}, ids(modLog.Active(ts.Add(10*time.Minute))))
+	assert.Equal(t, []int64{-100500, 3}, ids(modLog.Active(ts.Add(2*time.Hour))), "permanent ones left")
+	assert.Equal(t, []int64{1, 2}, ids(modLog.Expired(ts, ts.Add(2*time.Hour))))
+	assert.Equal(t, []int64{1}, ids(modLog.Expired(ts.Add(10*time.Minute), ts.Add(2*time.Hour))))
+
+	e, ok := modLog.FindNotice(100)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), e.Target.ID)
+	assert.Equal(t, ts.Add(time.Hour), e.Until())
+	_, ok = modLog.FindNotice(101)
+	assert.False(t, ok)
+
+	assert.True(t, ModEntry{Duration: 400 * Day}.Permanent())
+	assert.True(t, ModEntry{}.Permanent())
+	assert.False(t, ModEntry{Time: ts, Duration: time.Hour}.Until().IsZero())
+}
+
+func TestModLogBot_OnMessage(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	modLog, err := NewModLog(path.Join(t.TempDir(), "modlog.jsonl"))
+	require.NoError(t, err)
+	b := NewModLogBot(modLog, su)
+
+	assert.Equal(t, Response{}, b.OnMessage(Message{Text: "modlog!", From: User{Username: "user"}}), "not super")
+	assert.Equal(t, Response{}, b.OnMessage(Message{Text: "something", From: User{Username: "admin"}}))
+	assert.Equal(t, Response{Text: "в журнале модерации ничего нет", Send: true, ReplyTo: 1},
+		b.OnMessage(Message{ID: 1, Text: "modlog!", From: User{Username: "admin"}}))
+
+	ts := time.Date(2024, 5, 4, 20, 0, 0, 0, time.UTC)
+	require.NoError(t, modLog.Add(ModEntry{Time: ts, Action: ModRestrict, Source: "WTF", Target: User{Username: "user_1"},
+		Duration: time.Hour}))
+	require.NoError(t, modLog.Add(ModEntry{Time: ts, Action: ModDelete, Source: "SpamFilter", Target: User{Username: "user2"}}))
+
+	resp := b.OnMessage(Message{ID: 2, Text: "modlog!", From: User{Username: "admin"}})
+	assert.Equal(t, Response{Text: "2024-05-04 20:00:00 restrict @user\\_1 1ч \\[WTF]\n2024-05-04 20:00:00 delete @user2 \\[SpamFilter]",
+		Send: true, ReplyTo: 2}, resp)
+	resp = b.OnMessage(Message{ID: 3, Text: "modlog! @user2", From: User{Username: "admin"}})
+	assert.Equal(t, "2024-05-04 20:00:00 delete @user2 \\[SpamFilter]", resp.Text)
+	resp = b.OnMessage(Message{ID: 4, Text: "modlog! RESTRICT", From: User{Username: "admin"}})
+	assert.Equal(t, "2024-05-04 20:00:00 restrict @user\\_1 1ч \\[WTF]", resp.Text)
+}
+
+func TestModLogBot_OnMessageBans(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	modLog, err := NewModLog(path.Join(t.TempDir(), "modlog.jsonl"))
+	require.NoError(t, err)
+	b := NewModLogBot(modLog, su)
+
+	assert.Equal(t, Response{}, b.OnMessage(Message{Text: "bans!", From: User{Username: "user"}}), "not super")
+	assert.Equal(t, Response{Text: "действующих банов нет", Send: true, ReplyTo: 1},
+		b.OnMessage(Message{ID: 1, Text: "bans!", From: User{Username: "admin"}}))
+
+	ts := time.Now().Truncate(time.Minute)
+	require.NoError(t, modLog.Add(ModEntry{Time: ts, Action: ModRestrict, Source: "WTF", Target: User{ID: 1, Username: "user_1"},
+		Duration: time.Hour, Reason: "wtf"}))
+	require.NoError(t, modLog.Add(ModEntry{Time: ts, Action: ModBan, Source: "channel_ban", ChannelID: -100500,
+		ChannelName: "spam_chan"}))
+	require.NoError(t, modLog.Add(ModEntry{Time: ts, Action: ModRestrict, Source: "SpamFilter", Target: User{ID: 2},
+		Duration: time.Minute}))
+	require.NoError(t, modLog.Add(ModEntry{Time: ts.Add(-time.Hour), Action: ModRestrict, Source: "WTF", Target: User{ID: 3},
+		Duration: time.Minute}))
+
+	resp := b.OnMessage(Message{ID: 2, Text: "bans!", From: User{Username: "admin"}})
+	assert.Equal(t, Response{Text: "1. @user\\_1 (id:1) – мут до " + ts.Add(time.Hour).Format("02.01.2006 15:04") + ", WTF: wtf\n" +
+		"2. @spam\\_chan (id:-100500) – бан *навсегда*, channel\\_ban\n" +
+		"3. 2 (id:2) – мут до " + ts.Add(time.Minute).Format("02.01.2006 15:04") + ", SpamFilter", Send: true, ReplyTo: 2}, resp)
+}
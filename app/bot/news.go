@@ -38,26 +38,39 @@ func (n News) OnMessage(msg Message) (response Response) {
 		return Response{}
 	}
 
-	reqURL := fmt.Sprintf("%s/v1/news/last/%d", n.newsAPI, n.numArticles)
+	lines, err := n.Last(n.numArticles)
+	if err != nil {
+		log.Printf("[WARN] %v", err)
+		return Response{}
+	}
+	return Response{
+		Text: lines + "\n- [все новости и темы](https://news.radio-t.com)",
+		Send: true,
+	}
+}
+
+// Last returns count last news articles in markdown, a line per article. Count is limited by max articles of the bot.
+func (n News) Last(count int) (string, error) {
+	if count <= 0 || count > n.numArticles {
+		count = n.numArticles
+	}
+	reqURL := fmt.Sprintf("%s/v1/news/last/%d", n.newsAPI, count)
 	log.Printf("[DEBUG] request %s", reqURL)
 
 	req, err := makeHTTPRequest(reqURL)
 	if err != nil {
-		log.Printf("[WARN] failed to make request %s, error=%v", reqURL, err)
-		return Response{}
+		return "", fmt.Errorf("failed to make request %s: %w", reqURL, err)
 	}
 
 	resp, err := n.client.Do(req)
 	if err != nil {
-		log.Printf("[WARN] failed to send request %s, error=%v", reqURL, err)
-		return Response{}
+		return "", fmt.Errorf("failed to send request %s: %w", reqURL, err)
 	}
 	defer resp.Body.Close() // nolint
 
 	articles := []newsArticle{}
 	if err = json.NewDecoder(resp.Body).Decode(&articles); err != nil {
-		log.Printf("[WARN] failed to parse response, error %v", err)
-		return Response{}
+		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
 
 	lines := make([]string, 0, len(articles))
@@ -67,10 +80,7 @@ func (n News) OnMessage(msg Message) (response Response) {
 		}
 		lines = append(lines, fmt.Sprintf("- [%s](%s) %s", a.Title, a.Link, a.Ts.Format("2006-01-02")))
 	}
-	return Response{
-		Text: strings.Join(lines, "\n") + "\n- [все новости и темы](https://news.radio-t.com)",
-		Send: true,
-	}
+	return strings.Join(lines, "\n"), nil
 }
 
 // ReactOn keys
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/radio-t/super-bot/app/bot/mocks"
@@ -70,3 +71,22 @@ func TestNewsBot_ReactionOnUnexpectedMessage(t *testing.T) {
 	b := NewNews(mockHTTP, "", 5)
 	require.Equal(t, Response{}, b.OnMessage(Message{Text: "unexpected"}))
 }
+
+func TestNewsBot_Last(t *testing.T) {
+	mockHTTP := &mocks.HTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		return &http.Response{Body: io.NopCloser(bytes.NewReader([]byte(`[{"title":"title","link":"link"}]`)))}, nil
+	}}
+	b := NewNews(mockHTTP, "http://example.com", 5)
+
+	res, err := b.Last(2)
+	require.NoError(t, err)
+	assert.Equal(t, "- [title](link) 0001-01-01", res)
+	res, err = b.Last(10)
+	require.NoError(t, err)
+	assert.Equal(t, "- [title](link) 0001-01-01", res)
+
+	calls := mockHTTP.DoCalls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, "http://example.com/v1/news/last/2", calls[0].Req.URL.String())
+	assert.Equal(t, "http://example.com/v1/news/last/5", calls[1].Req.URL.String(), "limited by max articles")
+}
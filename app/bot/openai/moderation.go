@@ -0,0 +1,165 @@
+package openai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/radio-t/super-bot/app/homoglyph"
+)
+
+//go:generate moq --out mocks/moderator.go --pkg mocks --skip-ensure . moderator:Moderator
+
+// moderator is a moderation endpoint of the API, implemented by OpenAI client
+type moderator interface {
+	Moderations(ctx context.Context, request openai.ModerationRequest) (openai.ModerationResponse, error)
+}
+
+// ModerationParams defines checks of AI responses made before they are sent to the chat
+type ModerationParams struct {
+	Blocklist []string // words and phrases not allowed in responses, matched as whole words with lookalikes of other alphabets
+	MaxLength int      // max response length in symbols, 0 means no limit
+	Endpoint  bool     // check responses with moderation endpoint of the API
+	Retry     bool     // retry rejected response once with stricter system prompt, otherwise stay silent
+}
+
+// strictSysPrompt added to system prompt on retry of rejected response
+const strictSysPrompt = "Your previous answer was rejected by moderation. Answer briefly and politely, " +
+	"without rude or offensive words and bot commands like wtf!, don't make personal remarks about chat members."
+
+// moderation checks responses with the blocklist, length limit and moderation endpoint
+type moderation struct {
+	ModerationParams
+	blocklist map[string]string // skeleton -> blocked word
+	endpoint  moderator
+}
+
+func newModeration(params ModerationParams, endpoint moderator) *moderation {
+	res := &moderation{ModerationParams: params, blocklist: map[string]string{}}
+	for _, w := range params.Blocklist {
+		if w = strings.TrimSpace(w); w != "" {
+			res.blocklist[homoglyph.Skeleton(w)] = w
+		}
+	}
+	if params.Endpoint {
+		res.endpoint = endpoint
+	}
+	return res
+}
+
+// check returns reason of rejection, empty if the response is fine. Failed moderation endpoint doesn't reject.
+func (m *moderation) check(text string) (reason string, err error) {
+	if m.MaxLength > 0 && len([]rune(text)) > m.MaxLength {
+		return fmt.Sprintf("too long, %d symbols", len([]rune(text))), nil
+	}
+
+	skeleton := homoglyph.Skeleton(text)
+	for sk, w := range m.blocklist {
+		if containsWord(skeleton, sk) {
+			return fmt.Sprintf("blocked %q", w), nil
+		}
+	}
+
+	if m.endpoint == nil {
+		return "", nil
+	}
+	resp, err := m.endpoint.Moderations(context.Background(), openai.ModerationRequest{Input: text})
+	if err != nil {
+		return "", fmt.Errorf("can't moderate response: %w", err)
+	}
+	for _, r := range resp.Results {
+		if r.Flagged {
+			return "flagged by moderation: " + flaggedCategories(r.Categories), nil
+		}
+	}
+	return "", nil
+}
+
+// containsWord reports whether word is within s as a whole word, not a part of another one,
+// like "ass" in "pass the ass" but not in "class"
+func containsWord(s, word string) bool {
+	for from := 0; from < len(s); {
+		i := strings.Index(s[from:], word)
+		if i < 0 {
+			return false
+		}
+		start, end := from+i, from+i+len(word)
+		before, _ := utf8.DecodeLastRuneInString(s[:start])
+		after, _ := utf8.DecodeRuneInString(s[end:])
+		first, _ := utf8.DecodeRuneInString(word)
+		last, _ := utf8.DecodeLastRuneInString(word)
+		startsWord := start == 0 || !isWordRune(first) || !isWordRune(before)
+		endsWord := end == len(s) || !isWordRune(last) || !isWordRune(after)
+		if startsWord && endsWord {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(s[start:])
+		from = start + size
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// flaggedCategories returns names of flagged categories, like "harassment, hate"
+func flaggedCategories(c openai.ResultCategories) string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	categories := map[string]bool{}
+	if err := json.Unmarshal(data, &categories); err != nil {
+		return ""
+	}
+	res := []string{}
+	for name, flagged := range categories {
+		if flagged {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return strings.Join(res, ", ")
+}
+
+// strictMessages returns copy of messages with stricter system prompt
+func strictMessages(messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	res := append([]openai.ChatCompletionMessage{}, messages...)
+	if len(res) > 0 && res[0].Role == openai.ChatMessageRoleSystem {
+		res[0].Content += "\n" + strictSysPrompt
+		return res
+	}
+	return append([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: strictSysPrompt}}, res...)
+}
+
+// ReadBlocklist reads blocked words and phrases from the file, a line per entry. Empty lines and # comments skipped.
+func ReadBlocklist(path string) ([]string, error) {
+	fh, err := os.Open(path) // nolint
+	if err != nil {
+		return nil, fmt.Errorf("can't open blocklist %s: %w", path, err)
+	}
+	defer fh.Close() // nolint
+
+	res := []string{}
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		res = append(res, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("can't read blocklist %s: %w", path, err)
+	}
+	return res, nil
+}
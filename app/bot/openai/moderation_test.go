@@ -0,0 +1,85 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/openai/mocks"
+)
+
+func TestModeration_check(t *testing.T) {
+	endpoint := &mocks.Moderator{ModerationsFunc: func(ctx context.Context, r ai.ModerationRequest) (ai.ModerationResponse, error) {
+		switch r.Input {
+		case "flagged":
+			return ai.ModerationResponse{Results: []ai.Result{{Flagged: true,
+				Categories: ai.ResultCategories{Harassment: true, Hate: true}}}}, nil
+		case "error":
+			return ai.ModerationResponse{}, errors.New("failed")
+		}
+		return ai.ModerationResponse{Results: []ai.Result{{}}}, nil
+	}}
+	m := newModeration(ModerationParams{Blocklist: []string{"казино", " ", "wtf!", "ass"}, MaxLength: 20, Endpoint: true}, endpoint)
+
+	tbl := []struct {
+		text   string
+		reason string
+		err    bool
+	}{
+		{"всё хорошо", "", false},
+		{"лучшее кaзинo в городе", "too long, 22 symbols", false},
+		{"играй в кaзинo", `blocked "казино"`, false}, // latin "a" and "o"
+		{"скажи WTF!", `blocked "wtf!"`, false},
+		{"ass!", `blocked "ass"`, false},
+		{"first class", "", false}, // not a whole word
+		{"казиноград", "", false},
+		{"flagged", "flagged by moderation: harassment, hate", false},
+		{"error", "", true},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.text, func(t *testing.T) {
+			reason, err := m.check(tt.text)
+			assert.Equal(t, tt.reason, reason)
+			assert.Equal(t, tt.err, err != nil)
+		})
+	}
+	assert.Len(t, endpoint.ModerationsCalls(), 5, "endpoint called for texts passed other checks only")
+
+	m = newModeration(ModerationParams{}, endpoint)
+	reason, err := m.check("flagged")
+	require.NoError(t, err)
+	assert.Equal(t, "", reason, "endpoint not enabled")
+	assert.Len(t, endpoint.ModerationsCalls(), 5)
+}
+
+func TestStrictMessages(t *testing.T) {
+	messages := []ai.ChatCompletionMessage{
+		{Role: ai.ChatMessageRoleSystem, Content: "system"},
+		{Role: ai.ChatMessageRoleUser, Content: "question"},
+	}
+	res := strictMessages(messages)
+	assert.Equal(t, "system\n"+strictSysPrompt, res[0].Content)
+	assert.Equal(t, messages[1], res[1])
+	assert.Equal(t, "system", messages[0].Content, "original not changed")
+
+	res = strictMessages(messages[1:])
+	require.Len(t, res, 2)
+	assert.Equal(t, ai.ChatCompletionMessage{Role: ai.ChatMessageRoleSystem, Content: strictSysPrompt}, res[0])
+}
+
+func TestReadBlocklist(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(fname, []byte("# words\nказино\n\n  плохое слово \n"), 0o600))
+	res, err := ReadBlocklist(fname)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"казино", "плохое слово"}, res)
+
+	_, err = ReadBlocklist(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
@@ -2,152 +2,200 @@ package openai
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"net/http"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
-	tokenizer "github.com/sandwich-go/gpt3-encoder"
 	"github.com/sashabaranov/go-openai"
 
 	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/reporter"
 )
 
-//go:generate moq --out mocks/openai_client.go --pkg mocks --skip-ensure . openAIClient:OpenAIClient
-
-// openAIClient is interface for OpenAI client with the possibility to mock it
-type openAIClient interface {
-	CreateChatCompletion(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
-}
-
 // Params contains parameters for OpenAI bot
 type Params struct {
 	AuthToken string
+	BaseURL   string // OpenAI-compatible API, OpenAI if empty
+	// Model for chat requests, DefaultModel if empty, and for summaries, same as Model if empty
+	Model        string
+	SummaryModel string
+	// https://platform.openai.com/docs/api-reference/chat/create#chat-create-temperature
+	Temperature float32 // 0 means default of the model
+	TopP        float32 // 0 means default of the model
 	// https://platform.openai.com/docs/api-reference/chat/create#chat/create-max_tokens
 	MaxTokensResponse int // Hard limit for the number of tokens in the response
 	// The OpenAI has a limit for the number of tokens in the request + response (4097)
-	MaxTokensRequest        int // Max request length in tokens
+	MaxTokensRequest        int // Max request length in tokens, system prompt and history included, the oldest history dropped first
 	MaxSymbolsRequest       int // Fallback: Max request length in symbols, if tokenizer was failed
 	Prompt                  string
-	EnableAutoResponse      bool
+	EnableAutoResponse      bool // probability based answers with history, see HistoryReplyProbability and RandomReplyProbability
 	HistorySize             int
-	HistoryReplyProbability int // Percentage of the probability to reply with history
+	HistoryReplyProbability int                      // Percentage of the probability to reply with history to a question
+	RandomReplyProbability  int                      // Percentage of the probability to reply with history to other messages
+	Live                    func(now time.Time) bool // optional, probability based answers are quiet while it returns true
+	ThreadTTL               time.Duration            // How long replies to bot's answers continue the conversation, 0 disables
+	Commands                func() []string          // optional, keys of all bots, replies in thread with them are not for the bot
+	Usage                   *Usage                   // optional, records tokens spent and checks daily budgets
+	// AddressedResponse enables answers with history to messages addressed to the bot: mentions of BotUsername,
+	// replies to bot's AI answers and BotNames in the text. Independent of EnableAutoResponse.
+	AddressedResponse bool
+	BotUsername       string   // without @
+	BotNames          []string // names of the bot in the text, like "бот", case-insensitive whole words
+	// Images, if set, enables chat! about photos, in a caption or as a reply to a photo. The model should support vision.
+	Images        reporter.FileRecipient
+	MaxImageSize  int64         // in bytes, larger images refused, 0 means no limit
+	ImageCooldown time.Duration // min interval between requests with images per user, superusers are not limited
+	// Tools the model may call answering chat! requests, like schedule of the show
+	Tools         []Tool
+	MaxToolRounds int              // max rounds of tool calls per request, then the model has to answer. 0 disables tools
+	Moderation    ModerationParams // checks of chat! answers and auto-responses, answers to superusers are not checked
+	Prompts       *Prompts         // system prompts and personas, built-in prompts if not set
+}
+
+// imageRequest used for chat! on a photo without any question
+const imageRequest = "Что на картинке?"
+
+// answerTTL is how long replies to bot's answers are addressed to the bot
+const answerTTL = 24 * time.Hour
+
+// chatCommands are prefixes of requests to ChatGPT
+var chatCommands = []string{"chat!", "gpt!", "ai!", "чат!"}
+
+// ErrBudgetExhausted returned if daily token budget is spent
+var ErrBudgetExhausted = errors.New("daily token budget exhausted")
+
+// requestMeta describes request to the API for usage accounting
+type requestMeta struct {
+	model    string
+	feature  string
+	user     bot.User // empty if request is not made by a user
+	tools    bool     // offer tools to the model
+	moderate bool     // check the response, retry or drop it if rejected
 }
 
 // OpenAI bot, returns responses from ChatGPT via OpenAI API
 type OpenAI struct {
-	client openAIClient
+	client Provider
 
 	params    Params
 	superUser bot.SuperUser
 
-	history LimitedMessageHistory
-	rand    func(n int64) int64 // tests may change it
+	history    LimitedMessageHistory
+	threads    *MessageThreads
+	moderation *moderation
+	botNames   *regexp.Regexp      // nil if no names
+	rand       func(n int64) int64 // tests may change it
 
 	nowFn  func() time.Time // for testing
 	lastDT time.Time
+
+	imageLock sync.Mutex
+	lastImage map[int64]time.Time // user id -> time of the last request with image
+
+	answersLock   sync.Mutex
+	pendingAnswer int               // id of the message answered by AI, id of the answer comes with OnSent
+	answers       map[int]time.Time // id of sent AI answer -> time sent, replies to them are addressed to the bot
 }
 
 // NewOpenAI makes a bot for ChatGPT
 func NewOpenAI(params Params, httpClient *http.Client, superUser bot.SuperUser) *OpenAI {
-	log.Printf("[INFO] OpenAI bot with github.com/sashabaranov/go-openai, Prompt=%s, max=%d. Auto response is %v",
-		params.Prompt, params.MaxTokensResponse, params.EnableAutoResponse)
+	if params.Model == "" {
+		params.Model = DefaultModel
+	}
+	if params.SummaryModel == "" {
+		params.SummaryModel = params.Model
+	}
+	log.Printf("[INFO] OpenAI bot with github.com/sashabaranov/go-openai, Model=%s, SummaryModel=%s, BaseURL=%q, "+
+		"Prompt=%s, max=%d. Auto response is %v, addressed response is %v", params.Model, params.SummaryModel, params.BaseURL,
+		params.Prompt, params.MaxTokensResponse, params.EnableAutoResponse, params.AddressedResponse)
 
-	openAIConfig := openai.DefaultConfig(params.AuthToken)
-	openAIConfig.HTTPClient = httpClient
-	client := openai.NewClientWithConfig(openAIConfig)
+	client := NewProvider(params.AuthToken, params.BaseURL, httpClient)
 	history := NewLimitedMessageHistory(params.HistorySize)
+	endpoint, _ := client.(moderator)
+	if params.Prompts == nil {
+		prompts, err := NewPrompts(PromptParams{})
+		if err != nil {
+			log.Printf("[ERROR] invalid built-in prompts, %v", err)
+		}
+		params.Prompts = prompts
+	}
 
-	return &OpenAI{client: client, params: params, superUser: superUser,
-		history: history, rand: rand.Int63n, nowFn: time.Now}
+	return &OpenAI{client: client, params: params, superUser: superUser, history: history,
+		moderation: newModeration(params.Moderation, endpoint),
+		threads:    NewMessageThreads(params.ThreadTTL, params.MaxTokensRequest), rand: rand.Int63n, nowFn: time.Now,
+		lastImage: map[int64]time.Time{}, botNames: botNamesRe(params.BotNames), answers: map[int]time.Time{}}
 }
 
 // OnMessage pass msg to all bots and collects responses
 func (o *OpenAI) OnMessage(msg bot.Message) (response bot.Response) {
-	ok, reqText := o.request(msg.Text)
-	if !ok {
-		if !o.params.EnableAutoResponse || msg.Text == "idle" || len(msg.Text) < 3 {
-			// don't answer on short messages or "idle" command or if auto response is disabled
-			return bot.Response{}
-		}
-
-		// All the non-matching requests processed for the reactions based on the history.
-		// save message to history and answer with ChatGPT if needed
-		o.history.Add(msg)
-
-		answeringToQuestion := false
-		sysPrompt := "This is a chat conversation. "
-
-		if o.shouldAnswerWithHistory(msg) {
-			answeringToQuestion = true
-			sysPrompt = sysPrompt + fmt.Sprintf("You reply with no more than 100 words, your answer should be in the same language as the question. Don't give a real answer to the question, just make something up, something interesting and maybe funny and witty.")
-		} else {
-			if shouldRandomlyReply := o.rand(100) < 10; shouldRandomlyReply {
-				sysPrompt = sysPrompt + fmt.Sprintf("You reply with no more than 100 words, your message should be in the same language as the last message. Say something related to the conversation or ask something to continue the conversation.")
-			} else {
-				return bot.Response{}
-			}
-		}
-
-		if shouldAnswerWithMention := o.rand(100) < 50; answeringToQuestion && shouldAnswerWithMention {
-			rndMsg := o.history.GetRandomMessage()
-			rndUsername := "@" + rndMsg.From.Username
-			if rndUsername == "@" {
-				rndUsername = rndMsg.From.DisplayName
-			}
-			if rndUsername != "" {
-				sysPrompt = sysPrompt + fmt.Sprintf(" Be sure to mention %s in your response, you should ask them a question or just say something to them to continue the conversation.", rndUsername)
-			} // else don't mention anyone
-		}
-
-		log.Printf("[DEBUG] sysPrompt: %q", sysPrompt)
-
-		responseAI, err := o.chatGPTRequestWithHistory(sysPrompt)
-
-		if err != nil {
-			log.Printf("[WARN] failed to make context request to ChatGPT error=%v", err)
-			return bot.Response{}
-		}
-		log.Printf("[DEBUG] OpenAI bot answer with history: %q", responseAI)
+	if strings.EqualFold(strings.TrimSpace(msg.Text), "usage!") {
+		return o.usageReport(msg)
+	}
 
-		responseAIMsg := bot.Message{
-			Text: responseAI,
-		}
-		o.history.Add(responseAIMsg)
+	text := msg.Text
+	if text == "" && msg.Image != nil {
+		text = msg.Image.Caption // chat! in a caption of the photo
+	}
+	ok, reqText := o.request(text)
+	thread, inThread := o.thread(msg)
+	if inThread && !ok && !noise(text) && !o.otherCommand(text) {
+		ok, reqText = true, strings.TrimSpace(text)
+	}
+	if !ok {
+		return o.autoResponse(msg)
+	}
+	if requestImage(msg) != nil && o.params.Images == nil {
+		log.Printf("[INFO] image request from %s refused, images disabled", msg.From.Username)
+		return bot.Response{Text: "картинки я не смотрю", Send: true, ReplyTo: msg.ID}
+	}
 
+	if ok, refusal := o.checkRequest(msg.From); !ok {
 		return bot.Response{
-			Text:    responseAI,
+			Text:    refusal,
 			Send:    true,
 			ReplyTo: msg.ID, // reply to the message
 		}
 	}
 
-	if ok, banMessage := o.checkRequest(msg.From.Username); !ok {
-		return bot.Response{
-			Text:        banMessage,
-			Send:        true,
-			BanInterval: time.Hour,
-			User:        msg.From,
-			ReplyTo:     msg.ID, // reply to the message
+	var imageURL string
+	if img := requestImage(msg); img != nil {
+		var refusal string
+		var err error
+		if imageURL, refusal, err = o.loadImage(msg.From, *img); refusal != "" || err != nil {
+			if err != nil {
+				log.Printf("[WARN] failed to load image %s, error=%v", img.FileID, err)
+				return bot.Response{}
+			}
+			return bot.Response{Text: refusal, Send: true, ReplyTo: msg.ID}
+		}
+		if reqText == "" {
+			reqText = imageRequest
 		}
 	}
 
-	responseAI, err := o.chatGPTRequest(reqText, o.params.Prompt, "You answer with no more than 100 words")
+	sysPrompt := o.sysPrompt(chatCommand(text), PromptData{User: usageUserName(msg.From)})
+	var responseAI string
+	var err error
+	if inThread || imageURL != "" {
+		responseAI, err = o.chatGPTRequestInThread(thread, msg, sysPrompt, reqText, imageURL)
+	} else {
+		meta := requestMeta{model: o.params.Model, feature: FeatureChat, user: msg.From, tools: true, moderate: true}
+		responseAI, err = o.chatGPTRequest(meta, reqText, o.params.Prompt, sysPrompt)
+	}
 	if err != nil {
 		log.Printf("[WARN] failed to make request to ChatGPT '%s', error=%v", reqText, err)
 		return bot.Response{}
 	}
-
-	if ok, banMessage := o.checkResponseAI(msg.From.Username); !ok {
-		return bot.Response{
-			Text:        banMessage,
-			Send:        true,
-			BanInterval: time.Hour,
-			User:        msg.From,
-			ReplyTo:     msg.ID, // reply to the message
-		}
+	if responseAI == "" { // rejected by moderation
+		return bot.Response{}
 	}
 
 	if !o.superUser.IsSuper(msg.From.Username) {
@@ -159,9 +207,13 @@ func (o *OpenAI) OnMessage(msg bot.Message) (response bot.Response) {
 		Text: responseAI,
 	}
 	o.history.Add(responseAIMsg)
+	if o.params.ThreadTTL > 0 {
+		o.threads.Add(msg.ReplyTo.ID, msg, reqText, responseAI)
+	}
 
 	log.Printf("[DEBUG] next request to ChatGPT can be made after %s, in %d minutes",
 		o.lastDT.Add(30*time.Minute), int(30-time.Since(o.lastDT).Minutes()))
+	o.answered(msg.ID)
 	return bot.Response{
 		Text:    responseAI,
 		Send:    true,
@@ -169,87 +221,356 @@ func (o *OpenAI) OnMessage(msg bot.Message) (response bot.Response) {
 	}
 }
 
-func (o *OpenAI) request(text string) (react bool, reqText string) {
-	textLowerCase := strings.ToLower(text)
-	for _, prefix := range o.ReactOn() {
-		if strings.HasPrefix(textLowerCase, prefix) {
-			return true, strings.TrimSpace(text[len(prefix):])
+// OnSent links bot's answer to the conversation thread, so replies to the answer continue it,
+// and remembers the answer, so replies to it are addressed to the bot
+func (o *OpenAI) OnSent(msg bot.Message, sentID int) {
+	if o.threads != nil {
+		o.threads.Sent(msg.ID, sentID)
+	}
+
+	o.answersLock.Lock()
+	defer o.answersLock.Unlock()
+	if o.pendingAnswer == 0 || o.pendingAnswer != msg.ID {
+		return
+	}
+	o.pendingAnswer = 0
+	now := o.nowFn()
+	for id, ts := range o.answers {
+		if now.Sub(ts) > answerTTL {
+			delete(o.answers, id)
 		}
 	}
-	return false, ""
+	o.answers[sentID] = now
 }
 
-func (o *OpenAI) checkRequest(username string) (ok bool, banMessage string) {
-	if o.superUser.IsSuper(username) {
-		return true, ""
+// answered marks the message as answered by AI, id of the answer is remembered by OnSent
+func (o *OpenAI) answered(msgID int) {
+	o.answersLock.Lock()
+	o.pendingAnswer = msgID
+	o.answersLock.Unlock()
+}
+
+// isAnswer checks if the message is AI answer of the bot sent recently
+func (o *OpenAI) isAnswer(msgID int) bool {
+	o.answersLock.Lock()
+	defer o.answersLock.Unlock()
+	ts, found := o.answers[msgID]
+	return found && o.nowFn().Sub(ts) <= answerTTL
+}
+
+// autoResponse answers with history the messages addressed to the bot, if AddressedResponse enabled,
+// and some of other messages, if EnableAutoResponse enabled. Only addressed messages answered with reply.
+func (o *OpenAI) autoResponse(msg bot.Message) bot.Response {
+	addressed := o.params.AddressedResponse && o.addressed(msg)
+	if !addressed && !o.params.EnableAutoResponse || noise(msg.Text) {
+		// don't answer on short messages or "idle" command or if auto response is disabled
+		return bot.Response{}
 	}
 
-	if o.nowFn().Sub(o.lastDT) < 10*time.Second {
-		log.Printf("[WARN] OpenAI bot is too busy, last request was %s ago, %s banned", time.Since(o.lastDT), username)
-		reason := fmt.Sprintf("Слишком много запросов, следующий запрос можно будет сделать через %d секунд.",
-			int(10-time.Since(o.lastDT).Seconds()))
+	// All the non-matching requests processed for the reactions based on the history.
+	// save message to history and answer with ChatGPT if needed
+	o.history.Add(msg)
 
-		return false, fmt.Sprintf("%s\n@%s, я устал, я с тобой больше не разговариваю 😜.", reason, username)
+	promptData, user, replyTo := PromptData{}, bot.User{}, 0
+	switch {
+	case addressed:
+		if ok, _ := o.checkRequest(msg.From); !ok {
+			return bot.Response{} // refusal logged, no reason to answer it to the message not for the bot
+		}
+		promptData.Addressed, promptData.User = true, usageUserName(msg.From)
+		user, replyTo = msg.From, msg.ID
+	case o.params.Live != nil && o.params.Live(o.nowFn()):
+		return bot.Response{} // quiet during live broadcast
+	case o.shouldAnswerWithHistory(msg):
+		promptData.Question = true
+		if shouldAnswerWithMention := o.rand(100) < 50; shouldAnswerWithMention {
+			rndMsg := o.history.GetRandomMessage()
+			rndUsername := "@" + rndMsg.From.Username
+			if rndUsername == "@" {
+				rndUsername = rndMsg.From.DisplayName
+			}
+			promptData.Mention = rndUsername // empty if no one to mention
+		}
+	case !o.shouldRandomlyReply():
+		return bot.Response{}
 	}
+	sysPrompt := o.sysPrompt(PromptAuto, promptData)
 
-	return true, ""
+	if o.params.Usage != nil {
+		if overall, _ := o.params.Usage.Exhausted(o.nowFn(), 0); overall {
+			log.Printf("[DEBUG] daily token budget exhausted, no auto response")
+			return bot.Response{}
+		}
+	}
+
+	log.Printf("[DEBUG] sysPrompt: %q", sysPrompt)
+
+	responseAI, err := o.chatGPTRequestWithHistory(user, sysPrompt)
+
+	if err != nil {
+		log.Printf("[WARN] failed to make context request to ChatGPT error=%v", err)
+		return bot.Response{}
+	}
+	if responseAI == "" { // rejected by moderation
+		return bot.Response{}
+	}
+	log.Printf("[DEBUG] OpenAI bot answer with history: %q", responseAI)
+
+	if addressed && !o.superUser.IsSuper(msg.From.Username) {
+		o.lastDT = o.nowFn()
+	}
+	responseAIMsg := bot.Message{
+		Text: responseAI,
+	}
+	o.history.Add(responseAIMsg)
+	o.answered(msg.ID)
+
+	return bot.Response{
+		Text:    responseAI,
+		Send:    true,
+		ReplyTo: replyTo,
+	}
 }
 
-func (o *OpenAI) checkResponseAI(username string) (ok bool, banMessage string) {
-	if o.superUser.IsSuper(username) {
-		return true, ""
+// noise returns true for the text not worth an answer, like short "+1" or "idle" command
+func noise(text string) bool {
+	text = strings.TrimSpace(text)
+	return text == "idle" || len(text) < 3
+}
+
+// otherCommand returns true if the text starts with a key of another bot, like "quote!" or "warn!"
+func (o *OpenAI) otherCommand(text string) bool {
+	if o.params.Commands == nil {
+		return false
 	}
+	text = strings.ToLower(strings.TrimSpace(text))
+	for _, key := range o.params.Commands() {
+		if key = strings.ToLower(key); key != "" && strings.HasPrefix(text, key) {
+			return true
+		}
+	}
+	return false
+}
 
-	return true, ""
+// addressed checks if the message is addressed to the bot: mentions bot's username, replies to bot's AI answer
+// or calls the bot by name. Commands of other bots are not addressed to it, even with the name.
+func (o *OpenAI) addressed(msg bot.Message) bool {
+	if o.otherCommand(msg.Text) {
+		return false
+	}
+	if msg.ReplyTo.ID != 0 && o.isAnswer(msg.ReplyTo.ID) {
+		return true
+	}
+	if username := o.params.BotUsername; username != "" &&
+		strings.Contains(strings.ToLower(msg.Text), "@"+strings.ToLower(username)) {
+		return true
+	}
+	return o.botNames != nil && o.botNames.MatchString(msg.Text)
 }
 
-// Help returns help message
-func (o *OpenAI) Help() string {
-	return bot.GenHelpMsg(o.ReactOn(), "Спросите что-нибудь у ChatGPT")
-}
-
-func (o *OpenAI) chatGPTRequest(request, userPrompt, sysPrompt string) (response string, err error) {
-	// Reduce the request size with tokenizer and fallback to default reducer if it fails
-	// The API supports 4097 tokens ~16000 characters (<=4 per token) for request + result together
-	// The response is limited to 1000 tokens and OpenAI always reserved it for the result
-	// So the max length of the request should be 3000 tokens or ~12000 characters
-	reduceRequest := func(text string) (result string) {
-		// defaultReducer is a fallback if tokenizer fails
-		defaultReducer := func(text string) (result string) {
-			if len(text) <= o.params.MaxSymbolsRequest {
-				return text
-			}
+// botNamesRe makes case-insensitive regexp matching any of the names as a whole word, nil if no names
+func botNamesRe(names []string) *regexp.Regexp {
+	quoted := []string{}
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			quoted = append(quoted, regexp.QuoteMeta(name))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	return regexp.MustCompile(`(?i)(^|[^\p{L}\p{N}_])(` + strings.Join(quoted, "|") + `)($|[^\p{L}\p{N}_])`)
+}
+
+// requestImage returns photo of the request, or the photo the request replies to, nil if none
+func requestImage(msg bot.Message) *bot.Image {
+	if msg.Image != nil {
+		return msg.Image
+	}
+	return msg.ReplyTo.Image
+}
 
-			return text[:o.params.MaxSymbolsRequest]
+// loadImage checks per-user cooldown and size of the image and returns it as data URL for the vision request.
+// Returns refusal if the image is not allowed.
+func (o *OpenAI) loadImage(user bot.User, img bot.Image) (dataURL, refusal string, err error) {
+	isSuper := o.superUser.IsSuper(user.Username)
+	o.imageLock.Lock()
+	last, found := o.lastImage[user.ID]
+	o.imageLock.Unlock()
+	if !isSuper && found && o.nowFn().Sub(last) < o.params.ImageCooldown {
+		log.Printf("[INFO] image request from %s refused, last one was at %s", user.Username, last.Format(time.RFC3339))
+		return "", fmt.Sprintf("картинки можно отправлять не чаще раза в %s", bot.HumanizeDuration(o.params.ImageCooldown)), nil
+	}
+
+	body, err := o.params.Images.GetFile(img.FileID)
+	if err != nil {
+		return "", "", fmt.Errorf("can't get file: %w", err)
+	}
+	defer body.Close() // nolint
+
+	var reader io.Reader = body
+	if o.params.MaxImageSize > 0 {
+		reader = io.LimitReader(body, o.params.MaxImageSize+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return "", "", fmt.Errorf("can't read file: %w", err)
+	}
+	if o.params.MaxImageSize > 0 && int64(len(data)) > o.params.MaxImageSize {
+		log.Printf("[INFO] image %s from %s is larger than %d bytes, refused", img.FileID, user.Username, o.params.MaxImageSize)
+		return "", "картинка слишком большая", nil
+	}
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", "", fmt.Errorf("file %s is not an image, %s", img.FileID, contentType)
+	}
+
+	if !isSuper {
+		o.imageLock.Lock()
+		o.lastImage[user.ID] = o.nowFn()
+		o.imageLock.Unlock()
+	}
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data), "", nil
+}
+
+// thread returns conversation the message replies to, if any
+func (o *OpenAI) thread(msg bot.Message) ([]openai.ChatCompletionMessage, bool) {
+	if o.params.ThreadTTL <= 0 || msg.ReplyTo.ID == 0 || o.threads == nil {
+		return nil, false
+	}
+	return o.threads.Get(msg.ReplyTo.ID)
+}
+
+// chatCommand returns chat command the text starts with, chat! for replies in thread without command
+func chatCommand(text string) string {
+	textLowerCase := strings.ToLower(text)
+	for _, prefix := range chatCommands {
+		if strings.HasPrefix(textLowerCase, prefix) {
+			return prefix
 		}
+	}
+	return chatCommands[0]
+}
 
-		encoder, err := tokenizer.NewEncoder()
-		if err != nil {
-			log.Printf("[WARN] Can't init tokenizer: %v", err)
-			return defaultReducer(text)
+// sysPrompt renders system prompt of the persona selected for the command, built-in prompt used if rendering failed
+func (o *OpenAI) sysPrompt(command string, data PromptData) string {
+	if o.params.Prompts != nil {
+		res, err := o.params.Prompts.Render(command, data)
+		if err == nil {
+			return res
 		}
+		log.Printf("[WARN] can't render prompt for %s, built-in used: %v", command, err)
+	}
+	if data.Language == "" {
+		data.Language = "russian"
+	}
+	name, ok := defaultPersonas[command]
+	if !ok {
+		name = "chat"
+	}
+	res, err := render(builtinPrompts, name, data)
+	if err != nil {
+		log.Printf("[ERROR] can't render built-in prompt %s, %v", name, err)
+	}
+	return res
+}
 
-		tokens, err := encoder.Encode(text)
-		if err != nil {
-			log.Printf("[WARN] Can't encode request: %v", err)
-			return defaultReducer(text)
+func (o *OpenAI) request(text string) (react bool, reqText string) {
+	textLowerCase := strings.ToLower(text)
+	for _, prefix := range chatCommands {
+		if strings.HasPrefix(textLowerCase, prefix) {
+			return true, strings.TrimSpace(text[len(prefix):])
 		}
+	}
+	return false, ""
+}
 
-		if len(tokens) <= o.params.MaxTokensRequest {
-			return text
+// checkRequest checks rate limit and daily budgets, returns polite refusal if request is not allowed.
+// Superusers are not limited by rate and their own budget.
+func (o *OpenAI) checkRequest(user bot.User) (ok bool, refusal string) {
+	isSuper := o.superUser.IsSuper(user.Username)
+	if o.params.Usage != nil {
+		userID := user.ID
+		if isSuper {
+			userID = 0 // no personal budget for superusers
+		}
+		overall, byUser := o.params.Usage.Exhausted(o.nowFn(), userID)
+		if overall {
+			log.Printf("[INFO] daily token budget exhausted, request from %s refused", user.Username)
+			return false, "На сегодня лимит запросов к ChatGPT исчерпан, приходите завтра 🙏"
 		}
+		if byUser {
+			log.Printf("[INFO] daily token budget of %s exhausted, request refused", user.Username)
+			return false, fmt.Sprintf("%s, на сегодня ваш лимит запросов к ChatGPT исчерпан, приходите завтра 🙏",
+				bot.EscapeMarkDownV1Text(usageUserName(user)))
+		}
+	}
+
+	if isSuper {
+		return true, ""
+	}
 
-		return encoder.Decode(tokens[:o.params.MaxTokensRequest])
+	if since := o.nowFn().Sub(o.lastDT); since < 10*time.Second {
+		log.Printf("[WARN] OpenAI bot is too busy, last request was %s ago, %s refused", since, user.Username)
+		return false, fmt.Sprintf("Слишком много запросов, следующий запрос можно будет сделать через %d секунд.",
+			int((10*time.Second-since).Seconds())+1)
 	}
 
+	return true, ""
+}
+
+// checkResponseAI checks the response before it is sent, returns reason of rejection. Answers to superusers are not checked.
+func (o *OpenAI) checkResponseAI(username, responseAI string) (ok bool, reason string) {
+	if username != "" && o.superUser.IsSuper(username) {
+		return true, ""
+	}
+	reason, err := o.moderation.check(responseAI)
+	if err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+	return reason == "", reason
+}
+
+// moderatedRequest makes the request and checks the response if meta.moderate set. Rejected response is retried once
+// with stricter system prompt if Moderation.Retry set. Empty response returned if rejected, so the bot stays silent.
+func (o *OpenAI) moderatedRequest(meta requestMeta, messages []openai.ChatCompletionMessage) (string, error) {
+	resp, err := o.chatGPTRequestInternal(meta, messages)
+	if err != nil || !meta.moderate {
+		return resp, err
+	}
+	ok, reason := o.checkResponseAI(meta.user.Username, resp)
+	if ok {
+		return resp, nil
+	}
+	log.Printf("[WARN] OpenAI response rejected, %s: %q", reason, resp)
+	if !o.params.Moderation.Retry {
+		return "", nil
+	}
+
+	if resp, err = o.chatGPTRequestInternal(meta, strictMessages(messages)); err != nil {
+		return "", err
+	}
+	if ok, reason = o.checkResponseAI(meta.user.Username, resp); !ok {
+		log.Printf("[WARN] OpenAI response rejected on retry, %s: %q", reason, resp)
+		return "", nil
+	}
+	return resp, nil
+}
+
+// Help returns help message
+func (o *OpenAI) Help() string {
+	return bot.GenHelpMsg(chatCommands, "Спросите что-нибудь у ChatGPT") +
+		bot.GenHelpMsg([]string{"usage!"}, "расход токенов OpenAI за сегодня (только для админов)")
+}
+
+func (o *OpenAI) chatGPTRequest(meta requestMeta, request, userPrompt, sysPrompt string) (response string, err error) {
 	r := request
 	if userPrompt != "" {
 		r = userPrompt + ".\n" + request
 	}
 
-	r = reduceRequest(r)
-
-	return o.chatGPTRequestInternal([]openai.ChatCompletionMessage{
+	// system prompt and request together limited by MaxTokensRequest, request is cut if too long
+	return o.moderatedRequest(meta, o.fit([]openai.ChatCompletionMessage{
 		{
 			Role:    openai.ChatMessageRoleSystem,
 			Content: sysPrompt,
@@ -258,19 +579,64 @@ func (o *OpenAI) chatGPTRequest(request, userPrompt, sysPrompt string) (response
 			Role:    openai.ChatMessageRoleUser,
 			Content: r,
 		},
-	})
+	}))
+}
+
+// fit drops the oldest history messages and cuts the last one to fit into MaxTokensRequest.
+// The API limits request + response together, so MaxTokensRequest + MaxTokensResponse should fit the context window.
+func (o *OpenAI) fit(messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	return fitMessages(messages, o.params.MaxTokensRequest, o.params.MaxSymbolsRequest)
+}
+
+// chatGPTRequestInThread continues the conversation, with bot's answers as assistant messages
+// and user's messages prefixed with author's name. Thread may be empty for a new conversation.
+// If imageURL is set, the image is sent along with the request, in low detail to save tokens.
+func (o *OpenAI) chatGPTRequestInThread(thread []openai.ChatCompletionMessage, msg bot.Message, sysPrompt, request, imageURL string) (string, error) {
+	sysPrompt += "\nMessages of users are prefixed with their names."
+	if o.params.Prompt != "" {
+		sysPrompt += "\n" + o.params.Prompt
+	}
+	messages := make([]openai.ChatCompletionMessage, 0, len(thread)+2)
+	messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: sysPrompt})
+	messages = append(messages, thread...)
+	userMsg := threadUserMessage(msg, request)
+	if imageURL != "" {
+		userMsg.MultiContent = []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: userMsg.Content},
+			{Type: openai.ChatMessagePartTypeImageURL,
+				ImageURL: &openai.ChatMessageImageURL{URL: imageURL, Detail: openai.ImageURLDetailLow}},
+		}
+		userMsg.Content = ""
+	}
+	messages = append(messages, userMsg)
+	meta := requestMeta{model: o.params.Model, feature: FeatureChat, user: msg.From, tools: true, moderate: true}
+	return o.moderatedRequest(meta, o.fit(messages))
 }
 
+// shouldAnswerWithHistory checks if the question should be answered, history should be full to have enough context
 func (o *OpenAI) shouldAnswerWithHistory(msg bot.Message) bool {
 	if msg.Text != "" && !strings.Contains(msg.Text, "?") {
 		return false
 	}
+	if len(o.history.messages) < o.params.HistorySize {
+		return false
+	}
 
 	// by default 10% chance to answer with ChatGPT for question
 	return o.rand(100) < int64(o.params.HistoryReplyProbability)
 }
 
-func (o *OpenAI) chatGPTRequestWithHistory(sysPrompt string) (response string, err error) {
+// shouldRandomlyReply checks if other message should be answered, history should be full to have enough context
+func (o *OpenAI) shouldRandomlyReply() bool {
+	if len(o.history.messages) < o.params.HistorySize {
+		return false
+	}
+	return o.rand(100) < int64(o.params.RandomReplyProbability)
+}
+
+// chatGPTRequestWithHistory makes request with the chat history, bot's own answers sent as assistant messages
+// and user's messages prefixed with author's name. User is empty for answers not addressed to the bot.
+func (o *OpenAI) chatGPTRequestWithHistory(user bot.User, sysPrompt string) (response string, err error) {
 	messages := make([]openai.ChatCompletionMessage, 0, len(o.history.messages)+1)
 
 	messages = append(messages, openai.ChatCompletionMessage{
@@ -279,51 +645,105 @@ func (o *OpenAI) chatGPTRequestWithHistory(sysPrompt string) (response string, e
 	})
 
 	for _, message := range o.history.messages {
-		messages = append(messages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleUser,
-			Content: message.Text,
-		})
+		if message.ID == 0 && message.From == (bot.User{}) { // bot's answers added to history without id and author
+			messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: message.Text})
+			continue
+		}
+		messages = append(messages, threadUserMessage(message, message.Text))
 	}
 
-	return o.chatGPTRequestInternal(messages)
+	return o.moderatedRequest(requestMeta{model: o.params.Model, feature: FeatureAuto, user: user, moderate: true}, o.fit(messages))
 }
 
-func (o *OpenAI) chatGPTRequestInternal(messages []openai.ChatCompletionMessage) (response string, err error) {
+// chatGPTRequestInternal makes the request and records usage. If tools offered and the model calls them,
+// results are sent back and the request repeated, up to MaxToolRounds, the last round without tools.
+func (o *OpenAI) chatGPTRequestInternal(meta requestMeta, messages []openai.ChatCompletionMessage) (response string, err error) {
+	for round := 0; ; round++ {
+		req := openai.ChatCompletionRequest{
+			Model:       meta.model,
+			MaxTokens:   o.params.MaxTokensResponse,
+			Temperature: o.params.Temperature,
+			TopP:        o.params.TopP,
+			Messages:    messages,
+		}
+		if meta.tools && len(o.params.Tools) > 0 && round < o.params.MaxToolRounds {
+			req.Tools = openAITools(o.params.Tools)
+		}
 
-	//log.Printf("[DEBUG] MESSAGES -------->\n %v", messages)
-	//log.Printf("[DEBUG] MESSAGES <--------\n")
+		resp, err := o.client.CreateChatCompletion(context.Background(), req)
+		if err != nil {
+			return "", err
+		}
+		log.Printf("[DEBUG] OpenAI usage, model %s, %s: prompt %d tokens (estimated %d), completion %d tokens, total %d",
+			meta.model, meta.feature, resp.Usage.PromptTokens, messagesTokens(messages), resp.Usage.CompletionTokens,
+			resp.Usage.TotalTokens)
+		if o.params.Usage != nil {
+			rec := UsageRecord{Time: o.nowFn(), User: meta.user, Feature: meta.feature, Model: meta.model,
+				PromptTokens: resp.Usage.PromptTokens, CompletionTokens: resp.Usage.CompletionTokens}
+			if err := o.params.Usage.Add(rec); err != nil {
+				log.Printf("[WARN] %v", err)
+			}
+		}
 
-	resp, err := o.client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model:     "gpt-4o-2024-08-06", //openai.GPT4o,
-			MaxTokens: o.params.MaxTokensResponse,
-			Messages:  messages,
-		},
-	)
+		// OpenAI platform supports to return multiple chat completion choices
+		// but we use only the first one
+		// https://platform.openai.com/docs/api-reference/chat/create#chat/create-n
+		if len(resp.Choices) == 0 {
+			return "", fmt.Errorf("no choices in response")
+		}
 
-	if err != nil {
-		return "", err
-	}
+		answer := resp.Choices[0].Message
+		if len(answer.ToolCalls) == 0 || len(req.Tools) == 0 {
+			return answer.Content, nil
+		}
 
-	// OpenAI platform supports to return multiple chat completion choices
-	// but we use only the first one
-	// https://platform.openai.com/docs/api-reference/chat/create#chat/create-n
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no choices in response")
+		// the model asked for tools, the calls and their results go to the next round
+		messages = append(messages, answer)
+		for _, call := range answer.ToolCalls {
+			messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleTool,
+				ToolCallID: call.ID, Content: callTool(o.params.Tools, call)})
+		}
 	}
-
-	return resp.Choices[0].Message.Content, nil
 }
 
 // Summary returns summary of the text
 func (o *OpenAI) Summary(text string) (response string, err error) {
-	return o.chatGPTRequest(text, "", "Make a short summary, up to 50 words, followed by a list of bullet points. Each bullet point is limited to 50 words, up to 7 in total. All in markdown format and translated to russian:\n")
+	if o.params.Usage != nil {
+		if overall, _ := o.params.Usage.Exhausted(o.nowFn(), 0); overall {
+			return "", ErrBudgetExhausted
+		}
+	}
+	return o.chatGPTRequest(requestMeta{model: o.params.SummaryModel, feature: FeatureSummary}, text, "",
+		o.sysPrompt(PromptSummary, PromptData{}))
+}
+
+// Digest returns a short digest of chat messages with who-said-what, requested by the user.
+// Messages expected as "15:04 Name: text" lines.
+func (o *OpenAI) Digest(user bot.User, text string) (response string, err error) {
+	if o.params.Usage != nil {
+		userID := user.ID
+		if o.superUser.IsSuper(user.Username) {
+			userID = 0 // no personal budget for superusers
+		}
+		if overall, byUser := o.params.Usage.Exhausted(o.nowFn(), userID); overall || byUser {
+			return "", ErrBudgetExhausted
+		}
+	}
+	return o.chatGPTRequest(requestMeta{model: o.params.SummaryModel, feature: FeatureDigest, user: user}, text, "",
+		o.sysPrompt(PromptDigest, PromptData{User: usageUserName(user)}))
 }
 
 // ReactOn keys
 func (o *OpenAI) ReactOn() []string {
-	return []string{"chat!", "gpt!", "ai!", "чат!"}
+	return append(append([]string{}, chatCommands...), "usage!")
+}
+
+// usageReport responds on usage! from superusers with tokens spent today and for the last week
+func (o *OpenAI) usageReport(msg bot.Message) bot.Response {
+	if o.params.Usage == nil || !o.superUser.IsSuper(msg.From.Username) {
+		return bot.Response{}
+	}
+	return bot.Response{Text: o.params.Usage.Report(o.nowFn(), usageDays), Send: true, ReplyTo: msg.ID}
 }
 
 // CreateChatCompletion exposes the underlying openai.CreateChatCompletion method
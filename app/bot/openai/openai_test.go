@@ -1,12 +1,15 @@
 package openai
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -130,12 +133,12 @@ func TestOpenAI_OnMessage_TooManyRequests(t *testing.T) {
 		assert.Equal(t, time.Duration(0), resp.BanInterval)
 	}
 
-	{ // second request, not allowed, too soon
+	{ // second request, not allowed, too soon, refused without ban
 		resp := o.OnMessage(bot.Message{Text: "chat! something", ID: 756})
 		require.True(t, resp.Send)
-		assert.Contains(t, resp.Text, "Слишком много запросов,")
+		assert.Equal(t, "Слишком много запросов, следующий запрос можно будет сделать через 10 секунд.", resp.Text)
 		assert.Equal(t, 756, resp.ReplyTo)
-		assert.Equal(t, time.Hour, resp.BanInterval)
+		assert.Equal(t, time.Duration(0), resp.BanInterval)
 	}
 
 	{ // third request, allowed from super user
@@ -159,15 +162,15 @@ func TestOpenAI_OnMessage_TooManyRequests(t *testing.T) {
 		assert.Equal(t, time.Duration(0), resp.BanInterval)
 	}
 
-	{ // fifth request with wft, not allowed, 62 min after first request
+	{ // fifth request, not allowed, 5 sec after the fourth one, refused without ban
 		o.nowFn = func() time.Time {
-			return time.Now().Add(time.Minute * 162) // 62 min after first request
+			return time.Now().Add(time.Minute*31 + time.Second*5)
 		}
 		resp := o.OnMessage(bot.Message{Text: "chat! что такое wtf", ID: 756})
 		require.True(t, resp.Send)
-		assert.Contains(t, resp.Text, "Вы знаете правила")
+		assert.Contains(t, resp.Text, "Слишком много запросов")
 		assert.Equal(t, 756, resp.ReplyTo)
-		assert.Equal(t, time.Hour, resp.BanInterval)
+		assert.Equal(t, time.Duration(0), resp.BanInterval)
 	}
 
 	{ // sixth request, allowed from user, 63 min after first request
@@ -202,15 +205,18 @@ func TestOpenAI_OnMessage_ResponseWithWTF(t *testing.T) {
 		return false
 	}}
 
-	o := NewOpenAI(getDefaultTestingConfig(), &http.Client{Timeout: 10 * time.Second}, su)
+	config := getDefaultTestingConfig()
+	config.Moderation = ModerationParams{Blocklist: []string{"wtf"}, Retry: true}
+	o := NewOpenAI(config, &http.Client{Timeout: 10 * time.Second}, su)
 	o.client = mockOpenAIClient
 
-	{ // first request by regular User, banned
-		resp := o.OnMessage(bot.Message{Text: "chat! something", ID: 756})
-		require.True(t, resp.Send)
-		assert.Contains(t, resp.Text, "выиграл в лотерею")
-		assert.Equal(t, 756, resp.ReplyTo)
-		assert.Equal(t, time.Hour, resp.BanInterval)
+	{ // first request by regular User, rejected twice, with stricter prompt on retry, no answer and no ban
+		resp := o.OnMessage(bot.Message{Text: "chat! something", ID: 756, From: bot.User{Username: "user"}})
+		assert.Equal(t, bot.Response{}, resp)
+		calls := mockOpenAIClient.CreateChatCompletionCalls()
+		require.Len(t, calls, 2)
+		assert.NotContains(t, calls[0].ChatCompletionRequest.Messages[0].Content, strictSysPrompt)
+		assert.Contains(t, calls[1].ChatCompletionRequest.Messages[0].Content, strictSysPrompt)
 	}
 
 	{ // second request, allowed from super user
@@ -446,3 +452,435 @@ func TestOpenAI_request(t *testing.T) {
 		})
 	}
 }
+
+func TestOpenAI_OnMessage_Thread(t *testing.T) {
+	answers := []string{"first answer", "second answer"}
+	mockOpenAIClient := &mocks.OpenAIClient{
+		CreateChatCompletionFunc: func(ctx context.Context, r ai.ChatCompletionRequest) (ai.ChatCompletionResponse, error) {
+			answer := answers[0]
+			answers = answers[1:]
+			return ai.ChatCompletionResponse{Choices: []ai.ChatCompletionChoice{{Message: ai.ChatCompletionMessage{Content: answer}}}}, nil
+		},
+	}
+	su := &bmocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "super" }}
+
+	config := getDefaultTestingConfig()
+	config.EnableAutoResponse, config.ThreadTTL = false, time.Hour
+	config.Commands = func() []string { return []string{"chat!", "quote!", "warn!"} }
+	o := NewOpenAI(config, &http.Client{Timeout: 10 * time.Second}, su)
+	o.client = mockOpenAIClient
+
+	resp := o.OnMessage(bot.Message{ID: 10, Text: "chat! what is go?", From: bot.User{Username: "super", DisplayName: "Super User"}})
+	assert.Equal(t, "first answer", resp.Text)
+	o.OnSent(bot.Message{ID: 10}, 11)
+
+	for _, text := range []string{"Quote!", "warn! не флуди", "+1", "ok", "idle"} {
+		msg := bot.Message{ID: 12, Text: text, From: bot.User{Username: "super"}}
+		msg.ReplyTo.ID = 11
+		assert.Equal(t, bot.Response{}, o.OnMessage(msg), "command of other bot or noise, %q", text)
+	}
+	assert.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 1)
+
+	msg := bot.Message{ID: 12, Text: "and rust?", From: bot.User{Username: "super", DisplayName: "Super User"}}
+	msg.ReplyTo.ID = 11
+	resp = o.OnMessage(msg)
+	assert.Equal(t, bot.Response{Text: "second answer", Send: true, ReplyTo: 12}, resp)
+
+	calls := mockOpenAIClient.CreateChatCompletionCalls()
+	require.Len(t, calls, 2)
+	messages := calls[1].ChatCompletionRequest.Messages
+	require.Len(t, messages, 4)
+	assert.Equal(t, ai.ChatMessageRoleSystem, messages[0].Role)
+	assert.Equal(t, ai.ChatCompletionMessage{Role: ai.ChatMessageRoleUser, Content: "Super User: what is go?"}, messages[1])
+	assert.Equal(t, ai.ChatCompletionMessage{Role: ai.ChatMessageRoleAssistant, Content: "first answer"}, messages[2])
+	assert.Equal(t, ai.ChatCompletionMessage{Role: ai.ChatMessageRoleUser, Content: "Super User: and rust?"}, messages[3])
+
+	msg = bot.Message{ID: 13, Text: "unrelated reply", From: bot.User{Username: "super"}}
+	msg.ReplyTo.ID = 10 // reply to the request, not to the answer
+	assert.Equal(t, bot.Response{}, o.OnMessage(msg))
+	assert.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 2)
+}
+
+func TestOpenAI_chatGPTRequestWithHistory(t *testing.T) {
+	mockOpenAIClient := &mocks.OpenAIClient{
+		CreateChatCompletionFunc: func(ctx context.Context, r ai.ChatCompletionRequest) (ai.ChatCompletionResponse, error) {
+			return ai.ChatCompletionResponse{Choices: []ai.ChatCompletionChoice{{Message: ai.ChatCompletionMessage{Content: "ok"}}}}, nil
+		},
+	}
+	config := getDefaultTestingConfig()
+	config.HistorySize, config.MaxTokensRequest = 5, 35
+	o := NewOpenAI(config, &http.Client{Timeout: 10 * time.Second}, &bmocks.SuperUser{})
+	o.client = mockOpenAIClient
+
+	o.history.Add(bot.Message{ID: 1, Text: "a very old message that should not fit into the budget at all", From: bot.User{Username: "user1"}})
+	o.history.Add(bot.Message{ID: 2, Text: "how are you?", From: bot.User{Username: "user1", DisplayName: "User One"}})
+	o.history.Add(bot.Message{Text: "fine"})
+	o.history.Add(bot.Message{ID: 3, Text: "and you?", From: bot.User{Username: "user2"}})
+
+	resp, err := o.chatGPTRequestWithHistory(bot.User{}, "system")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+
+	calls := mockOpenAIClient.CreateChatCompletionCalls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, []ai.ChatCompletionMessage{
+		{Role: ai.ChatMessageRoleSystem, Content: "system"},
+		{Role: ai.ChatMessageRoleUser, Content: "User One: how are you?"},
+		{Role: ai.ChatMessageRoleAssistant, Content: "fine"},
+		{Role: ai.ChatMessageRoleUser, Content: "user2: and you?"},
+	}, calls[0].ChatCompletionRequest.Messages)
+}
+
+func TestOpenAI_OnMessage_Usage(t *testing.T) {
+	mockOpenAIClient := &mocks.OpenAIClient{
+		CreateChatCompletionFunc: func(ctx context.Context, r ai.ChatCompletionRequest) (ai.ChatCompletionResponse, error) {
+			return ai.ChatCompletionResponse{Choices: []ai.ChatCompletionChoice{{Message: ai.ChatCompletionMessage{Content: "answer"}}},
+				Usage: ai.Usage{PromptTokens: 60, CompletionTokens: 40, TotalTokens: 100}}, nil
+		},
+	}
+	su := &bmocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "super" }}
+	usage, err := NewUsage("", UsageParams{UserDailyTokens: 100, DailyTokens: 300})
+	require.NoError(t, err)
+
+	config := getDefaultTestingConfig()
+	config.Usage = usage
+	o := NewOpenAI(config, &http.Client{Timeout: 10 * time.Second}, su)
+	o.client = mockOpenAIClient
+	now := time.Date(2024, 5, 4, 12, 0, 0, 0, time.Local)
+	o.nowFn = func() time.Time { return now }
+
+	user := bot.User{ID: 1, Username: "user"}
+	resp := o.OnMessage(bot.Message{ID: 1, Text: "chat! hi", From: user})
+	assert.Equal(t, "answer", resp.Text)
+
+	now = now.Add(time.Minute)
+	resp = o.OnMessage(bot.Message{ID: 2, Text: "chat! hi again", From: user})
+	assert.Equal(t, bot.Response{Text: "@user, на сегодня ваш лимит запросов к ChatGPT исчерпан, приходите завтра 🙏",
+		Send: true, ReplyTo: 2}, resp, "polite refusal, no ban")
+
+	resp = o.OnMessage(bot.Message{ID: 3, Text: "chat! hi", From: bot.User{ID: 2, Username: "super"}})
+	assert.Equal(t, "answer", resp.Text)
+	_, err = o.Summary("some text")
+	require.NoError(t, err)
+
+	resp = o.OnMessage(bot.Message{ID: 4, Text: "chat! hi", From: bot.User{ID: 3, Username: "other"}})
+	assert.Equal(t, "На сегодня лимит запросов к ChatGPT исчерпан, приходите завтра 🙏", resp.Text)
+	_, err = o.Summary("some text")
+	assert.EqualError(t, err, "daily token budget exhausted")
+	assert.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 3)
+
+	assert.Equal(t, bot.Response{}, o.OnMessage(bot.Message{ID: 5, Text: "usage!", From: user}), "superusers only")
+	resp = o.OnMessage(bot.Message{ID: 6, Text: "usage!", From: bot.User{ID: 2, Username: "super"}})
+	assert.Equal(t, "*расход токенов сегодня:* 300, запросов 3, лимит 300\nchat 200, summary 100\n"+
+		"пользователи (лимит 100): @user 100, @super 100\nза 7 дн.: 300, запросов 3\n", resp.Text)
+	assert.Equal(t, 6, resp.ReplyTo)
+}
+
+func TestOpenAI_Digest(t *testing.T) {
+	mockOpenAIClient := &mocks.OpenAIClient{
+		CreateChatCompletionFunc: func(ctx context.Context, r ai.ChatCompletionRequest) (ai.ChatCompletionResponse, error) {
+			return ai.ChatCompletionResponse{Choices: []ai.ChatCompletionChoice{{Message: ai.ChatCompletionMessage{Content: "digest"}}},
+				Usage: ai.Usage{PromptTokens: 80, CompletionTokens: 20}}, nil
+		},
+	}
+	usage, err := NewUsage("", UsageParams{UserDailyTokens: 100})
+	require.NoError(t, err)
+	config := getDefaultTestingConfig()
+	config.Usage, config.SummaryModel = usage, "small-model"
+	o := NewOpenAI(config, &http.Client{Timeout: 10 * time.Second}, &bmocks.SuperUser{IsSuperFunc: func(string) bool { return false }})
+	o.client = mockOpenAIClient
+
+	user := bot.User{ID: 1, Username: "user"}
+	resp, err := o.Digest(user, "10:00 user: hi")
+	require.NoError(t, err)
+	assert.Equal(t, "digest", resp)
+	calls := mockOpenAIClient.CreateChatCompletionCalls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, "small-model", calls[0].ChatCompletionRequest.Model)
+	assert.Equal(t, "10:00 user: hi", calls[0].ChatCompletionRequest.Messages[1].Content)
+	assert.Contains(t, usage.Report(time.Now(), 1), "digest 100")
+
+	_, err = o.Digest(user, "10:00 user: hi")
+	assert.ErrorIs(t, err, ErrBudgetExhausted)
+}
+
+func TestOpenAI_OnMessage_Image(t *testing.T) {
+	mockOpenAIClient := &mocks.OpenAIClient{
+		CreateChatCompletionFunc: func(ctx context.Context, r ai.ChatCompletionRequest) (ai.ChatCompletionResponse, error) {
+			return ai.ChatCompletionResponse{Choices: []ai.ChatCompletionChoice{{Message: ai.ChatCompletionMessage{Content: "a cat"}}}}, nil
+		},
+	}
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+	files := map[string][]byte{"photo": png, "large": append(png, bytes.Repeat([]byte{0}, 100)...), "text": []byte("some text")}
+	images := fileRecipientFunc(func(fileID string) (io.ReadCloser, error) {
+		data, ok := files[fileID]
+		if !ok {
+			return nil, fmt.Errorf("not found %s", fileID)
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+	su := &bmocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "super" }}
+
+	config := getDefaultTestingConfig()
+	config.EnableAutoResponse = false
+	config.Images, config.MaxImageSize, config.ImageCooldown = images, 50, 5*time.Minute
+	o := NewOpenAI(config, &http.Client{Timeout: 10 * time.Second}, su)
+	o.client = mockOpenAIClient
+	now := time.Date(2024, 5, 4, 12, 0, 0, 0, time.Local)
+	o.nowFn = func() time.Time { return now }
+	user := bot.User{ID: 1, Username: "user"}
+
+	// chat! in a caption of the photo
+	resp := o.OnMessage(bot.Message{ID: 10, From: user, Image: &bot.Image{FileID: "photo", Caption: "chat! что это?"}})
+	assert.Equal(t, bot.Response{Text: "a cat", Send: true, ReplyTo: 10}, resp)
+	calls := mockOpenAIClient.CreateChatCompletionCalls()
+	require.Len(t, calls, 1)
+	userMsg := calls[0].ChatCompletionRequest.Messages[1]
+	assert.Equal(t, ai.ChatMessageRoleUser, userMsg.Role)
+	assert.Equal(t, "", userMsg.Content)
+	require.Len(t, userMsg.MultiContent, 2)
+	assert.Equal(t, ai.ChatMessagePart{Type: ai.ChatMessagePartTypeText, Text: "user: что это?"}, userMsg.MultiContent[0])
+	assert.Equal(t, ai.ChatMessagePartTypeImageURL, userMsg.MultiContent[1].Type)
+	assert.True(t, strings.HasPrefix(userMsg.MultiContent[1].ImageURL.URL, "data:image/png;base64,"))
+	assert.Equal(t, ai.ImageURLDetailLow, userMsg.MultiContent[1].ImageURL.Detail)
+
+	// reply to the photo within cooldown
+	now = now.Add(time.Minute)
+	msg := bot.Message{ID: 11, From: user, Text: "chat! а это?"}
+	msg.ReplyTo.Image = &bot.Image{FileID: "photo"}
+	resp = o.OnMessage(msg)
+	assert.Equal(t, bot.Response{Text: "картинки можно отправлять не чаще раза в 5мин", Send: true, ReplyTo: 11}, resp)
+
+	// too large, doesn't count for cooldown
+	now = now.Add(5 * time.Minute)
+	msg.ReplyTo.Image = &bot.Image{FileID: "large"}
+	resp = o.OnMessage(msg)
+	assert.Equal(t, bot.Response{Text: "картинка слишком большая", Send: true, ReplyTo: 11}, resp)
+
+	// not an image and missing file
+	for _, fileID := range []string{"text", "missing"} {
+		msg.ReplyTo.Image = &bot.Image{FileID: fileID}
+		assert.Equal(t, bot.Response{}, o.OnMessage(msg))
+	}
+	assert.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 1)
+
+	// superuser is not limited by cooldown, chat! without question
+	for i := 0; i < 2; i++ {
+		msg = bot.Message{ID: 12 + i, From: bot.User{ID: 2, Username: "super"}, Text: "chat!"}
+		msg.ReplyTo.Image = &bot.Image{FileID: "photo"}
+		assert.Equal(t, "a cat", o.OnMessage(msg).Text)
+	}
+	calls = mockOpenAIClient.CreateChatCompletionCalls()
+	require.Len(t, calls, 3)
+	assert.Equal(t, "super: "+imageRequest, calls[2].ChatCompletionRequest.Messages[1].MultiContent[0].Text)
+
+	// images disabled, not answered as text-only request
+	config.Images = nil
+	o = NewOpenAI(config, &http.Client{Timeout: 10 * time.Second}, su)
+	o.client = mockOpenAIClient
+	resp = o.OnMessage(bot.Message{ID: 20, From: user, Image: &bot.Image{FileID: "photo", Caption: "chat! что это?"}})
+	assert.Equal(t, bot.Response{Text: "картинки я не смотрю", Send: true, ReplyTo: 20}, resp)
+	msg = bot.Message{ID: 21, From: user, Text: "chat! а это?"}
+	msg.ReplyTo.Image = &bot.Image{FileID: "photo"}
+	assert.Equal(t, bot.Response{Text: "картинки я не смотрю", Send: true, ReplyTo: 21}, o.OnMessage(msg))
+	assert.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 3)
+}
+
+type fileRecipientFunc func(fileID string) (io.ReadCloser, error)
+
+func (f fileRecipientFunc) GetFile(fileID string) (io.ReadCloser, error) { return f(fileID) }
+
+func TestOpenAI_OnMessage_Tools(t *testing.T) {
+	toolCall := ai.ChatCompletionMessage{Role: ai.ChatMessageRoleAssistant, ToolCalls: []ai.ToolCall{
+		{ID: "call1", Type: ai.ToolTypeFunction, Function: ai.FunctionCall{Name: "show_schedule", Arguments: "{}"}}}}
+	mockOpenAIClient := &mocks.OpenAIClient{
+		CreateChatCompletionFunc: func(ctx context.Context, r ai.ChatCompletionRequest) (ai.ChatCompletionResponse, error) {
+			if len(r.Tools) > 0 { // keeps calling tools while they are offered
+				return ai.ChatCompletionResponse{Choices: []ai.ChatCompletionChoice{{Message: toolCall}}}, nil
+			}
+			return ai.ChatCompletionResponse{Choices: []ai.ChatCompletionChoice{{Message: ai.ChatCompletionMessage{Content: "в субботу"}}}}, nil
+		},
+	}
+	schedule := Tool{Name: "show_schedule", Parameters: noParams, Call: func(string) (string, error) { return "saturday", nil }}
+
+	config := getDefaultTestingConfig()
+	config.EnableAutoResponse = false
+	config.Tools, config.MaxToolRounds = []Tool{schedule}, 2
+	o := NewOpenAI(config, &http.Client{Timeout: 10 * time.Second}, &bmocks.SuperUser{IsSuperFunc: func(string) bool { return true }})
+	o.client = mockOpenAIClient
+
+	resp := o.OnMessage(bot.Message{ID: 1, Text: "chat! когда следующий эфир?", From: bot.User{Username: "user"}})
+	assert.Equal(t, bot.Response{Text: "в субботу", Send: true, ReplyTo: 1}, resp)
+
+	calls := mockOpenAIClient.CreateChatCompletionCalls()
+	require.Len(t, calls, 3, "two rounds with tools, the last one without")
+	assert.Len(t, calls[0].ChatCompletionRequest.Tools, 1)
+	assert.Len(t, calls[1].ChatCompletionRequest.Tools, 1)
+	assert.Empty(t, calls[2].ChatCompletionRequest.Tools)
+
+	messages := calls[2].ChatCompletionRequest.Messages
+	require.Len(t, messages, 6)
+	assert.Equal(t, toolCall, messages[2])
+	assert.Equal(t, ai.ChatCompletionMessage{Role: ai.ChatMessageRoleTool, ToolCallID: "call1", Content: "saturday"}, messages[3])
+	assert.Equal(t, toolCall, messages[4])
+	assert.Equal(t, ai.ChatCompletionMessage{Role: ai.ChatMessageRoleTool, ToolCallID: "call1", Content: "saturday"}, messages[5])
+
+	// no tools for summaries
+	_, err := o.Summary("some text")
+	require.NoError(t, err)
+	calls = mockOpenAIClient.CreateChatCompletionCalls()
+	require.Len(t, calls, 4)
+	assert.Empty(t, calls[3].ChatCompletionRequest.Tools)
+}
+
+func TestOpenAI_OnMessage_Moderation(t *testing.T) {
+	answers := []string{"иди в казино", "приходите на эфир", "казино рядом"}
+	mockOpenAIClient := &mocks.OpenAIClient{
+		CreateChatCompletionFunc: func(ctx context.Context, r ai.ChatCompletionRequest) (ai.ChatCompletionResponse, error) {
+			answer := answers[0]
+			answers = answers[1:]
+			return ai.ChatCompletionResponse{Choices: []ai.ChatCompletionChoice{{Message: ai.ChatCompletionMessage{Content: answer}}}}, nil
+		},
+	}
+	su := &bmocks.SuperUser{IsSuperFunc: func(string) bool { return false }}
+
+	config := getDefaultTestingConfig()
+	config.Moderation = ModerationParams{Blocklist: []string{"казино"}, Retry: true}
+	o := NewOpenAI(config, &http.Client{Timeout: 10 * time.Second}, su)
+	o.client = mockOpenAIClient
+	o.rand = func(int64) int64 { return 0 } // always answer with history
+
+	// rejected answer retried with stricter prompt
+	resp := o.OnMessage(bot.Message{ID: 1, Text: "chat! куда пойти?", From: bot.User{Username: "user"}})
+	assert.Equal(t, bot.Response{Text: "приходите на эфир", Send: true, ReplyTo: 1}, resp)
+	assert.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 2)
+
+	// rejected auto-response without retry, stays silent
+	o.params.Moderation.Retry = false
+	resp = o.OnMessage(bot.Message{ID: 2, Text: "куда пойти вечером?", From: bot.User{Username: "user"}})
+	assert.Equal(t, bot.Response{}, resp)
+	assert.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 3)
+}
+
+func TestOpenAI_OnMessage_Persona(t *testing.T) {
+	mockOpenAIClient := &mocks.OpenAIClient{
+		CreateChatCompletionFunc: func(ctx context.Context, r ai.ChatCompletionRequest) (ai.ChatCompletionResponse, error) {
+			return ai.ChatCompletionResponse{Choices: []ai.ChatCompletionChoice{{Message: ai.ChatCompletionMessage{Content: "answer"}}}}, nil
+		},
+	}
+	prompts, err := NewPrompts(PromptParams{Path: "openai_prompts.tmpl", Personas: map[string]string{"gpt!": "expert"}})
+	require.NoError(t, err)
+	config := getDefaultTestingConfig()
+	config.EnableAutoResponse, config.Prompts = false, prompts
+	o := NewOpenAI(config, &http.Client{Timeout: 10 * time.Second}, &bmocks.SuperUser{IsSuperFunc: func(string) bool { return true }})
+	o.client = mockOpenAIClient
+
+	assert.Equal(t, "answer", o.OnMessage(bot.Message{ID: 1, Text: "gpt! кто ведущие?", From: bot.User{Username: "user"}}).Text)
+	assert.Equal(t, "answer", o.OnMessage(bot.Message{ID: 2, Text: "chat! кто ведущие?", From: bot.User{Username: "user"}}).Text)
+
+	calls := mockOpenAIClient.CreateChatCompletionCalls()
+	require.Len(t, calls, 2)
+	assert.Contains(t, calls[0].ChatCompletionRequest.Messages[0].Content, "You are a co-host of Radio-T")
+	assert.Contains(t, calls[0].ChatCompletionRequest.Messages[0].Content, "Answer @user in russian")
+	assert.Equal(t, "You answer with no more than 100 words", calls[1].ChatCompletionRequest.Messages[0].Content)
+}
+
+func TestOpenAI_OnMessage_Addressed(t *testing.T) {
+	mockOpenAIClient := &mocks.OpenAIClient{
+		CreateChatCompletionFunc: func(ctx context.Context, r ai.ChatCompletionRequest) (ai.ChatCompletionResponse, error) {
+			return ai.ChatCompletionResponse{Choices: []ai.ChatCompletionChoice{{Message: ai.ChatCompletionMessage{Content: "answer"}}}}, nil
+		},
+	}
+	su := &bmocks.SuperUser{IsSuperFunc: func(string) bool { return false }}
+	config := getDefaultTestingConfig()
+	config.EnableAutoResponse, config.AddressedResponse = false, true
+	config.BotUsername, config.BotNames = "rt_bot", []string{"бот", " "}
+	config.Commands = func() []string { return []string{"quote!"} }
+	o := NewOpenAI(config, &http.Client{Timeout: 10 * time.Second}, su)
+	o.client = mockOpenAIClient
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	o.nowFn = func() time.Time { return now }
+
+	replyToBot := bot.Message{ID: 4, Text: "а почему?", From: bot.User{Username: "user"}}
+	replyToBot.ReplyTo.ID, replyToBot.ReplyTo.From = 101, bot.User{Username: "RT_bot"} // answer to "mention" below
+	replyToOther := bot.Message{ID: 7, Text: "а почему?", From: bot.User{Username: "user"}}
+	replyToOther.ReplyTo.ID, replyToOther.ReplyTo.From = 50, bot.User{Username: "RT_bot"} // quote! or warn! output
+	tbl := []struct {
+		name      string
+		msg       bot.Message
+		addressed bool
+	}{
+		{"mention", bot.Message{ID: 1, Text: "@Rt_Bot, когда эфир?", From: bot.User{Username: "user"}}, true},
+		{"name", bot.Message{ID: 2, Text: "Бот, расскажи анекдот", From: bot.User{Username: "user"}}, true},
+		{"name in word", bot.Message{ID: 3, Text: "ботаники тут есть?", From: bot.User{Username: "user"}}, false},
+		{"other", bot.Message{ID: 5, Text: "когда эфир?", From: bot.User{Username: "user"}}, false},
+		{"command of other bot", bot.Message{ID: 8, Text: "quote! бот лучший", From: bot.User{Username: "user"}}, false},
+		{"reply to not AI answer", replyToOther, false},
+		{"reply", replyToBot, true},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(time.Minute) // not limited by rate
+			calls := len(mockOpenAIClient.CreateChatCompletionCalls())
+			resp := o.OnMessage(tt.msg)
+			if !tt.addressed {
+				assert.Equal(t, bot.Response{}, resp)
+				assert.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), calls)
+				return
+			}
+			assert.Equal(t, bot.Response{Text: "answer", Send: true, ReplyTo: tt.msg.ID}, resp)
+			o.OnSent(tt.msg, 100+tt.msg.ID)
+			require.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), calls+1)
+			req := mockOpenAIClient.CreateChatCompletionCalls()[calls].ChatCompletionRequest
+			assert.Contains(t, req.Messages[0].Content, "The last message from @user is addressed to you")
+			assert.Equal(t, "user: "+tt.msg.Text, req.Messages[len(req.Messages)-1].Content)
+		})
+	}
+
+	// rate limited, stays silent
+	now = now.Add(5 * time.Second)
+	assert.Equal(t, bot.Response{}, o.OnMessage(bot.Message{ID: 6, Text: "бот, ты тут?", From: bot.User{Username: "user"}}))
+	assert.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 3)
+}
+
+func TestOpenAI_OnMessage_AutoResponseModes(t *testing.T) {
+	mockOpenAIClient := &mocks.OpenAIClient{
+		CreateChatCompletionFunc: func(ctx context.Context, r ai.ChatCompletionRequest) (ai.ChatCompletionResponse, error) {
+			return ai.ChatCompletionResponse{Choices: []ai.ChatCompletionChoice{{Message: ai.ChatCompletionMessage{Content: "answer"}}}}, nil
+		},
+	}
+	su := &bmocks.SuperUser{IsSuperFunc: func(string) bool { return false }}
+	config := getDefaultTestingConfig()
+	config.AddressedResponse, config.BotNames = true, []string{"бот"}
+	config.HistoryReplyProbability, config.RandomReplyProbability = 30, 20
+	live := false
+	config.Live = func(time.Time) bool { return live }
+	o := NewOpenAI(config, &http.Client{Timeout: 10 * time.Second}, su)
+	o.client = mockOpenAIClient
+	o.history.Add(bot.Message{ID: 1, Text: "message 1", From: bot.User{Username: "user"}})
+
+	tbl := []struct {
+		name string
+		text string
+		rand int64
+		live bool
+		exp  bot.Response
+	}{
+		{"question, chatter", "эфир сегодня?", 29, false, bot.Response{Text: "answer", Send: true}},
+		{"question, silent", "эфир сегодня?", 30, false, bot.Response{}},
+		{"message, chatter", "эфир сегодня", 19, false, bot.Response{Text: "answer", Send: true}},
+		{"message, silent", "эфир сегодня", 20, false, bot.Response{}},
+		{"question, live", "эфир сегодня?", 0, true, bot.Response{}},
+		{"addressed, live", "бот, эфир сегодня?", 99, true, bot.Response{Text: "answer", Send: true, ReplyTo: 10}},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			o.rand = func(int64) int64 { return tt.rand }
+			live = tt.live
+			o.lastDT = time.Time{}
+			resp := o.OnMessage(bot.Message{ID: 10, Text: tt.text, From: bot.User{Username: "user"}})
+			assert.Equal(t, tt.exp, resp)
+		})
+	}
+	assert.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 3)
+}
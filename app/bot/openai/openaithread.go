@@ -0,0 +1,112 @@
+package openai
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/radio-t/super-bot/app/bot"
+)
+
+// MessageThreads keeps conversations with the bot, so replies to bot's answers continue the conversation.
+// Thread is reachable by ids of bot's answers, requests are kept until the answer is sent and its id is known.
+// Threads not updated for ttl are dropped. Thread safe.
+type MessageThreads struct {
+	ttl       time.Duration
+	maxTokens int // messages of the thread over this limit are truncated, the oldest first
+	nowFn     func() time.Time
+
+	lock     sync.Mutex
+	threads  map[int]*messageThread // bot's answer id -> thread
+	requests map[int]*messageThread // request id -> thread, until the answer is sent
+}
+
+type messageThread struct {
+	messages []openai.ChatCompletionMessage
+	updated  time.Time
+}
+
+// NewMessageThreads makes threads store with expiration and limit of tokens per thread
+func NewMessageThreads(ttl time.Duration, maxTokens int) *MessageThreads {
+	return &MessageThreads{ttl: ttl, maxTokens: maxTokens, nowFn: time.Now,
+		threads: map[int]*messageThread{}, requests: map[int]*messageThread{}}
+}
+
+// Get returns messages of the thread with bot's answer, false if not found or expired
+func (t *MessageThreads) Get(msgID int) ([]openai.ChatCompletionMessage, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	th, found := t.threads[msgID]
+	if !found || t.nowFn().Sub(th.updated) > t.ttl {
+		return nil, false
+	}
+	return append([]openai.ChatCompletionMessage{}, th.messages...), true
+}
+
+// Add appends user's request text and bot's answer to the thread with replyTo answer, or starts a new thread.
+// The answer is linked to the thread by Sent once its id is known.
+func (t *MessageThreads) Add(replyTo int, request bot.Message, text, answer string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.cleanup()
+
+	th, found := t.threads[replyTo]
+	if !found || replyTo == 0 {
+		th = &messageThread{}
+	}
+	th.messages = append(th.messages, threadUserMessage(request, text),
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer})
+	th.messages = truncateThread(th.messages, t.maxTokens)
+	th.updated = t.nowFn()
+	t.requests[request.ID] = th
+}
+
+// Sent links bot's message sent in response to the request to the request's thread
+func (t *MessageThreads) Sent(requestID, sentID int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if th, found := t.requests[requestID]; found {
+		t.threads[sentID] = th
+		delete(t.requests, requestID)
+	}
+}
+
+// cleanup drops expired threads, should be called under lock
+func (t *MessageThreads) cleanup() {
+	for _, m := range []map[int]*messageThread{t.threads, t.requests} {
+		for id, th := range m {
+			if t.nowFn().Sub(th.updated) > t.ttl {
+				delete(m, id)
+			}
+		}
+	}
+}
+
+// threadUserMessage makes user's message prefixed with author's name, so the model can tell participants apart
+func threadUserMessage(msg bot.Message, text string) openai.ChatCompletionMessage {
+	name := strings.TrimSpace(msg.From.DisplayName)
+	if name == "" {
+		name = msg.From.Username
+	}
+	if name != "" {
+		text = name + ": " + text
+	}
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: text}
+}
+
+// truncateThread drops the oldest messages until the thread fits into maxTokens, the last message is kept anyway
+func truncateThread(messages []openai.ChatCompletionMessage, maxTokens int) []openai.ChatCompletionMessage {
+	if maxTokens <= 0 {
+		return messages
+	}
+	total := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		total += messageTokens(messages[i])
+		if total > maxTokens && i < len(messages)-1 {
+			return messages[i+1:]
+		}
+	}
+	return messages
+}
@@ -0,0 +1,68 @@
+package openai
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot"
+)
+
+func TestMessageThreads(t *testing.T) {
+	now := time.Date(2024, 5, 4, 10, 0, 0, 0, time.UTC)
+	th := NewMessageThreads(time.Hour, 1000)
+	th.nowFn = func() time.Time { return now }
+
+	th.Add(0, bot.Message{ID: 1, From: bot.User{Username: "user1", DisplayName: "User One"}}, "what is go?", "a language")
+	_, found := th.Get(1)
+	assert.False(t, found, "request id is not a thread")
+	_, found = th.Get(2)
+	assert.False(t, found, "answer not sent yet")
+
+	th.Sent(1, 2)
+	msgs, found := th.Get(2)
+	require.True(t, found)
+	assert.Equal(t, []ai.ChatCompletionMessage{
+		{Role: ai.ChatMessageRoleUser, Content: "User One: what is go?"},
+		{Role: ai.ChatMessageRoleAssistant, Content: "a language"},
+	}, msgs)
+
+	// reply to the answer continues the thread
+	th.Add(2, bot.Message{ID: 3, From: bot.User{Username: "user2"}}, "and rust?", "also a language")
+	th.Sent(3, 4)
+	msgs, found = th.Get(4)
+	require.True(t, found)
+	require.Len(t, msgs, 4)
+	assert.Equal(t, "user2: and rust?", msgs[2].Content)
+	assert.Equal(t, "also a language", msgs[3].Content)
+
+	th.Sent(100, 101) // unknown request ignored
+	_, found = th.Get(101)
+	assert.False(t, found)
+
+	now = now.Add(2 * time.Hour)
+	_, found = th.Get(4)
+	assert.False(t, found, "expired")
+	th.Add(0, bot.Message{ID: 5}, "hi", "hello")
+	assert.Len(t, th.threads, 0, "expired threads dropped")
+	assert.Len(t, th.requests, 1)
+}
+
+func TestMessageThreads_Truncate(t *testing.T) {
+	th := NewMessageThreads(time.Hour, 40)
+	long := strings.Repeat("word ", 20) // 21 tokens, 25 with message overhead
+	th.Add(0, bot.Message{ID: 1}, long, long)
+	th.Sent(1, 2)
+	th.Add(2, bot.Message{ID: 3}, "short question", "short answer")
+	th.Sent(3, 4)
+
+	msgs, found := th.Get(4)
+	require.True(t, found)
+	require.Len(t, msgs, 3, "the oldest message dropped")
+	assert.Equal(t, ai.ChatMessageRoleAssistant, msgs[0].Role)
+	assert.Equal(t, "short answer", msgs[2].Content)
+}
@@ -0,0 +1,232 @@
+package openai
+
+import (
+	"bytes"
+	_ "embed" // for default prompts
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// prompt commands, besides chat commands like chat! and gpt!, personas are selected for
+const (
+	PromptAuto    = "auto"    // auto-responses to the chat
+	PromptSummary = "summary" // summaries of links
+	PromptDigest  = "digest"  // digests of chat discussion, tldr!
+)
+
+// defaultPersonas used for commands not set in PromptParams.Personas, chat commands use "chat"
+var defaultPersonas = map[string]string{PromptAuto: "auto", PromptSummary: "summary", PromptDigest: "digest"}
+
+// showNumberTTL is how long the number of the last show is cached
+const showNumberTTL = time.Hour
+
+// defaultPrompts used if templates file is missing, copy openai_prompts.tmpl to sys data to change them
+//
+//go:embed openai_prompts.tmpl
+var defaultPrompts string
+
+// builtinPrompts used if rendering of configured prompts failed
+var builtinPrompts = template.Must(template.New("built-in").Parse(defaultPrompts))
+
+// PromptData is available in prompt templates
+type PromptData struct {
+	User       string // who made the request, like @username, empty for summaries and not addressed auto-responses
+	Chat       string // name of the chat
+	ShowNumber int    // number of the last released show, 0 if unknown
+	Language   string // language of answers, like russian
+	Addressed  bool   // auto-response to a message addressed to the bot
+	Question   bool   // auto-response to a question, otherwise to the conversation
+	Mention    string // user to mention in auto-response, empty if none
+}
+
+// PromptParams defines prompt templates and personas
+type PromptParams struct {
+	Path       string            // templates file, built-in templates used if missing
+	Personas   map[string]string // command (chat!, gpt!, auto, summary, digest) -> template name
+	Chat       string
+	Language   string              // russian if empty
+	ShowNumber func() (int, error) // optional, number of the last released show
+}
+
+// Prompts renders system prompts from text/template file, a named template per persona.
+// The file is reloaded when changed, invalid file is rejected and the previous templates kept. Thread safe.
+type Prompts struct {
+	PromptParams
+
+	lock    sync.Mutex
+	tmpl    *template.Template
+	modTime time.Time // of the file when loaded
+	size    int64     // of the file when loaded
+
+	showNumber     int
+	showNumberTime time.Time // of the last refresh
+	showRefreshing bool      // refresh in background is in progress
+}
+
+// NewPrompts loads and validates templates, all personas of the commands should be defined and render with sample data
+func NewPrompts(params PromptParams) (*Prompts, error) {
+	if params.Language == "" {
+		params.Language = "russian"
+	}
+	res := &Prompts{PromptParams: params}
+	tmpl, err := res.load()
+	if err != nil {
+		return nil, err
+	}
+	res.tmpl = tmpl
+	if params.ShowNumber != nil {
+		res.showRefreshing = true
+		res.refreshShow() // once on start, later refreshed in background not to delay rendering
+	}
+	log.Printf("[INFO] prompts loaded from %q, personas %v", params.Path, res.personas())
+	return res, nil
+}
+
+// Render returns prompt of the persona selected for the command. User, Chat, Language and ShowNumber of data
+// are filled in if empty.
+func (p *Prompts) Render(command string, data PromptData) (string, error) {
+	p.lock.Lock()
+	p.refresh()
+	tmpl := p.tmpl
+	p.lock.Unlock()
+
+	if data.Chat == "" {
+		data.Chat = p.Chat
+	}
+	if data.Language == "" {
+		data.Language = p.Language
+	}
+	if data.ShowNumber == 0 {
+		data.ShowNumber = p.lastShow()
+	}
+	return render(tmpl, p.persona(command), data)
+}
+
+// persona returns template name for the command
+func (p *Prompts) persona(command string) string {
+	if name, ok := p.Personas[command]; ok {
+		return name
+	}
+	if name, ok := defaultPersonas[command]; ok {
+		return name
+	}
+	return "chat"
+}
+
+// personas returns all commands with personas, chat! included
+func (p *Prompts) personas() map[string]string {
+	res := map[string]string{"chat!": p.persona("chat!")}
+	for cmd := range defaultPersonas {
+		res[cmd] = p.persona(cmd)
+	}
+	for cmd := range p.Personas {
+		res[cmd] = p.persona(cmd)
+	}
+	return res
+}
+
+// refresh reloads the file if it was changed, should be called under lock
+func (p *Prompts) refresh() {
+	if p.Path == "" {
+		return
+	}
+	fi, err := os.Stat(p.Path)
+	if err != nil || (fi.ModTime().Equal(p.modTime) && fi.Size() == p.size) {
+		return
+	}
+	tmpl, err := p.load()
+	if err != nil {
+		log.Printf("[WARN] can't reload prompts, previous kept: %v", err)
+		return
+	}
+	p.tmpl = tmpl
+	log.Printf("[INFO] prompts reloaded from %s", p.Path)
+}
+
+// load parses the file, or built-in templates if there is no file, and validates them
+func (p *Prompts) load() (*template.Template, error) {
+	text, name := defaultPrompts, "built-in"
+	if p.Path != "" {
+		fi, err := os.Stat(p.Path)
+		switch {
+		case err == nil:
+			data, err := os.ReadFile(p.Path)
+			if err != nil {
+				return nil, fmt.Errorf("can't read prompts %s: %w", p.Path, err)
+			}
+			text, name = string(data), p.Path
+			p.modTime, p.size = fi.ModTime(), fi.Size() // remembered even if invalid, not to reload it on every request
+		case !os.IsNotExist(err):
+			return nil, fmt.Errorf("can't read prompts %s: %w", p.Path, err)
+		}
+	}
+
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse prompts: %w", err)
+	}
+
+	sample := PromptData{User: "@user", Chat: "chat", ShowNumber: 1, Language: "russian", Question: true, Mention: "@user"}
+	commands := p.personas()
+	keys := make([]string, 0, len(commands))
+	for cmd := range commands {
+		keys = append(keys, cmd)
+	}
+	sort.Strings(keys)
+	for _, cmd := range keys {
+		if _, err := render(tmpl, commands[cmd], sample); err != nil {
+			return nil, fmt.Errorf("invalid persona %q for %s in %s: %w", commands[cmd], cmd, name, err)
+		}
+	}
+	return tmpl, nil
+}
+
+// lastShow returns cached number of the last show, 0 if unknown. Expired number is refreshed in background,
+// the cached one returned meanwhile
+func (p *Prompts) lastShow() int {
+	if p.ShowNumber == nil {
+		return 0
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.showRefreshing && time.Since(p.showNumberTime) >= showNumberTTL {
+		p.showRefreshing = true
+		go p.refreshShow()
+	}
+	return p.showNumber
+}
+
+// refreshShow gets number of the last show, failed request is not repeated until ttl expired
+func (p *Prompts) refreshShow() {
+	num, err := p.ShowNumber()
+	if err != nil {
+		log.Printf("[WARN] can't get number of the last show, %v", err)
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if err == nil {
+		p.showNumber = num
+	}
+	p.showNumberTime, p.showRefreshing = time.Now(), false
+}
+
+func render(tmpl *template.Template, name string, data PromptData) (string, error) {
+	if tmpl.Lookup(name) == nil {
+		return "", fmt.Errorf("template %q not defined", name)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", fmt.Errorf("can't render %q: %w", name, err)
+	}
+	res := strings.TrimSpace(buf.String())
+	if res == "" {
+		return "", fmt.Errorf("template %q is empty", name)
+	}
+	return res, nil
+}
@@ -0,0 +1,177 @@
+package openai
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrompts_BuiltIn(t *testing.T) {
+	p, err := NewPrompts(PromptParams{})
+	require.NoError(t, err)
+
+	tbl := []struct {
+		command string
+		data    PromptData
+		exp     string
+	}{
+		{"chat!", PromptData{User: "@user"}, "You answer with no more than 100 words"},
+		{"gpt!", PromptData{}, "You answer with no more than 100 words"},
+		{PromptAuto, PromptData{}, "This is a chat conversation. You reply with no more than 100 words, your message should be " +
+			"in the same language as the last message. Say something related to the conversation or ask something to continue the conversation."},
+		{PromptAuto, PromptData{Question: true, Mention: "@user"}, "This is a chat conversation. You reply with no more than 100 words, " +
+			"your answer should be in the same language as the question. Don't give a real answer to the question, just make something up, " +
+			"something interesting and maybe funny and witty. Be sure to mention @user in your response, you should ask them a question " +
+			"or just say something to them to continue the conversation."},
+		{PromptAuto, PromptData{Addressed: true, User: "@user"}, "This is a chat conversation. You reply with no more than 100 words, " +
+			"your answer should be in the same language as the last message. The last message from @user is addressed to you, " +
+			"answer it taking the conversation into account."},
+		{PromptSummary, PromptData{}, "Make a short summary, up to 50 words, followed by a list of bullet points. Each bullet point " +
+			"is limited to 50 words, up to 7 in total. All in markdown format and translated to russian:"},
+		{PromptDigest, PromptData{Language: "english"}, "Make a short digest of the chat discussion, up to 7 bullet points, each up to 30 words. " +
+			"Say who said what, using names of the authors as given, skip greetings and jokes. All in markdown format and translated to english:"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.command, func(t *testing.T) {
+			res, err := p.Render(tt.command, tt.data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.exp, res)
+		})
+	}
+}
+
+func TestPrompts_DataFile(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile("openai_prompts.tmpl")
+	require.NoError(t, err)
+	fname := filepath.Join(dir, "openai_prompts.tmpl")
+	require.NoError(t, os.WriteFile(fname, data, 0o600))
+	p, err := NewPrompts(PromptParams{Path: fname, Chat: "radio_t_chat",
+		Personas:   map[string]string{"gpt!": "expert"},
+		ShowNumber: func() (int, error) { return 915, nil }})
+	require.NoError(t, err)
+
+	res, err := p.Render("gpt!", PromptData{User: "@user"})
+	require.NoError(t, err)
+	assert.Equal(t, "You are a co-host of Radio-T, a russian podcast about technologies, 915 shows released so far. "+
+		"Answer @user in russian with no more than 100 words, precisely and with facts, no jokes", res)
+
+	builtIn, err := NewPrompts(PromptParams{Personas: map[string]string{"gpt!": "expert"}})
+	require.NoError(t, err)
+	res, err = builtIn.Render("gpt!", PromptData{User: "@user"})
+	require.NoError(t, err)
+	assert.Contains(t, res, "0 shows released so far", "built-in prompts are the same templates")
+}
+
+func TestPrompts_Validation(t *testing.T) {
+	dir := t.TempDir()
+	write := func(text string) string {
+		fname := filepath.Join(dir, "prompts.tmpl")
+		require.NoError(t, os.WriteFile(fname, []byte(text), 0o600))
+		return fname
+	}
+	full := `{{define "chat"}}chat{{end}}{{define "auto"}}auto{{end}}{{define "summary"}}summary{{end}}{{define "digest"}}digest{{end}}`
+
+	tbl := []struct {
+		name     string
+		text     string
+		personas map[string]string
+		err      string
+	}{
+		{"valid", full, nil, ""},
+		{"unknown persona", full, map[string]string{"gpt!": "expert"}, `invalid persona "expert" for gpt!`},
+		{"missing template", `{{define "chat"}}chat{{end}}`, nil, `invalid persona "auto" for auto`},
+		{"parse error", full + `{{define "expert"}}{{.User}{{end}}`, nil, "can't parse prompts"},
+		{"unknown field", full + `{{define "expert"}}{{.Name}}{{end}}`, map[string]string{"gpt!": "expert"}, "can't evaluate field Name"},
+		{"empty", full + `{{define "expert"}} {{end}}`, map[string]string{"gpt!": "expert"}, `template "expert" is empty`},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPrompts(PromptParams{Path: write(tt.text), Personas: tt.personas})
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+
+	p, err := NewPrompts(PromptParams{Path: filepath.Join(dir, "missing.tmpl")})
+	require.NoError(t, err, "built-in prompts used if file is missing")
+	res, err := p.Render("chat!", PromptData{})
+	require.NoError(t, err)
+	assert.Equal(t, "You answer with no more than 100 words", res)
+}
+
+func TestPrompts_Reload(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "prompts.tmpl")
+	tmpl := `{{define "chat"}}%s{{end}}{{define "auto"}}auto{{end}}{{define "summary"}}summary{{end}}{{define "digest"}}digest{{end}}`
+	write := func(text string, mtime time.Time) {
+		require.NoError(t, os.WriteFile(fname, []byte(text), 0o600))
+		require.NoError(t, os.Chtimes(fname, mtime, mtime))
+	}
+	now := time.Now()
+	write(fmt.Sprintf(tmpl, "first"), now.Add(-time.Hour))
+
+	p, err := NewPrompts(PromptParams{Path: fname})
+	require.NoError(t, err)
+	res, err := p.Render("chat!", PromptData{})
+	require.NoError(t, err)
+	assert.Equal(t, "first", res)
+
+	write(fmt.Sprintf(tmpl, "second"), now.Add(-time.Minute))
+	res, err = p.Render("chat!", PromptData{})
+	require.NoError(t, err)
+	assert.Equal(t, "second", res, "reloaded on change")
+
+	write(`{{define "chat"}}broken{{end}}`, now)
+	res, err = p.Render("chat!", PromptData{})
+	require.NoError(t, err)
+	assert.Equal(t, "second", res, "invalid file rejected, previous kept")
+}
+
+func TestPrompts_ShowNumber(t *testing.T) {
+	var calls int32
+	p, err := NewPrompts(PromptParams{ShowNumber: func() (int, error) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			return 915, nil
+		case 2:
+			return 0, errors.New("failed")
+		}
+		return 916, nil
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "requested on start")
+
+	assert.Equal(t, 915, p.lastShow())
+	assert.Equal(t, 915, p.lastShow(), "cached")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	p.lock.Lock()
+	p.showNumberTime = time.Now().Add(-2 * showNumberTTL)
+	p.lock.Unlock()
+	assert.Equal(t, 915, p.lastShow(), "cached returned while refreshed in background")
+	assert.Eventually(t, func() bool {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		return !p.showRefreshing
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, 915, p.lastShow(), "previous kept on error, not repeated until ttl expired")
+
+	p.lock.Lock()
+	p.showNumberTime = time.Now().Add(-2 * showNumberTTL)
+	p.lock.Unlock()
+	p.lastShow()
+	assert.Eventually(t, func() bool { return p.lastShow() == 916 }, time.Second, time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,32 @@
+package openai
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+//go:generate moq --out mocks/openai_client.go --pkg mocks --skip-ensure . Provider:OpenAIClient
+
+// DefaultModel used if Params.Model is not set
+const DefaultModel = "gpt-4o-2024-08-06"
+
+// Provider is a chat completion backend, OpenAI API or any OpenAI-compatible server, like Ollama, vLLM or OpenRouter
+type Provider interface {
+	CreateChatCompletion(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+}
+
+// NewProvider makes a client for OpenAI-compatible API at baseURL, like "http://localhost:11434/v1".
+// OpenAI API is used if baseURL is empty, authToken may be empty for servers without auth.
+func NewProvider(authToken, baseURL string, httpClient *http.Client) Provider {
+	config := openai.DefaultConfig(authToken)
+	if baseURL != "" {
+		config.BaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+	if httpClient != nil {
+		config.HTTPClient = httpClient
+	}
+	return openai.NewClientWithConfig(config)
+}
@@ -0,0 +1,88 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	ai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot"
+	bmocks "github.com/radio-t/super-bot/app/bot/mocks"
+)
+
+func TestNewProvider(t *testing.T) {
+	resp, err := os.ReadFile("testdata/chat_completion_response.json")
+	require.NoError(t, err)
+
+	var lock sync.Mutex
+	var requests []ai.ChatCompletionRequest
+	var auth []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		var req ai.ChatCompletionRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		lock.Lock()
+		requests = append(requests, req)
+		auth = append(auth, r.Header.Get("Authorization"))
+		lock.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(resp)
+	}))
+	defer ts.Close()
+
+	su := &bmocks.SuperUser{IsSuperFunc: func(string) bool { return true }}
+
+	t.Run("custom model and sampling", func(t *testing.T) {
+		requests, auth = nil, nil
+		params := getDefaultTestingConfig()
+		params.BaseURL, params.Model, params.SummaryModel = ts.URL+"/v1/", "llama3.1", "qwen2.5"
+		params.Temperature, params.TopP = 0.5, 0.9
+		o := NewOpenAI(params, &http.Client{Timeout: 5 * time.Second}, su)
+
+		r := o.OnMessage(bot.Message{Text: "chat! what is go?", From: bot.User{Username: "super"}})
+		assert.Equal(t, "Mock response", r.Text)
+		summary, err := o.Summary("some long text")
+		require.NoError(t, err)
+		assert.Equal(t, "Mock response", summary)
+
+		require.Len(t, requests, 2)
+		assert.Equal(t, "llama3.1", requests[0].Model)
+		assert.Equal(t, float32(0.5), requests[0].Temperature)
+		assert.Equal(t, float32(0.9), requests[0].TopP)
+		assert.Equal(t, 100, requests[0].MaxTokens)
+		assert.Equal(t, "qwen2.5", requests[1].Model, "summary model")
+		assert.Equal(t, "Bearer ss-mockToken", auth[0])
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		requests, auth = nil, nil
+		params := getDefaultTestingConfig()
+		params.BaseURL = ts.URL + "/v1"
+		o := NewOpenAI(params, &http.Client{Timeout: 5 * time.Second}, su)
+
+		_, err := o.Summary("some long text")
+		require.NoError(t, err)
+		require.Len(t, requests, 1)
+		assert.Equal(t, DefaultModel, requests[0].Model, "summary model falls back to model")
+		assert.Zero(t, requests[0].Temperature)
+		assert.Zero(t, requests[0].TopP)
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		errServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"error":{"message":"model not found"}}`, http.StatusNotFound)
+		}))
+		defer errServer.Close()
+		p := NewProvider("", errServer.URL, nil)
+		_, err := p.CreateChatCompletion(context.Background(), ai.ChatCompletionRequest{Model: "none"})
+		assert.ErrorContains(t, err, "model not found")
+	})
+}
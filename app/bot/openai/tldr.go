@@ -0,0 +1,202 @@
+package openai
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-pkgz/lcw/v2"
+
+	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/reporter"
+)
+
+//go:generate moq --out mocks/openai_digest.go --pkg mocks --skip-ensure . openAIDigest:OpenAIDigest
+
+type openAIDigest interface {
+	Digest(user bot.User, text string) (response string, err error)
+}
+
+// TldrParams defines limits of tldr! command
+type TldrParams struct {
+	LogsPath       string        // reporter's daily logs, like logs/20240504.log
+	Messages       int           // number of the last messages for tldr! without period
+	MaxPeriod      time.Duration // max period for tldr! 30m
+	MaxSuperPeriod time.Duration // max period for superusers
+	MaxTokens      int           // messages over this limit are dropped, the oldest first
+	CacheTTL       time.Duration // repeated requests of the same period answered from cache
+}
+
+// Tldr bot makes a digest of recent discussion in the chat, for those who missed it
+type Tldr struct {
+	TldrParams
+	digest    openAIDigest
+	superUser bot.SuperUser
+	cache     lcw.LoadingCache[string]
+	nowFn     func() time.Time
+}
+
+// NewTldr makes a bot responding on tldr! with a digest of messages from reporter's logs
+func NewTldr(digest openAIDigest, superUser bot.SuperUser, params TldrParams) *Tldr {
+	var cache lcw.LoadingCache[string] = lcw.NewNopCache[string]()
+	if params.CacheTTL > 0 {
+		o := lcw.NewOpts[string]()
+		cache, _ = lcw.NewExpirableCache(o.MaxKeys(100), o.TTL(params.CacheTTL))
+	}
+	log.Printf("[INFO] tldr bot with %+v", params)
+	return &Tldr{TldrParams: params, digest: digest, superUser: superUser, cache: cache, nowFn: time.Now}
+}
+
+// Help returns help message
+func (t *Tldr) Help() string {
+	return bot.GenHelpMsg(t.ReactOn(), fmt.Sprintf("краткое содержание последних %d сообщений чата, tldr! 30m - за период до %s, "+
+		"админам до %s", t.Messages, bot.HumanizeDuration(t.MaxPeriod), bot.HumanizeDuration(t.MaxSuperPeriod)))
+}
+
+// ReactOn keys
+func (t *Tldr) ReactOn() []string {
+	return []string{"tldr!", "тлдр!"}
+}
+
+// OnMessage responds on tldr! and tldr! <period> with a digest of the chat messages
+func (t *Tldr) OnMessage(msg bot.Message) (response bot.Response) {
+	fields := strings.Fields(msg.Text)
+	if len(fields) == 0 || !contains(t.ReactOn(), strings.ToLower(fields[0])) {
+		return bot.Response{}
+	}
+
+	var period time.Duration
+	if len(fields) > 1 {
+		p, err := time.ParseDuration(fields[1])
+		if err != nil || p <= 0 {
+			return bot.Response{Text: "не понял период, например: tldr! 30m", Send: true, ReplyTo: msg.ID}
+		}
+		maxPeriod := t.MaxPeriod
+		if t.superUser.IsSuper(msg.From.Username) {
+			maxPeriod = t.MaxSuperPeriod
+		}
+		period = min(p, maxPeriod)
+	}
+
+	key := "last"
+	if period > 0 {
+		key = period.String()
+	}
+	digest, err := t.cache.Get(key, func() (string, error) {
+		messages, err := t.messages(t.nowFn(), period)
+		if err != nil {
+			return "", err
+		}
+		if len(messages) == 0 {
+			return "", errNoMessages
+		}
+		return t.digest.Digest(msg.From, t.format(messages))
+	})
+
+	switch {
+	case errors.Is(err, errNoMessages):
+		return bot.Response{Text: "ничего не обсуждали", Send: true, ReplyTo: msg.ID}
+	case errors.Is(err, ErrBudgetExhausted):
+		return bot.Response{Text: "На сегодня лимит запросов к ChatGPT исчерпан, приходите завтра 🙏", Send: true, ReplyTo: msg.ID}
+	case err != nil:
+		log.Printf("[WARN] can't make tldr for %s, %v", key, err)
+		return bot.Response{}
+	}
+	return bot.Response{Text: digest, Send: true, ReplyTo: msg.ID}
+}
+
+var errNoMessages = errors.New("no messages")
+
+// messages reads messages from logs of today and, if period crosses midnight, of yesterday.
+// Noise, like +1, and messages without text are skipped. Returns the last Messages if period is 0.
+func (t *Tldr) messages(now time.Time, period time.Duration) ([]bot.Message, error) {
+	from := now.Add(-period)
+	days := []time.Time{now}
+	if period == 0 || from.YearDay() != now.YearDay() {
+		days = []time.Time{now.AddDate(0, 0, -1), now}
+	}
+
+	res := []bot.Message{}
+	for _, day := range days {
+		fname := filepath.Join(t.LogsPath, day.Format("20060102")+".log")
+		err := readLog(fname, func(msg bot.Message) {
+			if strings.TrimSpace(msg.Text) == "" || reporter.Filter(msg) || (period > 0 && msg.Sent.Before(from)) {
+				return
+			}
+			res = append(res, msg)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if period == 0 && len(res) > t.Messages {
+		res = res[len(res)-t.Messages:]
+	}
+	return res, nil
+}
+
+// format makes "15:04 Name: text" lines, the oldest lines dropped to fit into MaxTokens
+func (t *Tldr) format(messages []bot.Message) string {
+	lines, tokens := []string{}, 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		m := messages[i]
+		line := fmt.Sprintf("%s %s: %s", m.Sent.Format("15:04"), tldrAuthor(m), strings.ReplaceAll(m.Text, "\n", " "))
+		tokens += countTokens(line)
+		if t.MaxTokens > 0 && tokens > t.MaxTokens && len(lines) > 0 {
+			break
+		}
+		lines = append([]string{line}, lines...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func tldrAuthor(m bot.Message) string {
+	if name := strings.TrimSpace(m.From.DisplayName); name != "" {
+		return name
+	}
+	if m.From.Username != "" {
+		return m.From.Username
+	}
+	return "bot"
+}
+
+// readLog calls fn for every message of reporter's log file, missing file is not an error
+func readLog(fname string, fn func(msg bot.Message)) error {
+	fh, err := os.Open(fname) // nolint
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("can't open %s: %w", fname, err)
+	}
+	defer fh.Close() // nolint
+
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		msg := bot.Message{}
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		fn(msg)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("can't read %s: %w", fname, err)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot"
+	bmocks "github.com/radio-t/super-bot/app/bot/mocks"
+	"github.com/radio-t/super-bot/app/bot/openai/mocks"
+)
+
+func TestTldr_OnMessage(t *testing.T) {
+	logs := t.TempDir()
+	now := time.Date(2024, 5, 4, 0, 30, 0, 0, time.Local)
+	writeLog := func(day time.Time, msgs ...bot.Message) {
+		lines := []string{}
+		for _, m := range msgs {
+			data, err := json.Marshal(m)
+			require.NoError(t, err)
+			lines = append(lines, string(data))
+		}
+		fname := filepath.Join(logs, day.Format("20060102")+".log")
+		require.NoError(t, os.WriteFile(fname, []byte(strings.Join(lines, "\n")+"\nbad line\n"), 0o600))
+	}
+	user1 := bot.User{ID: 1, Username: "user1", DisplayName: "User One"}
+	user2 := bot.User{ID: 2, Username: "user2"}
+	writeLog(now.AddDate(0, 0, -1),
+		bot.Message{Text: "old news", From: user1, Sent: now.Add(-2 * time.Hour)},
+		bot.Message{Text: "go 1.23 released", From: user1, Sent: now.Add(-50 * time.Minute)},
+	)
+	writeLog(now,
+		bot.Message{Text: "+1", From: user2, Sent: now.Add(-20 * time.Minute)},
+		bot.Message{Text: "iterators\nare nice", From: user2, Sent: now.Add(-10 * time.Minute)},
+		bot.Message{Image: &bot.Image{FileID: "123"}, From: user2, Sent: now.Add(-5 * time.Minute)},
+	)
+
+	digest := &mocks.OpenAIDigest{DigestFunc: func(user bot.User, text string) (string, error) {
+		return "digest of " + text, nil
+	}}
+	su := &bmocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	b := NewTldr(digest, su, TldrParams{LogsPath: logs, Messages: 2, MaxPeriod: time.Hour, MaxSuperPeriod: 24 * time.Hour,
+		CacheTTL: time.Minute})
+	b.nowFn = func() time.Time { return now }
+
+	assert.Equal(t, bot.Response{}, b.OnMessage(bot.Message{Text: "something else"}))
+
+	resp := b.OnMessage(bot.Message{ID: 10, Text: "tldr!", From: user2})
+	assert.Equal(t, bot.Response{Text: "digest of 23:40 User One: go 1.23 released\n00:20 user2: iterators are nice",
+		Send: true, ReplyTo: 10}, resp, "last 2 messages, noise skipped")
+	assert.Equal(t, user2, digest.DigestCalls()[0].User)
+
+	resp = b.OnMessage(bot.Message{ID: 11, Text: "tldr!", From: user1})
+	assert.Equal(t, 11, resp.ReplyTo)
+	assert.Len(t, digest.DigestCalls(), 1, "cached")
+
+	resp = b.OnMessage(bot.Message{ID: 12, Text: "tldr! 30m", From: user1})
+	assert.Equal(t, "digest of 00:20 user2: iterators are nice", resp.Text)
+
+	resp = b.OnMessage(bot.Message{ID: 13, Text: "tldr! 5h", From: user1})
+	assert.Equal(t, "digest of 23:40 User One: go 1.23 released\n00:20 user2: iterators are nice", resp.Text,
+		"limited to an hour for regular users")
+
+	resp = b.OnMessage(bot.Message{ID: 14, Text: "тлдр! 5h", From: bot.User{Username: "admin"}})
+	assert.Equal(t, "digest of 22:30 User One: old news\n23:40 User One: go 1.23 released\n00:20 user2: iterators are nice", resp.Text)
+
+	resp = b.OnMessage(bot.Message{ID: 15, Text: "tldr! 1m", From: user1})
+	assert.Equal(t, bot.Response{Text: "ничего не обсуждали", Send: true, ReplyTo: 15}, resp)
+
+	resp = b.OnMessage(bot.Message{ID: 16, Text: "tldr! вчера", From: user1})
+	assert.Equal(t, bot.Response{Text: "не понял период, например: tldr! 30m", Send: true, ReplyTo: 16}, resp)
+
+	digest.DigestFunc = func(user bot.User, text string) (string, error) { return "", ErrBudgetExhausted }
+	resp = b.OnMessage(bot.Message{ID: 17, Text: "tldr! 15m", From: user1})
+	assert.Equal(t, "На сегодня лимит запросов к ChatGPT исчерпан, приходите завтра 🙏", resp.Text)
+	digest.DigestFunc = func(user bot.User, text string) (string, error) { return "", errors.New("failed") }
+	assert.Equal(t, bot.Response{}, b.OnMessage(bot.Message{ID: 18, Text: "tldr! 20m", From: user1}))
+}
+
+func TestTldr_format(t *testing.T) {
+	b := NewTldr(nil, nil, TldrParams{MaxTokens: 20})
+	sent := time.Date(2024, 5, 4, 10, 0, 0, 0, time.Local)
+	res := b.format([]bot.Message{
+		{Text: "the oldest message is dropped", From: bot.User{Username: "user1"}, Sent: sent},
+		{Text: "short one", From: bot.User{Username: "user2"}, Sent: sent},
+		{Text: "last", Sent: sent},
+	})
+	assert.Equal(t, "10:00 user2: short one\n10:00 bot: last", res)
+}
@@ -0,0 +1,159 @@
+package openai
+
+import (
+	"log"
+	"sync"
+
+	tokenizer "github.com/sandwich-go/gpt3-encoder"
+	"github.com/sashabaranov/go-openai"
+)
+
+// tokensPerMessage is an overhead of chat format for every message, role and separators
+const tokensPerMessage = 4
+
+// imageTokens is a cost of an image in low detail
+const imageTokens = 85
+
+// symbolsPerToken used to estimate tokens if tokenizer is not available
+const symbolsPerToken = 4
+
+// sharedEncoder made once, making it parses the whole BPE vocabulary. Encoder is safe for concurrent use.
+var sharedEncoder struct {
+	once    sync.Once
+	encoder *tokenizer.Encoder
+	err     error
+}
+
+func encoder() (*tokenizer.Encoder, error) {
+	sharedEncoder.once.Do(func() {
+		sharedEncoder.encoder, sharedEncoder.err = tokenizer.NewEncoder()
+		if sharedEncoder.err != nil {
+			log.Printf("[WARN] Can't init tokenizer, tokens will be estimated by symbols: %v", sharedEncoder.err)
+		}
+	})
+	return sharedEncoder.encoder, sharedEncoder.err
+}
+
+// countTokens returns number of tokens in the text, estimated by symbols if tokenizer failed
+func countTokens(text string) int {
+	if enc, err := encoder(); err == nil {
+		if tokens, err := enc.Encode(text); err == nil {
+			return len(tokens)
+		}
+	}
+	return (len(text) + symbolsPerToken - 1) / symbolsPerToken
+}
+
+// truncateTokens cuts the text to maxTokens, or to maxSymbols if tokenizer failed
+func truncateTokens(text string, maxTokens, maxSymbols int) string {
+	defaultReducer := func(text string) string {
+		if maxSymbols <= 0 || len(text) <= maxSymbols {
+			return text
+		}
+		return text[:maxSymbols]
+	}
+
+	enc, err := encoder()
+	if err != nil {
+		return defaultReducer(text)
+	}
+	tokens, err := enc.Encode(text)
+	if err != nil {
+		log.Printf("[WARN] Can't encode request: %v", err)
+		return defaultReducer(text)
+	}
+	if len(tokens) <= maxTokens {
+		return text
+	}
+	if maxTokens <= 0 {
+		return ""
+	}
+	return enc.Decode(tokens[:maxTokens])
+}
+
+// messagesTokens returns number of tokens in messages, including chat format overhead
+func messagesTokens(messages []openai.ChatCompletionMessage) int {
+	res := 0
+	for _, m := range messages {
+		res += messageTokens(m)
+	}
+	return res
+}
+
+// messageTokens returns number of tokens in the message, text parts and images of multi-content and tool calls included
+func messageTokens(m openai.ChatCompletionMessage) int {
+	res := countTokens(m.Content) + tokensPerMessage
+	for _, part := range m.MultiContent {
+		switch part.Type {
+		case openai.ChatMessagePartTypeText:
+			res += countTokens(part.Text)
+		case openai.ChatMessagePartTypeImageURL:
+			res += imageTokens
+		}
+	}
+	for _, call := range m.ToolCalls {
+		res += countTokens(call.Function.Name + call.Function.Arguments)
+	}
+	return res
+}
+
+// fitMessages fits messages into maxTokens budget. Leading system messages and the last message are kept,
+// the oldest turns between them dropped first. If still over the budget, the last message is truncated.
+// maxSymbols used to truncate the last message if tokenizer failed.
+func fitMessages(messages []openai.ChatCompletionMessage, maxTokens, maxSymbols int) []openai.ChatCompletionMessage {
+	if maxTokens <= 0 || len(messages) == 0 {
+		return messages
+	}
+	sys := 0
+	for sys < len(messages)-1 && messages[sys].Role == openai.ChatMessageRoleSystem {
+		sys++
+	}
+	head, turns, last := messages[:sys], messages[sys:len(messages)-1], messages[len(messages)-1]
+
+	budget := maxTokens - messagesTokens(head) - messagesTokens([]openai.ChatCompletionMessage{last})
+	if budget < 0 { // the last message doesn't fit even alone, no room for history
+		last = truncateMessage(last, maxTokens-messagesTokens(head)-tokensPerMessage, maxSymbols)
+		return append(append([]openai.ChatCompletionMessage{}, head...), last)
+	}
+
+	// keep the most recent turns within the budget
+	keep := len(turns)
+	for i := len(turns) - 1; i >= 0; i-- {
+		budget -= messageTokens(turns[i])
+		if budget < 0 {
+			keep = len(turns) - 1 - i
+			break
+		}
+	}
+	if dropped := len(turns) - keep; dropped > 0 {
+		log.Printf("[DEBUG] %d of %d history messages dropped to fit into %d tokens", dropped, len(turns), maxTokens)
+	}
+
+	res := make([]openai.ChatCompletionMessage, 0, len(head)+keep+1)
+	res = append(res, head...)
+	res = append(res, turns[len(turns)-keep:]...)
+	return append(res, last)
+}
+
+// truncateMessage cuts text of the message to maxTokens, images of multi-content message kept and counted
+func truncateMessage(m openai.ChatCompletionMessage, maxTokens, maxSymbols int) openai.ChatCompletionMessage {
+	if len(m.MultiContent) == 0 {
+		m.Content = truncateTokens(m.Content, maxTokens, maxSymbols)
+		return m
+	}
+	parts := make([]openai.ChatMessagePart, len(m.MultiContent))
+	copy(parts, m.MultiContent)
+	for _, part := range parts {
+		if part.Type == openai.ChatMessagePartTypeImageURL {
+			maxTokens -= imageTokens
+		}
+	}
+	for i, part := range parts {
+		if part.Type == openai.ChatMessagePartTypeText {
+			parts[i].Text = truncateTokens(part.Text, max(maxTokens, 0), maxSymbols)
+			maxTokens -= countTokens(parts[i].Text)
+		}
+	}
+	m.MultiContent = parts
+	return m
+}
@@ -0,0 +1,79 @@
+package openai
+
+import (
+	"strings"
+	"testing"
+
+	ai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountTokens(t *testing.T) {
+	assert.Equal(t, 0, countTokens(""))
+	assert.Equal(t, 2, countTokens("hello world"))
+	assert.Equal(t, 20, countTokens(strings.TrimSpace(strings.Repeat("word ", 20))))
+
+	enc1, err := encoder()
+	require.NoError(t, err)
+	enc2, err := encoder()
+	require.NoError(t, err)
+	assert.Same(t, enc1, enc2, "encoder is shared")
+}
+
+func TestTruncateTokens(t *testing.T) {
+	assert.Equal(t, "hello world", truncateTokens("hello world", 10, 5))
+	assert.Equal(t, "hello", truncateTokens("hello world", 1, 5))
+	assert.Equal(t, "", truncateTokens("hello world", 0, 5))
+}
+
+func TestFitMessages(t *testing.T) {
+	sys := ai.ChatCompletionMessage{Role: ai.ChatMessageRoleSystem, Content: "system prompt"} // 2 tokens + 4
+	turn := func(role, text string) ai.ChatCompletionMessage {
+		return ai.ChatCompletionMessage{Role: role, Content: text}
+	}
+	messages := []ai.ChatCompletionMessage{
+		sys,
+		turn(ai.ChatMessageRoleUser, "first question"),    // 2 + 4
+		turn(ai.ChatMessageRoleAssistant, "first answer"), // 2 + 4
+		turn(ai.ChatMessageRoleUser, "second question"),   // 2 + 4
+	}
+	assert.Equal(t, 24, messagesTokens(messages))
+
+	tbl := []struct {
+		name      string
+		maxTokens int
+		exp       []ai.ChatCompletionMessage
+	}{
+		{"fits", 24, messages},
+		{"no limit", 0, messages},
+		{"oldest dropped", 23, []ai.ChatCompletionMessage{sys, messages[2], messages[3]}},
+		{"history dropped", 12, []ai.ChatCompletionMessage{sys, messages[3]}},
+		{"last truncated", 11, []ai.ChatCompletionMessage{sys, turn(ai.ChatMessageRoleUser, "second")}},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.exp, fitMessages(messages, tt.maxTokens, 100))
+		})
+	}
+
+	assert.Equal(t, messages[3:], fitMessages(messages[3:], 100, 100), "single message")
+}
+
+func TestFitMessages_Image(t *testing.T) {
+	sys := ai.ChatCompletionMessage{Role: ai.ChatMessageRoleSystem, Content: "system prompt"} // 2 tokens + 4
+	last := ai.ChatCompletionMessage{Role: ai.ChatMessageRoleUser, MultiContent: []ai.ChatMessagePart{
+		{Type: ai.ChatMessagePartTypeText, Text: "second question"}, // 2 tokens
+		{Type: ai.ChatMessagePartTypeImageURL, ImageURL: &ai.ChatMessageImageURL{URL: "data:image/png;base64,AAAA"}},
+	}}
+	messages := []ai.ChatCompletionMessage{sys, {Role: ai.ChatMessageRoleUser, Content: "first question"}, last}
+	assert.Equal(t, 6+6+4+2+imageTokens, messagesTokens(messages))
+
+	assert.Equal(t, []ai.ChatCompletionMessage{sys, last}, fitMessages(messages, 6+4+2+imageTokens, 100), "history dropped")
+
+	res := fitMessages(messages, 6+4+1+imageTokens, 100)
+	require.Len(t, res, 2)
+	assert.Equal(t, "second", res[1].MultiContent[0].Text, "text truncated")
+	assert.Equal(t, last.MultiContent[1], res[1].MultiContent[1], "image kept")
+	assert.Equal(t, "second question", last.MultiContent[0].Text, "original not changed")
+}
@@ -0,0 +1,152 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+
+	"github.com/radio-t/super-bot/app/bot"
+)
+
+// maxToolResultTokens limits result of a tool call sent back to the model
+const maxToolResultTokens = 1000
+
+// Tool is a function the model may call to get facts it can't know, like the schedule of the show.
+// Result is sent back to the model to compose the final answer.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  jsonschema.Definition
+	Call        func(args string) (string, error) // args is JSON object described by Parameters
+}
+
+// noParams is a schema of a tool without arguments
+var noParams = jsonschema.Definition{Type: jsonschema.Object}
+
+// ScheduleTool tells when the previous show was and the next one will be, and if the show is on air now
+func ScheduleTool(w *bot.When) Tool {
+	return Tool{
+		Name:        "show_schedule",
+		Description: "Schedule of Radio-T podcast live show: start of the previous and the next shows, and if the show is live now",
+		Parameters:  noParams,
+		Call: func(string) (string, error) {
+			now := time.Now().UTC()
+			prev, next, live := w.Schedule(now)
+			res, err := json.Marshal(struct {
+				Now          time.Time `json:"now"`
+				PreviousShow time.Time `json:"previous_show"`
+				NextShow     time.Time `json:"next_show"`
+				Live         bool      `json:"live"`
+			}{now, prev, next, live})
+			return string(res), err
+		},
+	}
+}
+
+// PodcastsTool searches show notes of Radio-T episodes
+func PodcastsTool(p *bot.Podcasts) Tool {
+	return Tool{
+		Name:        "search_podcasts",
+		Description: "Search show notes of Radio-T podcast episodes, returns matching episodes with numbers, dates and topics",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"query": {Type: jsonschema.String, Description: "a word or a short phrase to search for, like rust"},
+			},
+			Required: []string{"query"},
+		},
+		Call: func(args string) (string, error) {
+			var req struct {
+				Query string `json:"query"`
+			}
+			if err := json.Unmarshal([]byte(args), &req); err != nil {
+				return "", fmt.Errorf("can't parse arguments %q: %w", args, err)
+			}
+			if strings.TrimSpace(req.Query) == "" {
+				return "", fmt.Errorf("empty query")
+			}
+			return p.Search(strings.TrimSpace(req.Query))
+		},
+	}
+}
+
+// NewsTool returns the latest news collected for the next show
+func NewsTool(n *bot.News) Tool {
+	return Tool{
+		Name:        "latest_news",
+		Description: "The latest news and topics collected for the next Radio-T show",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"count": {Type: jsonschema.Integer, Description: "number of news, the default is all available"},
+			},
+		},
+		Call: func(args string) (string, error) {
+			var req struct {
+				Count int `json:"count"`
+			}
+			if args != "" {
+				if err := json.Unmarshal([]byte(args), &req); err != nil {
+					return "", fmt.Errorf("can't parse arguments %q: %w", args, err)
+				}
+			}
+			return n.Last(req.Count)
+		},
+	}
+}
+
+// HostsTimeTool tells local time of the hosts
+func HostsTimeTool(w *bot.WhatsTheTime) Tool {
+	return Tool{
+		Name:        "hosts_local_time",
+		Description: "Current local time of Radio-T hosts",
+		Parameters:  noParams,
+		Call: func(string) (string, error) {
+			return w.HostsTime(time.Now()), nil
+		},
+	}
+}
+
+// openAITools makes definitions of the tools for the request
+func openAITools(tools []Tool) []openai.Tool {
+	res := make([]openai.Tool, 0, len(tools))
+	for _, t := range tools {
+		res = append(res, openai.Tool{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+			Name: t.Name, Description: t.Description, Parameters: t.Parameters}})
+	}
+	return res
+}
+
+// callTool calls the tool requested by the model and returns the result for the model.
+// Errors are returned as the result, so the model can tell the user it failed.
+func callTool(tools []Tool, call openai.ToolCall) (res string) {
+	defer func() { // tools call other bots, don't let them crash the request
+		if r := recover(); r != nil {
+			log.Printf("[WARN] tool %s panicked: %v", call.Function.Name, r)
+			res = "error: tool failed"
+		}
+	}()
+
+	for _, t := range tools {
+		if t.Name != call.Function.Name {
+			continue
+		}
+		log.Printf("[DEBUG] call tool %s with %s", t.Name, call.Function.Arguments)
+		out, err := t.Call(call.Function.Arguments)
+		if err != nil {
+			log.Printf("[WARN] tool %s failed: %v", t.Name, err)
+			return "error: " + err.Error()
+		}
+		if strings.TrimSpace(out) == "" {
+			return "nothing found"
+		}
+		return truncateTokens(out, maxToolResultTokens, maxToolResultTokens*symbolsPerToken)
+	}
+	log.Printf("[WARN] unknown tool %s requested", call.Function.Name)
+	return "error: unknown tool " + call.Function.Name
+}
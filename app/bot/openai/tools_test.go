@@ -0,0 +1,115 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	ai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot"
+	bmocks "github.com/radio-t/super-bot/app/bot/mocks"
+)
+
+func TestScheduleTool(t *testing.T) {
+	tool := ScheduleTool(bot.NewWhen())
+	res, err := tool.Call("{}")
+	require.NoError(t, err)
+
+	var schedule struct {
+		Now          time.Time `json:"now"`
+		PreviousShow time.Time `json:"previous_show"`
+		NextShow     time.Time `json:"next_show"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(res), &schedule))
+	assert.True(t, schedule.NextShow.After(schedule.Now))
+	assert.False(t, schedule.PreviousShow.After(schedule.Now))
+	assert.Equal(t, time.Saturday, schedule.NextShow.Weekday())
+	assert.Equal(t, 20, schedule.NextShow.Hour())
+}
+
+func TestPodcastsTool(t *testing.T) {
+	client := &bmocks.HTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		body := `[{"url":"https://radio-t.com/p/1","show_num":123,"date":"2024-05-04T20:00:00Z",` +
+			`"show_notes":"Rust в ядре\nЧто нового в Go","body":"<li><a href=\"https://example.com/rust\">x</a>"}]`
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}, nil
+	}}
+	tool := PodcastsTool(bot.NewPodcasts(client, "http://example.com", 5))
+
+	res, err := tool.Call(`{"query":"Rust"}`)
+	require.NoError(t, err)
+	assert.Contains(t, res, "Радио-Т #123")
+	assert.Contains(t, res, "[Rust в ядре](https://example.com/rust)")
+	assert.NotContains(t, res, "Go")
+	require.Len(t, client.DoCalls(), 1)
+	assert.Equal(t, "Rust", client.DoCalls()[0].Req.URL.Query().Get("q"))
+
+	_, err = tool.Call(`{"query":" "}`)
+	assert.Error(t, err)
+	_, err = tool.Call(`not json`)
+	assert.Error(t, err)
+	assert.Len(t, client.DoCalls(), 1)
+}
+
+func TestNewsTool(t *testing.T) {
+	client := &bmocks.HTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		return &http.Response{Body: io.NopCloser(bytes.NewReader([]byte(`[{"title":"news","link":"link"}]`)))}, nil
+	}}
+	tool := NewsTool(bot.NewNews(client, "http://example.com", 5))
+
+	res, err := tool.Call(`{"count":2}`)
+	require.NoError(t, err)
+	assert.Equal(t, "- [news](link) 0001-01-01", res)
+	_, err = tool.Call("")
+	require.NoError(t, err)
+
+	calls := client.DoCalls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, "http://example.com/v1/news/last/2", calls[0].Req.URL.String())
+	assert.Equal(t, "http://example.com/v1/news/last/5", calls[1].Req.URL.String())
+}
+
+func TestHostsTimeTool(t *testing.T) {
+	w, err := bot.NewWhatsTheTime("../../../data")
+	require.NoError(t, err)
+	res, err := HostsTimeTool(w).Call("{}")
+	require.NoError(t, err)
+	assert.Contains(t, res, "У Umputun сейчас ")
+}
+
+func TestCallTool(t *testing.T) {
+	tools := []Tool{
+		{Name: "echo", Call: func(args string) (string, error) { return "echo " + args, nil }},
+		{Name: "fail", Call: func(string) (string, error) { return "", errors.New("broken") }},
+		{Name: "empty", Call: func(string) (string, error) { return " ", nil }},
+		{Name: "panic", Call: func(string) (string, error) { panic("oops") }},
+		{Name: "long", Call: func(string) (string, error) { return strings.Repeat("word ", 2000), nil }},
+	}
+	call := func(name, args string) string {
+		return callTool(tools, ai.ToolCall{ID: "1", Type: ai.ToolTypeFunction, Function: ai.FunctionCall{Name: name, Arguments: args}})
+	}
+
+	assert.Equal(t, `echo {"a":1}`, call("echo", `{"a":1}`))
+	assert.Equal(t, "error: broken", call("fail", "{}"))
+	assert.Equal(t, "nothing found", call("empty", "{}"))
+	assert.Equal(t, "error: tool failed", call("panic", "{}"))
+	assert.Equal(t, "error: unknown tool other", call("other", "{}"))
+	assert.Equal(t, maxToolResultTokens, countTokens(call("long", "{}")))
+}
+
+func TestOpenAITools(t *testing.T) {
+	res := openAITools([]Tool{ScheduleTool(bot.NewWhen()), {Name: "other", Parameters: noParams}})
+	require.Len(t, res, 2)
+	assert.Equal(t, ai.ToolTypeFunction, res[0].Type)
+	assert.Equal(t, "show_schedule", res[0].Function.Name)
+	data, err := json.Marshal(res[1].Function)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"other","parameters":{"type":"object"}}`, string(data))
+}
@@ -0,0 +1,285 @@
+package openai
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// features of the bot tracked by Usage
+const (
+	FeatureChat    = "chat"    // chat! requests and conversations on replies
+	FeatureAuto    = "auto"    // auto-responses to the chat
+	FeatureSummary = "summary" // summaries of links
+	FeatureDigest  = "digest"  // digests of chat discussion, tldr!
+)
+
+// maxUsageUsers limits number of users in usage report
+const maxUsageUsers = 10
+
+// usageDays is a number of days kept in memory and in the file, usage! reports them
+const usageDays = 7
+
+// UsageRecord is tokens spent on a single request to the API
+type UsageRecord struct {
+	Time             time.Time `json:"time"`
+	User             bot.User  `json:"user"` // empty for requests not made by users, like summaries
+	Feature          string    `json:"feature"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+}
+
+// UsageStats is an aggregated usage
+type UsageStats struct {
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Tokens returns total tokens, prompt and completion
+func (s UsageStats) Tokens() int {
+	return s.PromptTokens + s.CompletionTokens
+}
+
+func (s *UsageStats) add(rec UsageRecord) {
+	s.Requests++
+	s.PromptTokens += rec.PromptTokens
+	s.CompletionTokens += rec.CompletionTokens
+}
+
+// UsageParams defines daily token budgets, 0 means unlimited
+type UsageParams struct {
+	UserDailyTokens int // per user, superusers are not limited
+	DailyTokens     int // for all requests together
+}
+
+// Usage keeps tokens spent per user, day and feature for the last usageDays, and checks daily budgets.
+// Records are persisted to JSONL file, older ones are dropped from it on load and when a new day starts.
+// Day boundaries are in local time. Thread safe.
+type Usage struct {
+	UsageParams
+	file *storage.JSONL[UsageRecord]
+
+	lock  sync.Mutex
+	days  map[string]*usageDay // day as 2006-01-02 -> usage
+	since string               // the first day kept, as 2006-01-02
+}
+
+type usageDay struct {
+	total    UsageStats
+	features map[string]*UsageStats
+	users    map[int64]*UsageStats
+	names    map[int64]string // user id -> last known name
+}
+
+// NewUsage loads usage from the file, in-memory only if path is empty
+func NewUsage(path string, params UsageParams) (*Usage, error) {
+	res := &Usage{UsageParams: params, days: map[string]*usageDay{}}
+	if path == "" {
+		return res, nil
+	}
+	file, err := storage.NewJSONL[UsageRecord](path)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := file.Load()
+	if err != nil {
+		return nil, fmt.Errorf("can't load usage: %w", err)
+	}
+	trim := false
+	for _, rec := range recs {
+		trim = res.aggregate(rec) || trim
+	}
+	res.file = file
+	if trim {
+		if err := res.trim(recs); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("[INFO] loaded %d OpenAI usage records from %s, budgets: %+v", len(recs), path, params)
+	return res, nil
+}
+
+// Add records tokens spent
+func (u *Usage) Add(rec UsageRecord) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	trim := u.aggregate(rec)
+	if u.file == nil {
+		return nil
+	}
+	if err := u.file.Append(rec); err != nil {
+		return fmt.Errorf("can't save usage: %w", err)
+	}
+	if !trim {
+		return nil
+	}
+	recs, err := u.file.Load()
+	if err != nil {
+		return fmt.Errorf("can't load usage: %w", err)
+	}
+	return u.trim(recs)
+}
+
+// trim rewrites the file with records of the days kept only, should be called under lock
+func (u *Usage) trim(recs []UsageRecord) error {
+	kept := make([]UsageRecord, 0, len(recs))
+	for _, rec := range recs {
+		if usageDayKey(rec.Time) >= u.since {
+			kept = append(kept, rec)
+		}
+	}
+	if err := u.file.Replace(kept); err != nil {
+		return fmt.Errorf("can't trim usage: %w", err)
+	}
+	log.Printf("[DEBUG] OpenAI usage trimmed to %d records since %s", len(kept), u.since)
+	return nil
+}
+
+// Day returns usage for the day of the given time, total and for the user
+func (u *Usage) Day(t time.Time, userID int64) (total, user UsageStats) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	d, found := u.days[usageDayKey(t)]
+	if !found {
+		return UsageStats{}, UsageStats{}
+	}
+	if s, ok := d.users[userID]; ok && userID != 0 {
+		user = *s
+	}
+	return d.total, user
+}
+
+// Exhausted checks if daily budget is spent, overall or by the user. User's budget is not checked for userID 0
+func (u *Usage) Exhausted(now time.Time, userID int64) (overall, user bool) {
+	total, byUser := u.Day(now, userID)
+	overall = u.DailyTokens > 0 && total.Tokens() >= u.DailyTokens
+	user = u.UserDailyTokens > 0 && userID != 0 && byUser.Tokens() >= u.UserDailyTokens
+	return overall, user
+}
+
+// Report returns usage for the day of now and total for the given number of days, in markdown
+func (u *Usage) Report(now time.Time, days int) string {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	sb := strings.Builder{}
+	d, found := u.days[usageDayKey(now)]
+	if !found {
+		d = &usageDay{}
+	}
+	sb.WriteString(fmt.Sprintf("*расход токенов сегодня:* %d, запросов %d", d.total.Tokens(), d.total.Requests))
+	if u.DailyTokens > 0 {
+		sb.WriteString(fmt.Sprintf(", лимит %d", u.DailyTokens))
+	}
+	sb.WriteString("\n")
+
+	if len(d.features) > 0 {
+		features := make([]string, 0, len(d.features))
+		for f := range d.features {
+			features = append(features, f)
+		}
+		sort.Strings(features)
+		parts := make([]string, 0, len(features))
+		for _, f := range features {
+			parts = append(parts, fmt.Sprintf("%s %d", f, d.features[f].Tokens()))
+		}
+		sb.WriteString(bot.EscapeMarkDownV1Text(strings.Join(parts, ", ")) + "\n")
+	}
+
+	if len(d.users) > 0 {
+		ids := make([]int64, 0, len(d.users))
+		for id := range d.users {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			if d.users[ids[i]].Tokens() != d.users[ids[j]].Tokens() {
+				return d.users[ids[i]].Tokens() > d.users[ids[j]].Tokens()
+			}
+			return ids[i] < ids[j]
+		})
+		if len(ids) > maxUsageUsers {
+			ids = ids[:maxUsageUsers]
+		}
+		parts := make([]string, 0, len(ids))
+		for _, id := range ids {
+			parts = append(parts, fmt.Sprintf("%s %d", d.names[id], d.users[id].Tokens()))
+		}
+		limit := ""
+		if u.UserDailyTokens > 0 {
+			limit = fmt.Sprintf(" (лимит %d)", u.UserDailyTokens)
+		}
+		sb.WriteString("пользователи" + limit + ": " + bot.EscapeMarkDownV1Text(strings.Join(parts, ", ")) + "\n")
+	}
+
+	if days > 1 {
+		var total UsageStats
+		for i := 0; i < days; i++ {
+			if d, ok := u.days[usageDayKey(now.AddDate(0, 0, -i))]; ok {
+				total.Requests += d.total.Requests
+				total.PromptTokens += d.total.PromptTokens
+				total.CompletionTokens += d.total.CompletionTokens
+			}
+		}
+		sb.WriteString(fmt.Sprintf("за %d дн.: %d, запросов %d\n", days, total.Tokens(), total.Requests))
+	}
+	return sb.String()
+}
+
+// aggregate adds record to daily stats, should be called under lock. Days out of usageDays
+// before the latest record are dropped, returns true if any dropped or the record is too old itself.
+func (u *Usage) aggregate(rec UsageRecord) (dropped bool) {
+	if since := usageDayKey(rec.Time.AddDate(0, 0, 1-usageDays)); since > u.since {
+		u.since = since
+		for day := range u.days {
+			if day < since {
+				delete(u.days, day)
+				dropped = true
+			}
+		}
+	}
+	key := usageDayKey(rec.Time)
+	if key < u.since {
+		return true
+	}
+	d, found := u.days[key]
+	if !found {
+		d = &usageDay{features: map[string]*UsageStats{}, users: map[int64]*UsageStats{}, names: map[int64]string{}}
+		u.days[key] = d
+	}
+	d.total.add(rec)
+	if _, ok := d.features[rec.Feature]; !ok {
+		d.features[rec.Feature] = &UsageStats{}
+	}
+	d.features[rec.Feature].add(rec)
+	if rec.User.ID == 0 {
+		return dropped
+	}
+	if _, ok := d.users[rec.User.ID]; !ok {
+		d.users[rec.User.ID] = &UsageStats{}
+	}
+	d.users[rec.User.ID].add(rec)
+	d.names[rec.User.ID] = usageUserName(rec.User)
+	return dropped
+}
+
+func usageDayKey(t time.Time) string {
+	return t.Local().Format("2006-01-02")
+}
+
+func usageUserName(u bot.User) string {
+	if u.Username != "" {
+		return "@" + u.Username
+	}
+	if strings.TrimSpace(u.DisplayName) != "" {
+		return strings.TrimSpace(u.DisplayName)
+	}
+	return fmt.Sprintf("id:%d", u.ID)
+}
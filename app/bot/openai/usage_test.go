@@ -0,0 +1,73 @@
+package openai
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot"
+)
+
+func TestUsage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	u, err := NewUsage(path, UsageParams{UserDailyTokens: 100, DailyTokens: 250})
+	require.NoError(t, err)
+
+	day := time.Date(2024, 5, 4, 12, 0, 0, 0, time.Local)
+	user1 := bot.User{ID: 1, Username: "user1"}
+	user2 := bot.User{ID: 2, DisplayName: "User Two"}
+	require.NoError(t, u.Add(UsageRecord{Time: day.AddDate(0, 0, -10), User: user1, Feature: FeatureChat, PromptTokens: 1000}))
+	require.NoError(t, u.Add(UsageRecord{Time: day.AddDate(0, 0, -1), User: user1, Feature: FeatureChat, PromptTokens: 90, CompletionTokens: 10}))
+	require.NoError(t, u.Add(UsageRecord{Time: day, User: user1, Feature: FeatureChat, PromptTokens: 50, CompletionTokens: 10}))
+	require.NoError(t, u.Add(UsageRecord{Time: day, User: user2, Feature: FeatureChat, PromptTokens: 80, CompletionTokens: 20}))
+	require.NoError(t, u.Add(UsageRecord{Time: day, Feature: FeatureSummary, PromptTokens: 30, CompletionTokens: 10}))
+
+	total, byUser := u.Day(day, 1)
+	assert.Equal(t, UsageStats{Requests: 3, PromptTokens: 160, CompletionTokens: 40}, total)
+	assert.Equal(t, 60, byUser.Tokens())
+
+	overall, user := u.Exhausted(day, 1)
+	assert.False(t, overall)
+	assert.False(t, user)
+	overall, user = u.Exhausted(day, 2)
+	assert.False(t, overall)
+	assert.True(t, user, "user2 spent 100 of 100")
+	_, user = u.Exhausted(day, 0)
+	assert.False(t, user, "no personal budget without user")
+
+	require.NoError(t, u.Add(UsageRecord{Time: day, Feature: FeatureAuto, PromptTokens: 50}))
+	overall, _ = u.Exhausted(day, 1)
+	assert.True(t, overall, "250 of 250 spent")
+	overall, _ = u.Exhausted(day.AddDate(0, 0, 1), 1)
+	assert.False(t, overall, "next day")
+
+	assert.Equal(t, "*расход токенов сегодня:* 250, запросов 4, лимит 250\n"+
+		"auto 50, chat 160, summary 40\n"+
+		"пользователи (лимит 100): User Two 100, @user1 60\n"+
+		"за 7 дн.: 350, запросов 5\n", u.Report(day, 7))
+
+	total, _ = u.Day(day.AddDate(0, 0, -10), 0)
+	assert.Equal(t, 0, total.Tokens(), "out of the report window, dropped")
+
+	// reloaded from the file
+	u, err = NewUsage(path, UsageParams{})
+	require.NoError(t, err)
+	total, _ = u.Day(day, 0)
+	assert.Equal(t, 250, total.Tokens())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 5, strings.Count(string(data), "\n"), "old record trimmed from the file")
+
+	require.NoError(t, u.Add(UsageRecord{Time: day.AddDate(0, 0, 7), Feature: FeatureAuto, PromptTokens: 10}))
+	total, _ = u.Day(day, 0)
+	assert.Equal(t, 0, total.Tokens(), "new day, the week before dropped")
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "\n"), "file trimmed on the new day")
+	assert.Equal(t, "*расход токенов сегодня:* 0, запросов 0\n", u.Report(day.AddDate(0, 0, 10), 1))
+}
@@ -57,34 +57,68 @@ func (p *Podcasts) OnMessage(msg Message) (response Response) {
 		return Response{}
 	}
 
-	reqURL := fmt.Sprintf("%s/search?limit=%d&q=%s", p.siteAPI, p.maxResults, url.QueryEscape(reqText))
-	req, err := http.NewRequest("GET", reqURL, http.NoBody)
+	text, err := p.Search(reqText)
 	if err != nil {
-		log.Printf("[WARN] failed to make request %s, error=%v", reqURL, err)
+		log.Printf("[WARN] %v", err)
 		return Response{}
 	}
+	return Response{
+		Text: text,
+		Send: true,
+	}
+}
+
+// Search returns episodes with show notes matching the query, in markdown
+func (p *Podcasts) Search(query string) (string, error) {
+	reqURL := fmt.Sprintf("%s/search?limit=%d&q=%s", p.siteAPI, p.maxResults, url.QueryEscape(query))
+	req, err := http.NewRequest("GET", reqURL, http.NoBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to make request %s: %w", reqURL, err)
+	}
 
 	resp, err := p.client.Do(req)
 	if err != nil {
-		log.Printf("[WARN] failed to send request %s, error=%v", reqURL, err)
-		return Response{}
+		return "", fmt.Errorf("failed to send request %s: %w", reqURL, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("[WARN] request %s returned %s", reqURL, resp.Status)
-		return Response{}
+		return "", fmt.Errorf("request %s returned %s", reqURL, resp.Status)
 	}
 
 	sr := []siteAPIResp{}
 	if err := json.NewDecoder(resp.Body).Decode(&sr); err != nil {
-		log.Printf("[WARN] failed to parse response from %s, error=%v", reqURL, err)
-		return Response{}
+		return "", fmt.Errorf("failed to parse response from %s: %w", reqURL, err)
 	}
-	return Response{
-		Text: p.makeBotResponse(sr, reqText),
-		Send: true,
+	return p.makeBotResponse(sr, query), nil
+}
+
+// LastShow returns number of the latest released show, via /last/1?categories=podcast
+func (p *Podcasts) LastShow() (int, error) {
+	reqURL := fmt.Sprintf("%s/last/1?categories=podcast", p.siteAPI)
+	req, err := http.NewRequest("GET", reqURL, http.NoBody)
+	if err != nil {
+		return 0, fmt.Errorf("failed to make request %s: %w", reqURL, err)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send request %s: %w", reqURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("request %s returned %s", reqURL, resp.Status)
+	}
+
+	sr := []siteAPIResp{}
+	if err := json.NewDecoder(resp.Body).Decode(&sr); err != nil {
+		return 0, fmt.Errorf("failed to parse response from %s: %w", reqURL, err)
+	}
+	if len(sr) == 0 || sr[0].ShowNum == 0 {
+		return 0, fmt.Errorf("no shows in response from %s", reqURL)
 	}
+	return sr[0].ShowNum, nil
 }
 
 func (p *Podcasts) makeBotResponse(sr []siteAPIResp, reqText string) string {
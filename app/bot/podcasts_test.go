@@ -182,3 +182,31 @@ func TestPodcasts_notesWithLinks2(t *testing.T) {
 	}
 	assert.Equal(t, exp, r)
 }
+
+func TestPodcasts_LastShow(t *testing.T) {
+	shows := []siteAPIResp{{URL: "http://example.com", ShowNum: 915}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/last/1" || r.URL.RawQuery != "categories=podcast" {
+			w.WriteHeader(400)
+			return
+		}
+		b, err := json.Marshal(shows)
+		require.NoError(t, err)
+		_, err = w.Write(b)
+		assert.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	d := NewPodcasts(&http.Client{Timeout: time.Second}, ts.URL, 5)
+	num, err := d.LastShow()
+	require.NoError(t, err)
+	assert.Equal(t, 915, num)
+
+	shows = nil
+	_, err = d.LastShow()
+	assert.Error(t, err)
+
+	d = NewPodcasts(&http.Client{Timeout: time.Second}, ts.URL+"/bad", 5)
+	_, err = d.LastShow()
+	assert.Error(t, err)
+}
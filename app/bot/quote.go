@@ -0,0 +1,304 @@
+package bot
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// Quote is a saved chat message. Quotes imported from say.data have no author, date and link
+type Quote struct {
+	Text    string    `json:"text"`
+	Author  User      `json:"author,omitempty"`
+	Date    time.Time `json:"date,omitempty"`
+	Link    string    `json:"link,omitempty"`
+	AddedBy string    `json:"added_by,omitempty"`
+}
+
+// QuoteStore keeps quotes in memory and persists them to jsonl file
+type QuoteStore struct {
+	file   *storage.JSONL[Quote]
+	lock   sync.RWMutex
+	quotes []Quote
+}
+
+// NewQuoteStore loads quotes from the file
+func NewQuoteStore(path string) (*QuoteStore, error) {
+	file, err := storage.NewJSONL[Quote](path)
+	if err != nil {
+		return nil, err
+	}
+	quotes, err := file.Load()
+	if err != nil {
+		return nil, fmt.Errorf("can't load quotes: %w", err)
+	}
+	log.Printf("[INFO] loaded %d quotes from %s", len(quotes), path)
+	return &QuoteStore{file: file, quotes: quotes}, nil
+}
+
+// Add saves quote, returns false if the same quote already saved
+func (s *QuoteStore) Add(q Quote) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, existing := range s.quotes {
+		if (q.Link != "" && existing.Link == q.Link) || existing.Text == q.Text {
+			return false, nil
+		}
+	}
+	if err := s.file.Append(q); err != nil {
+		return false, fmt.Errorf("can't save quote: %w", err)
+	}
+	s.quotes = append(s.quotes, q)
+	return true, nil
+}
+
+// Import adds lines as authorless quotes, returns number of imported quotes
+func (s *QuoteStore) Import(lines []string) (int, error) {
+	count := 0
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		added, err := s.Add(Quote{Text: line})
+		if err != nil {
+			return count, err
+		}
+		if added {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Len returns number of quotes
+func (s *QuoteStore) Len() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.quotes)
+}
+
+// Random returns a random quote
+func (s *QuoteStore) Random() (Quote, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if len(s.quotes) == 0 {
+		return Quote{}, false
+	}
+	return s.quotes[rand.Intn(len(s.quotes))], true // nolint
+}
+
+// Search returns quotes by author's username (if set) containing text (if set), case-insensitive
+func (s *QuoteStore) Search(username, text string) []Quote {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	res := []Quote{}
+	text = strings.ToLower(text)
+	for _, q := range s.quotes {
+		if username != "" && !strings.EqualFold(q.Author.Username, username) {
+			continue
+		}
+		if text != "" && !strings.Contains(strings.ToLower(q.Text), text) {
+			continue
+		}
+		res = append(res, q)
+	}
+	return res
+}
+
+// Export writes all quotes in markdown, one per line
+func (s *QuoteStore) Export(w io.Writer) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, q := range s.quotes {
+		line := "- " + q.Text
+		if q.Author.Username != "" || q.Author.DisplayName != "" {
+			line += " — " + DisplayName(Message{From: q.Author})
+		}
+		if !q.Date.IsZero() {
+			line += ", " + q.Date.Format("2006-01-02")
+		}
+		if q.Link != "" {
+			line += fmt.Sprintf(" ([ссылка](%s))", q.Link)
+		}
+		if _, err := io.WriteString(w, strings.ReplaceAll(line, "\n", " ")+"\n"); err != nil {
+			return fmt.Errorf("can't write quote: %w", err)
+		}
+	}
+	return nil
+}
+
+// Quotes bot saves messages replied with quote! and searches saved quotes.
+// Superusers save a quote immediately, others need votes from a few users.
+type Quotes struct {
+	store     *QuoteStore
+	superUser SuperUser
+	votes     int    // number of distinct users to save a quote, 0 disables voting
+	group     string // chat username or id, used to make links to messages
+
+	lock    sync.Mutex
+	pending map[int]quoteVotes // message id -> votes
+}
+
+// quoteVotes keeps users voted for a message and time of the first vote
+type quoteVotes struct {
+	users map[int64]bool
+	start time.Time
+}
+
+// maxQuotesFound limits number of quotes in search response
+const maxQuotesFound = 3
+
+// quoteVotesTTL limits time to collect votes for a message, stale votes are dropped
+const quoteVotesTTL = 24 * time.Hour
+
+// NewQuotes makes a quote bot
+func NewQuotes(store *QuoteStore, superUser SuperUser, votes int, group string) *Quotes {
+	log.Printf("[INFO] quotes bot, votes=%d, group=%s", votes, group)
+	return &Quotes{store: store, superUser: superUser, votes: votes, group: group, pending: map[int]quoteVotes{}}
+}
+
+// Help returns help message
+func (q *Quotes) Help() string {
+	return GenHelpMsg(q.ReactOn(), "сохранить цитату (ответом на сообщение) или найти: quote! @user, quote! текст")
+}
+
+// ReactOn keys
+func (q *Quotes) ReactOn() []string {
+	return []string{"quote!", "цитата!"}
+}
+
+// OnMessage saves replied message as a quote or searches quotes
+func (q *Quotes) OnMessage(msg Message) (response Response) {
+	ok, req := q.request(msg.Text)
+	if !ok {
+		return Response{}
+	}
+
+	if msg.ReplyTo.ID != 0 && req == "" {
+		return q.save(msg)
+	}
+
+	var found []Quote
+	switch {
+	case req == "":
+		if rq, ok := q.store.Random(); ok {
+			found = []Quote{rq}
+		}
+	case strings.HasPrefix(req, "@"):
+		found = q.store.Search(strings.TrimPrefix(req, "@"), "")
+	default:
+		found = q.store.Search("", req)
+	}
+
+	if len(found) == 0 {
+		return Response{Text: "цитат не найдено", Send: true, ReplyTo: msg.ID}
+	}
+
+	rand.Shuffle(len(found), func(i, j int) { found[i], found[j] = found[j], found[i] })
+	lines := make([]string, 0, maxQuotesFound)
+	for i := 0; i < len(found) && i < maxQuotesFound; i++ {
+		lines = append(lines, renderQuote(found[i]))
+	}
+	return Response{Text: strings.Join(lines, "\n\n"), Send: true}
+}
+
+func (q *Quotes) save(msg Message) Response {
+	if strings.TrimSpace(msg.ReplyTo.Text) == "" {
+		return Response{}
+	}
+
+	if !q.superUser.IsSuper(msg.From.Username) {
+		if q.votes <= 0 || msg.From.ID == 0 || msg.From.ID == msg.ReplyTo.From.ID {
+			return Response{} // voting disabled, or self-quote
+		}
+		q.lock.Lock()
+		now := time.Now()
+		for id, v := range q.pending {
+			if now.Sub(v.start) > quoteVotesTTL {
+				delete(q.pending, id)
+			}
+		}
+		v, ok := q.pending[msg.ReplyTo.ID]
+		if !ok {
+			v = quoteVotes{users: map[int64]bool{}, start: now}
+			q.pending[msg.ReplyTo.ID] = v
+		}
+		v.users[msg.From.ID] = true
+		voted := len(v.users)
+		if voted >= q.votes {
+			delete(q.pending, msg.ReplyTo.ID)
+		}
+		q.lock.Unlock()
+		if voted < q.votes {
+			return Response{Text: fmt.Sprintf("голос за цитату учтен, %d из %d", voted, q.votes), Send: true, ReplyTo: msg.ID}
+		}
+	}
+
+	quote := Quote{
+		Text:    msg.ReplyTo.Text,
+		Author:  msg.ReplyTo.From,
+		Date:    msg.ReplyTo.Sent,
+		Link:    MessageLink(q.group, msg.ChatID, msg.ReplyTo.ID),
+		AddedBy: msg.From.Username,
+	}
+	added, err := q.store.Add(quote)
+	if err != nil {
+		log.Printf("[WARN] failed to save quote %+v, %v", quote, err)
+		return Response{}
+	}
+	if !added {
+		return Response{Text: "эта цитата уже сохранена", Send: true, ReplyTo: msg.ID}
+	}
+	log.Printf("[INFO] quote saved by %s, %+v", msg.From.Username, quote)
+	return Response{Text: "цитата сохранена", Send: true, ReplyTo: msg.ReplyTo.ID}
+}
+
+func (q *Quotes) request(text string) (react bool, reqText string) {
+	for _, prefix := range q.ReactOn() {
+		if len(text) >= len(prefix) && strings.EqualFold(text[:len(prefix)], prefix) {
+			return true, strings.TrimSpace(text[len(prefix):])
+		}
+	}
+	return false, ""
+}
+
+// renderQuote makes markdown text of the quote with author and link, if any
+func renderQuote(q Quote) string {
+	res := fmt.Sprintf("_%s_", EscapeMarkDownV1Text(q.Text))
+	if q.Author.Username == "" && q.Author.DisplayName == "" {
+		return res
+	}
+	author := EscapeMarkDownV1Text(DisplayName(Message{From: q.Author}))
+	if q.Link != "" {
+		author = fmt.Sprintf("[%s](%s)", author, q.Link)
+	}
+	res += "\n— " + author
+	if !q.Date.IsZero() {
+		res += ", " + q.Date.Format("02.01.2006")
+	}
+	return res
+}
+
+// MessageLink makes a link to the message in the chat. Public chats linked by username,
+// private supergroups by internal id (chat id without -100 prefix).
+func MessageLink(group string, chatID int64, msgID int) string {
+	if msgID == 0 {
+		return ""
+	}
+	if group != "" {
+		if _, err := strconv.ParseInt(group, 10, 64); err != nil {
+			return fmt.Sprintf("https://t.me/%s/%d", strings.TrimPrefix(group, "@"), msgID)
+		}
+	}
+	if chatID == 0 {
+		return ""
+	}
+	return fmt.Sprintf("https://t.me/c/%s/%d", strings.TrimPrefix(strconv.FormatInt(chatID, 10), "-100"), msgID)
+}
@@ -0,0 +1,143 @@
+package bot
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+)
+
+func TestQuoteStore(t *testing.T) {
+	tmp := t.TempDir()
+	store, err := NewQuoteStore(path.Join(tmp, "quotes.jsonl"))
+	require.NoError(t, err)
+
+	count, err := store.Import([]string{"line 1", "", "line 2", "line 1"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	added, err := store.Add(Quote{Text: "some text", Author: User{Username: "user1", DisplayName: "User One"},
+		Date: time.Date(2024, 5, 4, 20, 0, 0, 0, time.UTC), Link: "https://t.me/chat/123"})
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	added, err = store.Add(Quote{Text: "other text", Link: "https://t.me/chat/123"})
+	require.NoError(t, err)
+	assert.False(t, added, "same link")
+
+	store, err = NewQuoteStore(path.Join(tmp, "quotes.jsonl"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, store.Len(), "reloaded from file")
+
+	assert.Len(t, store.Search("USER1", ""), 1)
+	assert.Len(t, store.Search("", "LINE"), 2)
+	assert.Empty(t, store.Search("user2", ""))
+
+	buf := bytes.Buffer{}
+	require.NoError(t, store.Export(&buf))
+	assert.Equal(t, "- line 1\n- line 2\n- some text — User One, 2024-05-04 ([ссылка](https://t.me/chat/123))\n", buf.String())
+}
+
+func TestQuotes_OnMessage(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	store, err := NewQuoteStore(path.Join(t.TempDir(), "quotes.jsonl"))
+	require.NoError(t, err)
+	b := NewQuotes(store, su, 2, "radio_t_chat")
+
+	reply := func(from User, text string) Message {
+		msg := Message{ID: 100, Text: text, From: from, ChatID: -100123}
+		msg.ReplyTo.ID = 42
+		msg.ReplyTo.Text = "quote me"
+		msg.ReplyTo.From = User{ID: 10, Username: "author", DisplayName: "The Author"}
+		msg.ReplyTo.Sent = time.Date(2024, 5, 4, 20, 0, 0, 0, time.UTC)
+		return msg
+	}
+
+	t.Run("not a command", func(t *testing.T) {
+		assert.Equal(t, Response{}, b.OnMessage(Message{Text: "blah"}))
+	})
+
+	t.Run("nothing found", func(t *testing.T) {
+		assert.Equal(t, Response{Text: "цитат не найдено", Send: true, ReplyTo: 1}, b.OnMessage(Message{ID: 1, Text: "quote!"}))
+	})
+
+	t.Run("votes from users", func(t *testing.T) {
+		resp := b.OnMessage(reply(User{ID: 1, Username: "user1"}, "quote!"))
+		assert.Equal(t, Response{Text: "голос за цитату учтен, 1 из 2", Send: true, ReplyTo: 100}, resp)
+		resp = b.OnMessage(reply(User{ID: 1, Username: "user1"}, "quote!"))
+		assert.Equal(t, Response{Text: "голос за цитату учтен, 1 из 2", Send: true, ReplyTo: 100}, resp, "same user")
+		resp = b.OnMessage(reply(User{ID: 10, Username: "author"}, "quote!"))
+		assert.Equal(t, Response{}, resp, "self quote ignored")
+		resp = b.OnMessage(reply(User{ID: 2, Username: "user2"}, "Quote!"))
+		assert.Equal(t, Response{Text: "цитата сохранена", Send: true, ReplyTo: 42}, resp)
+		require.Equal(t, 1, store.Len())
+		q := store.Search("author", "")[0]
+		assert.Equal(t, "https://t.me/radio_t_chat/42", q.Link)
+		assert.Equal(t, "user2", q.AddedBy)
+	})
+
+	t.Run("stale votes dropped", func(t *testing.T) {
+		b.pending[55] = quoteVotes{users: map[int64]bool{1: true}, start: time.Now().Add(-quoteVotesTTL - time.Minute)}
+		msg := reply(User{ID: 2, Username: "user2"}, "quote!")
+		msg.ReplyTo.ID = 56
+		msg.ReplyTo.Text = "other"
+		resp := b.OnMessage(msg)
+		assert.Equal(t, Response{Text: "голос за цитату учтен, 1 из 2", Send: true, ReplyTo: 100}, resp)
+		assert.NotContains(t, b.pending, 55)
+		assert.Contains(t, b.pending, 56)
+	})
+
+	t.Run("super saves immediately", func(t *testing.T) {
+		resp := b.OnMessage(reply(User{ID: 3, Username: "admin"}, "quote!"))
+		assert.Equal(t, Response{Text: "эта цитата уже сохранена", Send: true, ReplyTo: 100}, resp)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		resp := b.OnMessage(Message{Text: "quote! @author"})
+		assert.Equal(t, Response{Text: "_quote me_\n— [The Author](https://t.me/radio_t_chat/42), 04.05.2024", Send: true}, resp)
+		resp = b.OnMessage(Message{Text: "цитата! QUOTE"})
+		assert.Equal(t, Response{Text: "_quote me_\n— [The Author](https://t.me/radio_t_chat/42), 04.05.2024", Send: true}, resp)
+		resp = b.OnMessage(Message{ID: 2, Text: "quote! @nobody"})
+		assert.Equal(t, Response{Text: "цитат не найдено", Send: true, ReplyTo: 2}, resp)
+	})
+}
+
+func TestSys_OnMessageWithQuotes(t *testing.T) {
+	fname := path.Join(t.TempDir(), "quotes.jsonl")
+	store, err := NewQuoteStore(fname)
+	require.NoError(t, err)
+
+	bot, err := NewSys("./../../data", store)
+	require.NoError(t, err)
+	assert.Greater(t, store.Len(), 10, "say.data imported")
+	_, err = os.Stat(fname)
+	require.NoError(t, err)
+
+	imported := store.Len()
+	_, err = store.Add(Quote{Text: "some new quote"})
+	require.NoError(t, err)
+	store, err = NewQuoteStore(fname)
+	require.NoError(t, err)
+	_, err = NewSys("./../../data", store)
+	require.NoError(t, err)
+	assert.Equal(t, imported+1, store.Len(), "say.data merged without duplicates")
+
+	resp := bot.OnMessage(Message{Text: "say!"})
+	assert.True(t, resp.Send)
+	assert.True(t, strings.HasPrefix(resp.Text, "_") && strings.HasSuffix(resp.Text, "_"), resp.Text)
+}
+
+func TestMessageLink(t *testing.T) {
+	assert.Equal(t, "https://t.me/radio_t_chat/12", MessageLink("radio_t_chat", -100123, 12))
+	assert.Equal(t, "https://t.me/radio_t_chat/12", MessageLink("@radio_t_chat", 0, 12))
+	assert.Equal(t, "https://t.me/c/123/12", MessageLink("-100123", -100123, 12))
+	assert.Equal(t, "https://t.me/c/123/12", MessageLink("", -100123, 12))
+	assert.Equal(t, "", MessageLink("radio_t_chat", -100123, 0))
+}
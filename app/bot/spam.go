@@ -2,27 +2,59 @@ package bot
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"math"
 	"net/http"
+	"os"
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/radio-t/super-bot/app/bayes"
+	"github.com/radio-t/super-bot/app/homoglyph"
+	"github.com/radio-t/super-bot/app/storage"
 )
 
-// SpamFilter bot, checks if user is a spammer using internal matching as well as CAS API
+// SpamFilter bot, checks if user is a spammer using internal matching as well as CAS API.
+// Superusers teach it with spam! and ham! replies.
 type SpamFilter struct {
 	SpamParams
 
 	tokenizedSpam []map[string]int
+	spamSamples   []string // raw spam samples, same order as tokenizedSpam, shown in verdicts
+	tokenizedHam  []map[string]int
 	approvedUsers map[int64]bool
+	checkedMsgs   map[int64]int // number of clean messages from not approved users
+
+	casCache       map[int64]casResult
+	casFailures    int       // consecutive CAS failures
+	casPausedUntil time.Time // CAS not asked until this time after too many failures
+	now            func() time.Time
+	approvedFile   *storage.JSONL[User] // users approved by ham! or by clean messages, nil if ApprovedFile not set
 }
 
 const maxEmojiAllowed = 2
 
+const maxVerdictSampleLen = 50 // max length of matched sample shown in verdict
+
+const (
+	casMaxFailures   = 3               // consecutive CAS failures to pause it
+	casPause         = 5 * time.Minute // CAS not asked after too many failures
+	maxCasCache      = 10000           // expired CAS results removed when cache grows over it
+	maxLinkOnlyWords = 3               // message with links and mentions is link-only if it has no more other words
+	suspiciousMute   = time.Hour       // mute for new user's message failing stricter rules only
+)
+
+var (
+	linkPattern    = regexp.MustCompile(`(?i)(?:https?://|www\.|t\.me/|telegram\.(?:me|dog)/|tg://)\S+`)
+	tgLinkPattern  = regexp.MustCompile(`(?i)^(?:(?:https?://)?(?:www\.)?(?:t\.me|telegram\.(?:me|dog))/|tg://)`)
+	mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_.+\-@])@[A-Za-z][A-Za-z0-9_]{4,}`) // not an email
+)
+
 // If user is restricted for more than 366 days or less than 30 seconds from the current time,
 // they are considered to be restricted forever.
 var permanentBanDuration = time.Hour * 24 * 400
@@ -37,86 +69,549 @@ var stopWords = []string{
 type SpamParams struct {
 	SuperUser           SuperUser
 	SpamSamples         io.Reader
+	HamSamples          io.Reader // optional, known false positives
 	SimilarityThreshold float64
 	MinMsgLen           int
 	CasAPI              string
+	CasTimeout          time.Duration // CAS request timeout, 0 means no timeout besides HTTPClient's own
+	CasTTL              time.Duration // CAS results cached for this period, 0 disables caching
 	HTTPClient          HTTPClient
+	Blocklist           *Blocklist // optional, known spammers checked before CAS, updated by bans, spam! and ham!
 	Dry                 bool
+	FirstMessages       int // number of clean messages to approve user, new users checked with stricter rules before
+
+	Classifier     *bayes.Classifier // optional, trained by Train
+	BayesThreshold float64           // spam probability from classifier to detect spam, 0 disables the check
+
+	SamplesFile  string      // optional, spam! appends reported messages to it
+	HamFile      string      // optional, ham! appends false positives to it
+	ApprovedFile string      // optional, jsonl with users approved by ham! or by clean first messages
+	TgClient     TgBanClient // optional, lifts the ban on ham!
+	ModLog       *ModLog     // optional, journal of lifted bans
+	BotUsername  string      // optional, without @, spam! is refused for bot's messages, ham! for ones other than ban notices
 }
 
 // NewSpamFilter makes a spam detecting bot
 func NewSpamFilter(p SpamParams) *SpamFilter {
 	log.Printf("[INFO] spam bot: %+v", p)
-	res := &SpamFilter{SpamParams: p, approvedUsers: map[int64]bool{}}
+	res := &SpamFilter{SpamParams: p, approvedUsers: map[int64]bool{}, checkedMsgs: map[int64]int{},
+		casCache: map[int64]casResult{}, now: time.Now}
 
-	scanner := bufio.NewScanner(p.SpamSamples)
+	res.spamSamples = res.loadSamples(p.SpamSamples)
+	for _, sample := range res.spamSamples {
+		res.tokenizedSpam = append(res.tokenizedSpam, res.tokenize(sample))
+	}
+	log.Printf("[INFO] loaded %d spam samples, local spam filter enabled", len(res.tokenizedSpam))
+	if p.HamSamples != nil {
+		for _, sample := range res.loadSamples(p.HamSamples) {
+			res.tokenizedHam = append(res.tokenizedHam, res.tokenize(sample))
+		}
+		log.Printf("[INFO] loaded %d ham samples", len(res.tokenizedHam))
+	}
+
+	if p.ApprovedFile != "" {
+		if err := res.loadApproved(p.ApprovedFile); err != nil {
+			log.Printf("[WARN] failed to load approved users, error=%v", err)
+		}
+	}
+	return res
+}
+
+func (s *SpamFilter) loadSamples(r io.Reader) []string {
+	res := []string{}
+	if r == nil {
+		return res
+	}
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
-		tokenizedSpam := res.tokenize(scanner.Text())
-		res.tokenizedSpam = append(res.tokenizedSpam, tokenizedSpam)
+		res = append(res, scanner.Text())
 	}
 	if err := scanner.Err(); err != nil {
-		log.Printf("[WARN] failed to read spam samples, error=%v", err)
-	} else {
-		log.Printf("[INFO] loaded %d spam samples, local spam filter enabled", len(res.tokenizedSpam))
+		log.Printf("[WARN] failed to read samples, error=%v", err)
 	}
 	return res
 }
 
+func (s *SpamFilter) loadApproved(path string) error {
+	file, err := storage.NewJSONL[User](path)
+	if err != nil {
+		return err
+	}
+	users, err := file.Load()
+	if err != nil {
+		return fmt.Errorf("can't load approved users: %w", err)
+	}
+	for _, u := range users {
+		if s.Blocklist != nil && s.Blocklist.Contains(u.ID) {
+			continue // reported as spammer after approval
+		}
+		s.approvedUsers[u.ID] = true
+	}
+	s.approvedFile = file
+	log.Printf("[INFO] loaded %d approved users from %s", len(users), path)
+	return nil
+}
+
 // OnMessage checks if user already approved and if not checks if user is a spammer
 func (s *SpamFilter) OnMessage(msg Message) (response Response) {
-	if s.approvedUsers[msg.From.ID] || msg.From.ID == 0 || len(msg.Text) < s.MinMsgLen {
-		return Response{}
+	if resp, ok := s.onFeedback(msg); ok {
+		return resp
 	}
 
-	if s.SuperUser.IsSuper(msg.From.Username) {
+	if s.approvedUsers[msg.From.ID] || msg.From.ID == 0 {
+		return Response{}
+	}
+	text := spamText(msg)
+	if text == "" || s.SuperUser.IsSuper(msg.From.Username) {
 		return Response{} // don't check super users for spam
 	}
 
+	// short messages checked only by new user rules, as content checks are not reliable for them
+	short := len(text) < s.MinMsgLen
+	verdict := s.inspect(msg)
+	if !short {
+		verdict = s.Check(msg)
+	}
+	suspicious := s.newUserReasons(verdict)
+
 	displayUsername := strings.TrimSpace(DisplayName(msg))
-	isEmojiSpam, _ := s.tooManyEmojis(msg.Text, maxEmojiAllowed)
-	stopWordsSpam := s.stopWords(msg.Text)
-	similaritySpam := s.isSpamSimilarity(msg.Text)
-	if similaritySpam || isEmojiSpam || stopWordsSpam || s.isCasSpam(msg.From.ID) {
-		log.Printf("[INFO] user %s detected as spammer, msg: %q", displayUsername, msg.Text)
+	if verdict.IsSpam() {
+		verdict.Reasons = append(verdict.Reasons, suspicious...)
+		log.Printf("[INFO] user %s detected as spammer, %s, msg: %q", displayUsername, verdict, text)
 		if s.Dry {
 			return Response{
-				Text: fmt.Sprintf("this is spam from %q, but I'm in dry mode, so I'll do nothing yet", displayUsername),
+				Text: fmt.Sprintf("this is spam from %q, but I'm in dry mode, so I'll do nothing yet\n%s",
+					displayUsername, EscapeMarkDownV1Text(verdict.String())),
 				Send: true, ReplyTo: msg.ID,
 			}
 		}
+		s.block(msg.From, "spam: "+strings.Join(verdict.Reasons, ", "))
 		return Response{Text: fmt.Sprintf("this is spam! go to ban, %q (id:%d)", displayUsername, msg.From.ID),
 			Send: true, ReplyTo: msg.ID, BanInterval: permanentBanDuration, DeleteReplyTo: true,
-			User: User{Username: msg.From.Username, ID: msg.From.ID, DisplayName: msg.From.DisplayName},
+			User:    User{Username: msg.From.Username, ID: msg.From.ID, DisplayName: msg.From.DisplayName},
+			Reason:  "spam: " + strings.Join(verdict.Reasons, ", "),
+			Details: verdict.String(),
 		}
 	}
 
-	if id := msg.From.ID; id != 0 {
-		s.approvedUsers[id] = true
+	// stricter new user rules are not reliable enough to ban, the message is kept for admins to decide
+	if len(suspicious) > 0 {
+		verdict.Reasons = suspicious
+		log.Printf("[INFO] user %s looks suspicious, %s, msg: %q", displayUsername, verdict, text)
+		if s.Dry {
+			return Response{
+				Text: fmt.Sprintf("suspicious message from %q, but I'm in dry mode, so I'll do nothing yet\n%s",
+					displayUsername, EscapeMarkDownV1Text(verdict.String())),
+				Send: true, ReplyTo: msg.ID,
+			}
+		}
+		return Response{Text: fmt.Sprintf("подозрительное сообщение от %s (id:%d): %s, помолчите час. "+
+			"Админы, ответьте ham! если это не спам или spam! на сообщение, если спам",
+			EscapeMarkDownV1Text(displayUsername), msg.From.ID, strings.Join(suspicious, ", ")),
+			Send: true, ReplyTo: msg.ID, BanInterval: suspiciousMute,
+			User:    User{Username: msg.From.Username, ID: msg.From.ID, DisplayName: msg.From.DisplayName},
+			Reason:  "suspicious: " + strings.Join(suspicious, ", "),
+			Details: verdict.String(),
+		}
+	}
+
+	s.checkedMsgs[msg.From.ID]++
+	if s.checkedMsgs[msg.From.ID] >= s.FirstMessages {
+		s.approve(msg.From)
+		delete(s.checkedMsgs, msg.From.ID)
 		log.Printf("[INFO] user %s is not a spammer id %d, added to aproved", displayUsername, msg.From.ID)
 	}
 	return Response{} // not a spam
 }
 
+// newUserReasons returns triggered stricter checks for users not approved yet:
+// link-only messages with a few words besides links and mentions, links to telegram
+// and forwarded messages with links or mentions. Mentions alone don't make a message link-only,
+// new users reply to hosts and other members with them.
+func (s *SpamFilter) newUserReasons(v SpamVerdict) (res []string) {
+	hasLinks := len(v.Links) > 0 || v.Mentions > 0
+	if len(v.Links) > 0 && v.Words <= maxLinkOnlyWords {
+		res = append(res, "link only")
+	}
+	for _, l := range v.Links {
+		if tgLinkPattern.MatchString(l) {
+			res = append(res, "telegram link")
+			break
+		}
+	}
+	if v.Forwarded && hasLinks {
+		res = append(res, "forward")
+	}
+	return res
+}
+
+// SpamVerdict is a breakdown of all spam checks for a message, used to explain bans and tune the thresholds
+type SpamVerdict struct {
+	Reasons       []string // triggered checks, empty if not a spam
+	Len           int      // length of text, caption and link urls in bytes, as compared with MinMsgLen
+	Links         []string // urls from text, caption and text links
+	Mentions      int      // number of @mentions
+	Words         int      // number of words except links and mentions
+	Forwarded     bool     // message forwarded from another chat or user
+	Similarity    float64  // the best similarity to spam samples
+	Sample        int      // line of the best matching spam sample, 1-based, 0 if nothing matched
+	SampleText    string   // the best matching spam sample
+	HamSimilarity float64  // the best similarity to ham samples
+	Emojis        int      // number of emojis
+	StopWords     []string // matched stop words
+	Bayes         float64  // spam probability from naive Bayes classifier, -1 if not checked
+	CAS           string   // CAS result, "spam: description", "clean", "error", "unavailable" or "skipped" if blocklisted or not set
+}
+
+// IsSpam returns true if any check triggered
+func (v SpamVerdict) IsSpam() bool { return len(v.Reasons) > 0 }
+
+// String returns one-line breakdown, like
+// "similarity 0.91 (sample 2 "lottery prize", ham 0.00), emoji 0, stop words: none, cas: skipped, len 22"
+func (v SpamVerdict) String() string {
+	parts := make([]string, 0, 6)
+	similarity := fmt.Sprintf("similarity %0.2f", v.Similarity)
+	if v.Sample > 0 {
+		sample := []rune(strings.Join(strings.Fields(v.SampleText), " "))
+		if len(sample) > maxVerdictSampleLen {
+			sample = append(sample[:maxVerdictSampleLen], '…')
+		}
+		similarity += fmt.Sprintf(" (sample %d %q, ham %0.2f)", v.Sample, string(sample), v.HamSimilarity)
+	}
+	parts = append(parts, similarity, fmt.Sprintf("emoji %d", v.Emojis))
+	if len(v.StopWords) > 0 {
+		parts = append(parts, fmt.Sprintf("stop words: %q", strings.Join(v.StopWords, ", ")))
+	} else {
+		parts = append(parts, "stop words: none")
+	}
+	if v.Bayes >= 0 {
+		parts = append(parts, fmt.Sprintf("bayes %0.3f", v.Bayes))
+	}
+	if len(v.Links) > 0 {
+		parts = append(parts, fmt.Sprintf("links %d", len(v.Links)))
+	}
+	if v.Mentions > 0 {
+		parts = append(parts, fmt.Sprintf("mentions %d", v.Mentions))
+	}
+	if v.Forwarded {
+		parts = append(parts, "forwarded")
+	}
+	parts = append(parts, "cas: "+v.CAS, fmt.Sprintf("len %d", v.Len))
+	return strings.Join(parts, ", ")
+}
+
+// Check runs all spam checks for the message and returns the breakdown.
+// CAS is not asked for users in the blocklist. Approved and super users are not excluded here.
+func (s *SpamFilter) Check(msg Message) SpamVerdict {
+	res := s.inspect(msg)
+	text := spamText(msg)
+	var isEmojiSpam bool
+	isEmojiSpam, res.Emojis = s.tooManyEmojis(text, maxEmojiAllowed)
+	res.StopWords = s.matchedStopWords(text)
+	res.Similarity, res.Sample, res.HamSimilarity = s.similarity(text)
+	if res.Sample > 0 {
+		res.SampleText = s.spamSamples[res.Sample-1]
+	}
+	similaritySpam := res.Similarity >= s.SimilarityThreshold && res.Similarity > res.HamSimilarity && res.Sample > 0
+	bayesSpam := false
+	if s.Classifier != nil && s.BayesThreshold > 0 {
+		res.Bayes = s.Classifier.SpamProbability(s.tokenize(text))
+		bayesSpam = res.Bayes >= s.BayesThreshold
+	}
+
+	for _, r := range []struct {
+		ok   bool
+		name string
+	}{{similaritySpam, "similarity"}, {isEmojiSpam, "emoji"}, {len(res.StopWords) > 0, "stop words"},
+		{bayesSpam, "bayes"}} {
+		if r.ok {
+			res.Reasons = append(res.Reasons, r.name)
+		}
+	}
+	blocked := s.Blocklist != nil && s.Blocklist.Contains(msg.From.ID)
+	if blocked {
+		res.Reasons = append(res.Reasons, "blocklist")
+	}
+	if !blocked && s.HTTPClient != nil { // known spammers are not asked in cas
+		var casSpam bool
+		casSpam, res.CAS = s.casCheck(msg.From.ID)
+		if casSpam {
+			res.Reasons = append(res.Reasons, "cas")
+		}
+	}
+	return res
+}
+
+// inspect returns verdict without checks, with length, links, mentions and forward of the message
+func (s *SpamFilter) inspect(msg Message) SpamVerdict {
+	text := spamText(msg)
+	res := SpamVerdict{Len: len(text), Forwarded: msg.Forwarded, Bayes: -1, CAS: "skipped"}
+	res.Links = linkPattern.FindAllString(text, -1)
+	res.Mentions = len(mentionPattern.FindAllString(text, -1))
+	res.Words = len(strings.Fields(mentionPattern.ReplaceAllString(linkPattern.ReplaceAllString(text, ""), "")))
+	return res
+}
+
+// spamText returns text of the message with image caption and urls of text links, everything spam checks look at
+func spamText(msg Message) string {
+	parts := []string{}
+	entities := []Entity{}
+	if msg.Text != "" {
+		parts = append(parts, msg.Text)
+	}
+	if msg.Entities != nil {
+		entities = append(entities, *msg.Entities...)
+	}
+	if msg.Image != nil {
+		if msg.Image.Caption != "" {
+			parts = append(parts, msg.Image.Caption)
+		}
+		if msg.Image.Entities != nil {
+			entities = append(entities, *msg.Image.Entities...)
+		}
+	}
+	for _, e := range entities {
+		if e.Type == "text_link" && e.URL != "" {
+			parts = append(parts, e.URL)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
 // Help returns help message
-func (s *SpamFilter) Help() string { return "" }
+func (s *SpamFilter) Help() string {
+	return GenHelpMsg(s.ReactOn(), "ответом на сообщение: spam! банит автора и учит фильтр, "+
+		"ham! отмечает ложное срабатывание и разбанивает (только для админов)")
+}
 
 // ReactOn keys
-func (s *SpamFilter) ReactOn() []string { return []string{} }
+func (s *SpamFilter) ReactOn() []string { return []string{"spam!", "ham!"} }
 
-func (s *SpamFilter) isCasSpam(msgID int64) bool {
-	reqURL := fmt.Sprintf("%s/check?user_id=%d", s.CasAPI, msgID)
-	req, err := http.NewRequest("GET", reqURL, http.NoBody)
+// onFeedback handles spam! and ham! replies from superusers, ok is false for other messages
+func (s *SpamFilter) onFeedback(msg Message) (resp Response, ok bool) {
+	cmd := strings.ToLower(strings.TrimSpace(msg.Text))
+	if cmd != "spam!" && cmd != "ham!" {
+		return Response{}, false
+	}
+	if s.SuperUser == nil || !s.SuperUser.IsSuper(msg.From.Username) {
+		return Response{}, true
+	}
+	if cmd == "spam!" {
+		return s.reportSpam(msg), true
+	}
+	return s.reportHam(msg), true
+}
+
+// reportSpam bans the author of replied message, deletes it and adds the text to spam samples
+func (s *SpamFilter) reportSpam(msg Message) Response {
+	user, text := msg.ReplyTo.From, msg.ReplyTo.Text
+	if user.ID == 0 || text == "" {
+		return Response{Text: "ответьте на спам", Send: true, ReplyTo: msg.ID}
+	}
+	if s.SuperUser.IsSuper(user.Username) {
+		return Response{}
+	}
+	if s.BotUsername != "" && strings.EqualFold(user.Username, s.BotUsername) {
+		return Response{Text: "это сообщение бота, ответьте на спам", Send: true, ReplyTo: msg.ID}
+	}
+
+	s.tokenizedSpam = append(s.tokenizedSpam, s.tokenize(text))
+	s.spamSamples = append(s.spamSamples, text)
+	if s.Classifier != nil {
+		s.Classifier.Learn(bayes.Spam, s.tokenize(text))
+	}
+	if err := appendSample(s.SamplesFile, text); err != nil {
+		log.Printf("[WARN] can't save spam sample, %v", err)
+	}
+	delete(s.approvedUsers, user.ID)
+	if !s.Dry {
+		s.block(user, "spam: reported")
+	}
+	log.Printf("[INFO] spam from %+v reported by %s, %d spam samples", user, msg.From.Username, len(s.tokenizedSpam))
+
+	mention := EscapeMarkDownV1Text(strings.TrimSpace(DisplayName(Message{From: user})))
+	if s.Dry {
+		return Response{Text: fmt.Sprintf("спам от %s запомнил, но я в тестовом режиме и никого не баню", mention),
+			Send: true, ReplyTo: msg.ID}
+	}
+	return Response{Text: fmt.Sprintf("спам от %s удален, образец сохранен", mention), Send: true,
+		ReplyTo: msg.ReplyTo.ID, BanInterval: permanentBanDuration, DeleteReplyTo: true, User: user,
+		Reason: "spam: reported"}
+}
+
+// reportHam marks false positive, approves the user, lifts the ban and adds the text to ham samples.
+// Works as a reply to the bot's ban notice, if the ban is in the journal, or to the message itself.
+func (s *SpamFilter) reportHam(msg Message) Response {
+	user, text := msg.ReplyTo.From, msg.ReplyTo.Text
+	var banned *ModEntry
+	if s.ModLog != nil && msg.ReplyTo.ID != 0 {
+		if e, found := s.ModLog.FindNotice(msg.ReplyTo.ID); found && e.Target.ID != 0 {
+			user, text, banned = e.Target, e.Message, &e
+		}
+	}
+	if banned == nil && s.BotUsername != "" && strings.EqualFold(user.Username, s.BotUsername) {
+		return Response{Text: "это не уведомление о бане спамера, ответьте на него или на сообщение пользователя",
+			Send: true, ReplyTo: msg.ID}
+	}
+	if user.ID == 0 {
+		return Response{Text: "ответьте на сообщение или уведомление о бане", Send: true, ReplyTo: msg.ID}
+	}
+
+	s.approve(user)
+	if s.Blocklist != nil {
+		if err := s.Blocklist.Remove(user); err != nil {
+			log.Printf("[WARN] can't remove %+v from blocklist, %v", user, err)
+		}
+	}
+	if text != "" {
+		s.tokenizedHam = append(s.tokenizedHam, s.tokenize(text))
+		if s.Classifier != nil {
+			s.Classifier.Learn(bayes.Ham, s.tokenize(text))
+		}
+		if err := appendSample(s.HamFile, text); err != nil {
+			log.Printf("[WARN] can't save ham sample, %v", err)
+		}
+	}
+	log.Printf("[INFO] false positive for %+v reported by %s, %d ham samples", user, msg.From.Username, len(s.tokenizedHam))
+
+	mention := EscapeMarkDownV1Text(strings.TrimSpace(DisplayName(Message{From: user})))
+	if banned == nil {
+		banned = &ModEntry{Action: ModRestrict, Target: user}
+	}
+	if s.TgClient == nil || s.Dry {
+		return Response{Text: fmt.Sprintf("%s больше не считается спамером", mention), Send: true, ReplyTo: msg.ID}
+	}
+
+	err := s.liftBan(*banned, msg.ChatID)
+	if s.ModLog != nil {
+		entry := ModEntry{Action: ModUnban, Source: "SpamFilter", Actor: msg.From, Target: user, Reason: "ham"}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		if jerr := s.ModLog.Add(entry); jerr != nil {
+			log.Printf("[WARN] can't save moderation record %+v, %v", entry, jerr)
+		}
+	}
+	if err != nil {
+		log.Printf("[WARN] can't lift ban for %+v, %v", user, err)
+		return Response{Text: fmt.Sprintf("%s больше не считается спамером, но разбанить не удалось: %s", mention,
+			EscapeMarkDownV1Text(err.Error())), Send: true, ReplyTo: msg.ID}
+	}
+	return Response{Text: fmt.Sprintf("%s больше не считается спамером и разбанен", mention), Send: true, ReplyTo: msg.ID}
+}
+
+func (s *SpamFilter) liftBan(e ModEntry, chatID int64) error {
+	resp, err := s.TgClient.Request(LiftRequest(e, chatID))
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return fmt.Errorf("response is not Ok: %s", resp.Description)
+	}
+	return nil
+}
+
+// appendSample adds text to samples file as a single line, does nothing if file not set
+func appendSample(path, text string) error {
+	if path == "" {
+		return nil
+	}
+	fh, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) // nolint
+	if err != nil {
+		return fmt.Errorf("can't open %s: %w", path, err)
+	}
+	line := strings.Join(strings.Fields(text), " ") + "\n"
+	if _, err = fh.WriteString(line); err != nil {
+		_ = fh.Close()
+		return fmt.Errorf("can't write to %s: %w", path, err)
+	}
+	return fh.Close()
+}
+
+// approve marks the user as not a spammer and saves it to approved users file, if set
+func (s *SpamFilter) approve(u User) {
+	if !s.approvedUsers[u.ID] && s.approvedFile != nil {
+		if err := s.approvedFile.Append(u); err != nil {
+			log.Printf("[WARN] can't save approved user %+v, %v", u, err)
+		}
+	}
+	s.approvedUsers[u.ID] = true
+}
+
+// block adds the user to blocklist, if set
+func (s *SpamFilter) block(u User, reason string) {
+	if s.Blocklist == nil {
+		return
+	}
+	if err := s.Blocklist.Add(u, reason); err != nil {
+		log.Printf("[WARN] can't add %+v to blocklist, %v", u, err)
+	}
+}
+
+type casResult struct {
+	spam    bool
+	result  string
+	expires time.Time
+}
+
+// casCheck asks CAS API about the user, result is "spam: description", "clean", "error" or "unavailable".
+// Results are cached for CasTTL, errors are not. After casMaxFailures in a row CAS is not asked for casPause,
+// so slow or broken CAS doesn't delay every message.
+func (s *SpamFilter) casCheck(userID int64) (isSpam bool, result string) {
+	now := s.now()
+	if c, found := s.casCache[userID]; found && now.Before(c.expires) {
+		return c.spam, c.result + " (cached)"
+	}
+	if now.Before(s.casPausedUntil) {
+		return false, "unavailable"
+	}
+
+	isSpam, result, err := s.casRequest(userID)
 	if err != nil {
-		log.Printf("[WARN] failed to make request %s, error=%v", reqURL, err)
-		return false
+		log.Printf("[WARN] %v", err)
+		s.casFailures++
+		if s.casFailures >= casMaxFailures {
+			log.Printf("[WARN] CAS failed %d times in a row, paused for %v", s.casFailures, casPause)
+			s.casFailures, s.casPausedUntil = 0, now.Add(casPause)
+		}
+		return false, "error"
+	}
+	s.casFailures = 0
+
+	if s.CasTTL > 0 {
+		if len(s.casCache) >= maxCasCache {
+			for id, c := range s.casCache {
+				if !now.Before(c.expires) {
+					delete(s.casCache, id)
+				}
+			}
+		}
+		s.casCache[userID] = casResult{spam: isSpam, result: result, expires: now.Add(s.CasTTL)}
+	}
+	return isSpam, result
+}
+
+func (s *SpamFilter) casRequest(userID int64) (isSpam bool, result string, err error) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if s.CasTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, s.CasTimeout)
+	}
+	defer cancel()
+
+	reqURL := fmt.Sprintf("%s/check?user_id=%d", s.CasAPI, userID)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, http.NoBody)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to make request %s: %w", reqURL, err)
 	}
 
 	resp, err := s.HTTPClient.Do(req)
 	if err != nil {
-		log.Printf("[WARN] failed to send request %s, error=%v", reqURL, err)
-		return false
+		return false, "", fmt.Errorf("failed to send request %s: %w", reqURL, err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, "", fmt.Errorf("unexpected status %d from %s", resp.StatusCode, reqURL)
+	}
 
 	respData := struct {
 		OK          bool   `json:"ok"` // ok means user is a spammer
@@ -124,97 +619,133 @@ func (s *SpamFilter) isCasSpam(msgID int64) bool {
 	}{}
 
 	if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
-		log.Printf("[WARN] failed to parse response from %s, error=%v", reqURL, err)
-		return false
+		return false, "", fmt.Errorf("failed to parse response from %s: %w", reqURL, err)
 	}
 	if respData.OK {
-		log.Printf("[INFO] user %q detected as spammer: %s", msgID, respData.Description)
+		log.Printf("[INFO] user %d detected as spammer: %s", userID, respData.Description)
+		return true, "spam: " + respData.Description, nil
 	}
-	return respData.OK
+	return false, "clean", nil
 }
 
 // isSpam checks if a given message is similar to any of the known bad messages.
+// Message similar to a known false positive at least as much as to spam is not a spam.
 func (s *SpamFilter) isSpamSimilarity(message string) bool {
-	// check for spam similarity
+	similarity, sample, hamSimilarity := s.similarity(message)
+	if sample > 0 && similarity >= s.SimilarityThreshold && similarity > hamSimilarity {
+		log.Printf("[DEBUG] high spam similarity: %0.2f, line %d, tokens: %v", similarity, sample, s.tokenizedSpam[sample-1])
+		return true
+	}
+	log.Printf("[DEBUG] low spam similarity: %0.2f", similarity)
+	return false
+}
+
+// similarity returns the best similarity to spam samples with 1-based line of the sample, 0 if nothing matched,
+// and the best similarity to ham samples
+func (s *SpamFilter) similarity(message string) (spamSimilarity float64, sample int, hamSimilarity float64) {
 	tokenizedMessage := s.tokenize(message)
-	maxSimilarity, maxTokens, maxID := 0.0, map[string]int{}, 0
+	for _, ham := range s.tokenizedHam {
+		hamSimilarity = math.Max(hamSimilarity, s.cosineSimilarity(tokenizedMessage, ham))
+	}
 	for i, spam := range s.tokenizedSpam {
-		similarity := s.cosineSimilarity(tokenizedMessage, spam)
-		if similarity > maxSimilarity {
-			maxSimilarity = similarity
-			maxTokens = spam
-			maxID = i + 1
-		}
-		if similarity >= s.SimilarityThreshold {
-			log.Printf("[DEBUG] high spam similarity: %0.2f, line %d, toekns: %v",
-				maxSimilarity, maxID, maxTokens)
-			return true
+		if similarity := s.cosineSimilarity(tokenizedMessage, spam); similarity > spamSimilarity {
+			spamSimilarity, sample = similarity, i+1
 		}
 	}
-	log.Printf("[DEBUG] low spam similarity: %0.2f", maxSimilarity)
-	return false
+	return spamSimilarity, sample, hamSimilarity
 }
 
-// tokenize takes a string and returns a map where the keys are unique words (tokens)
-// and the values are the frequencies of those words in the string.
-func (s *SpamFilter) tokenize(inp string) map[string]int {
+// Train makes naive Bayes classifier from spam and ham samples, messages from chat logs in logsPath added as ham.
+// Log messages shorter than MinMsgLen or similar to spam samples are skipped,
+// as spam stays in logs even if deleted from the chat.
+func (s *SpamFilter) Train(logsPath string) (*bayes.Classifier, error) {
+	res := bayes.New()
+	for _, tokens := range s.tokenizedSpam {
+		res.Learn(bayes.Spam, tokens)
+	}
+	for _, tokens := range s.tokenizedHam {
+		res.Learn(bayes.Ham, tokens)
+	}
 
-	isExcludedToken := func(token string) bool {
-		list := []string{
-			// english
-			"and", "the", "is", "in", "on", "at", "for", "with", "not",
-			"by", "be", "this", "are", "from", "or", "that", "an", "it",
-			"his", "but", "he", "she", "as", "you", "do", "their", "all",
-			"will", "there", "can", "i", "me", "my", "myself", "we", "our", "ours", "ourselves",
-			"your", "yours", "yourself", "yourselves", "him", "himself",
-			"her", "hers", "herself", "its", "itself", "they", "them",
-			"theirs", "themselves", "what", "which", "who", "whom",
-			"these", "those", "am", "was", "were", "been", "being", "have",
-			"has", "had", "having", "does", "did", "a", "if", "because",
-			"until", "while", "of", "about", "against", "between", "into",
-			"through", "during", "before", "after", "above", "below", "to",
-			"up", "down", "out", "off", "over", "under", "again", "further",
-			"then", "once", "here", "why", "how", "any", "both", "each",
-			"few", "more", "most", "other", "some", "such", "no", "nor",
-			"only", "own", "same", "so", "than", "too", "very", "s", "t",
-			"just", "don", "should", "now",
-
-			// russian
-			"а", "без", "более", "больше", "будет", "будто", "бы", "был", "была", "были",
-			"было", "быть", "в", "вам", "вас", "вдруг", "ведь", "во", "вот", "впрочем",
-			"все", "всегда", "всего", "всех", "всю", "вы", "где", "да", "даже", "два",
-			"для", "до", "другой", "его", "ее", "если", "есть", "еще", "же", "за", "здесь",
-			"и", "из", "или", "им", "иногда", "их", "к", "как", "какая", "какой", "когда",
-			"конечно", "которого", "которые", "кто", "куда", "ли", "лучше", "между",
-			"меня", "мне", "много", "может", "можно", "мой", "моя", "мы", "на", "над",
-			"надо", "наконец", "нас", "не", "него", "нее", "нельзя", "нет", "ни", "нибудь",
-			"никогда", "ним", "них", "ничего", "но", "ну", "о", "об", "один", "он", "она",
-			"они", "оно", "опять", "от", "перед", "по", "под", "после", "потом", "потому",
-			"почти", "при", "про", "раз", "разве", "с", "сам", "свое", "свою", "себе",
-			"себя", "сегодня", "сейчас", "сказал", "сказала", "сказать", "со", "совсем",
-			"так", "такой", "там", "тебя", "тем", "теперь", "то", "тогда", "того", "тоже",
-			"только", "том", "тот", "три", "тут", "ты", "у", "уж", "уже", "хорошо", "хоть",
-			"чего", "чей", "чем", "через", "что", "чтоб", "чтобы", "чуть", "эти", "этого",
-			"этой", "этом", "этот", "эту", "я",
+	skipped := 0
+	count, err := readLogs(logsPath, func(msg Message) {
+		if len(msg.Text) < s.MinMsgLen || msg.Text == "" {
+			return
 		}
-		for _, w := range list {
-			if strings.EqualFold(token, w) || len([]rune(token)) < 3 {
-				return true
-			}
+		if s.isSpamSimilarity(msg.Text) {
+			skipped++
+			return
 		}
-		return false
+		res.Learn(bayes.Ham, s.tokenize(msg.Text))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't read logs: %w", err)
+	}
+	log.Printf("[INFO] spam classifier trained on %d spam and %d ham documents, %d log messages read, %d similar to spam skipped",
+		res.Docs[bayes.Spam], res.Docs[bayes.Ham], count, skipped)
+	return res, nil
+}
+
+// excludedTokens are skeletons of common words ignored by tokenize
+var excludedTokens = func() map[string]bool {
+	list := []string{
+		// english
+		"and", "the", "is", "in", "on", "at", "for", "with", "not",
+		"by", "be", "this", "are", "from", "or", "that", "an", "it",
+		"his", "but", "he", "she", "as", "you", "do", "their", "all",
+		"will", "there", "can", "i", "me", "my", "myself", "we", "our", "ours", "ourselves",
+		"your", "yours", "yourself", "yourselves", "him", "himself",
+		"her", "hers", "herself", "its", "itself", "they", "them",
+		"theirs", "themselves", "what", "which", "who", "whom",
+		"these", "those", "am", "was", "were", "been", "being", "have",
+		"has", "had", "having", "does", "did", "a", "if", "because",
+		"until", "while", "of", "about", "against", "between", "into",
+		"through", "during", "before", "after", "above", "below", "to",
+		"up", "down", "out", "off", "over", "under", "again", "further",
+		"then", "once", "here", "why", "how", "any", "both", "each",
+		"few", "more", "most", "other", "some", "such", "no", "nor",
+		"only", "own", "same", "so", "than", "too", "very", "s", "t",
+		"just", "don", "should", "now",
+
+		// russian
+		"а", "без", "более", "больше", "будет", "будто", "бы", "был", "была", "были",
+		"было", "быть", "в", "вам", "вас", "вдруг", "ведь", "во", "вот", "впрочем",
+		"все", "всегда", "всего", "всех", "всю", "вы", "где", "да", "даже", "два",
+		"для", "до", "другой", "его", "ее", "если", "есть", "еще", "же", "за", "здесь",
+		"и", "из", "или", "им", "иногда", "их", "к", "как", "какая", "какой", "когда",
+		"конечно", "которого", "которые", "кто", "куда", "ли", "лучше", "между",
+		"меня", "мне", "много", "может", "можно", "мой", "моя", "мы", "на", "над",
+		"надо", "наконец", "нас", "не", "него", "нее", "нельзя", "нет", "ни", "нибудь",
+		"никогда", "ним", "них", "ничего", "но", "ну", "о", "об", "один", "он", "она",
+		"они", "оно", "опять", "от", "перед", "по", "под", "после", "потом", "потому",
+		"почти", "при", "про", "раз", "разве", "с", "сам", "свое", "свою", "себе",
+		"себя", "сегодня", "сейчас", "сказал", "сказала", "сказать", "со", "совсем",
+		"так", "такой", "там", "тебя", "тем", "теперь", "то", "тогда", "того", "тоже",
+		"только", "том", "тот", "три", "тут", "ты", "у", "уж", "уже", "хорошо", "хоть",
+		"чего", "чей", "чем", "через", "что", "чтоб", "чтобы", "чуть", "эти", "этого",
+		"этой", "этом", "этот", "эту", "я",
+	}
+	res := make(map[string]bool, len(list))
+	for _, w := range list {
+		res[homoglyph.Skeleton(w)] = true
 	}
+	return res
+}()
 
+// tokenize takes a string and returns a map where the keys are unique words (tokens)
+// and the values are the frequencies of those words in the string.
+// Tokens are homoglyph skeletons, so words written with lookalikes from other alphabets match.
+func (s *SpamFilter) tokenize(inp string) map[string]int {
 	tokenFrequency := make(map[string]int)
 	tokens := strings.Fields(inp)
 	for _, token := range tokens {
-		if isExcludedToken(token) {
+		token = homoglyph.Skeleton(token)
+		if excludedTokens[token] || len([]rune(token)) < 3 {
 			continue
 		}
 		token = s.cleanEmoji(token)
 		token = strings.Trim(token, ".,!?-")
-		token = strings.ToLower(token)
-		tokenFrequency[strings.ToLower(token)]++
+		tokenFrequency[token]++
 	}
 	return tokenFrequency
 }
@@ -244,16 +775,17 @@ func (s *SpamFilter) cosineSimilarity(a, b map[string]int) float64 {
 	return float64(dotProduct) / (math.Sqrt(float64(normA)) * math.Sqrt(float64(normB)))
 }
 
-func (s *SpamFilter) stopWords(message string) bool {
-	lowerCaseMessage := strings.ToLower(message)
-	lowerCaseMessage = emojiPattern.ReplaceAllString(lowerCaseMessage, "")
+// matchedStopWords returns stop words found in the message, comparing homoglyph skeletons
+func (s *SpamFilter) matchedStopWords(message string) []string {
+	cleanMessage := homoglyph.Skeleton(emojiPattern.ReplaceAllString(message, ""))
+	var res []string
 	for _, word := range stopWords {
-		if strings.Contains(lowerCaseMessage, strings.ToLower(word)) {
+		if strings.Contains(cleanMessage, homoglyph.Skeleton(word)) {
 			log.Printf("[DEBUG] spam stop word %q", word)
-			return true
+			res = append(res, word)
 		}
 	}
-	return false
+	return res
 }
 
 func (s *SpamFilter) tooManyEmojis(message string, threshold int) (ok bool, count int) {
@@ -0,0 +1,160 @@
+package bot
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"strings"
+)
+
+// SpamEvalParams defines data for offline spam filter evaluation
+type SpamEvalParams struct {
+	Labeled     io.Reader // optional, labeled messages, "spam<tab>text" or "ham<tab>text" per line
+	LogsPath    string    // optional, reporter's chat logs, all messages are expected to be ham
+	Thresholds  []float64 // similarity thresholds to evaluate, SimilarityThreshold if empty
+	RegularMsgs int       // authors with at least this many messages in logs are regular users
+}
+
+// SpamEvalResult is an outcome of evaluation for a single similarity threshold
+type SpamEvalResult struct {
+	Threshold      float64
+	TP, FP, FN, TN int           // confusion matrix for labeled messages
+	LogMessages    int           // messages from logs checked
+	Flagged        []SpamEvalHit // messages from logs flagged as spam
+	RegularFP      []SpamEvalHit // flagged messages from regular users, subset of Flagged
+}
+
+// SpamEvalHit is a message flagged by the filter during evaluation
+type SpamEvalHit struct {
+	Msg     Message
+	Verdict SpamVerdict
+}
+
+// Precision returns share of spam among messages flagged in labeled set, 0 if nothing flagged
+func (r SpamEvalResult) Precision() float64 {
+	if r.TP+r.FP == 0 {
+		return 0
+	}
+	return float64(r.TP) / float64(r.TP+r.FP)
+}
+
+// Recall returns share of flagged messages among spam in labeled set, 0 if there is no spam
+func (r SpamEvalResult) Recall() float64 {
+	if r.TP+r.FN == 0 {
+		return 0
+	}
+	return float64(r.TP) / float64(r.TP+r.FN)
+}
+
+// String returns one-line summary of the result
+func (r SpamEvalResult) String() string {
+	return fmt.Sprintf("threshold %0.2f: precision %0.2f, recall %0.2f (tp %d, fp %d, fn %d, tn %d), "+
+		"logs flagged %d of %d, regular users flagged %d", r.Threshold, r.Precision(), r.Recall(),
+		r.TP, r.FP, r.FN, r.TN, len(r.Flagged), r.LogMessages, len(r.RegularFP))
+}
+
+type labeledMessage struct {
+	spam    bool
+	verdict SpamVerdict
+}
+
+// Evaluate replays labeled messages and chat logs through the filter for every threshold.
+// Nothing is learned or banned, CAS is not checked. Messages shorter than MinMsgLen are never flagged, like in OnMessage.
+func (s *SpamFilter) Evaluate(p SpamEvalParams) ([]SpamEvalResult, error) {
+	thresholds := p.Thresholds
+	if len(thresholds) == 0 {
+		thresholds = []float64{s.SimilarityThreshold}
+	}
+	// verdicts made once without similarity check, similarity applied per threshold
+	f := *s
+	f.SimilarityThreshold, f.HTTPClient = math.Inf(1), nil
+
+	labeled := []labeledMessage{}
+	if p.Labeled != nil {
+		scanner := bufio.NewScanner(p.Labeled)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			label, text, ok := strings.Cut(scanner.Text(), "\t")
+			if !ok || (label != "spam" && label != "ham") {
+				log.Printf("[WARN] skip labeled line %d, expected spam or ham label and tab", line)
+				continue
+			}
+			labeled = append(labeled, labeledMessage{spam: label == "spam", verdict: f.Check(Message{Text: text})})
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("can't read labeled messages: %w", err)
+		}
+	}
+
+	minThreshold := thresholds[0]
+	for _, th := range thresholds {
+		minThreshold = math.Min(minThreshold, th)
+	}
+	hits, logMessages, regulars := []SpamEvalHit{}, 0, map[int64]int{}
+	if p.LogsPath != "" {
+		_, err := readLogs(p.LogsPath, func(msg Message) {
+			if spamText(msg) == "" {
+				return
+			}
+			regulars[msg.From.ID]++
+			logMessages++
+			if v := f.Check(msg); s.flagged(v, minThreshold) { // keep only messages flagged at some threshold
+				hits = append(hits, SpamEvalHit{Msg: msg, Verdict: v})
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("can't read logs: %w", err)
+		}
+	}
+
+	res := make([]SpamEvalResult, 0, len(thresholds))
+	for _, th := range thresholds {
+		r := SpamEvalResult{Threshold: th, LogMessages: logMessages}
+		for _, m := range labeled {
+			flagged := s.flagged(m.verdict, th)
+			switch {
+			case m.spam && flagged:
+				r.TP++
+			case m.spam:
+				r.FN++
+			case flagged:
+				r.FP++
+			default:
+				r.TN++
+			}
+		}
+		for _, h := range hits {
+			if !s.flagged(h.Verdict, th) {
+				continue
+			}
+			hit := SpamEvalHit{Msg: h.Msg, Verdict: h.Verdict.withSimilarity(th)}
+			r.Flagged = append(r.Flagged, hit)
+			if p.RegularMsgs > 0 && h.Msg.From.ID != 0 && regulars[h.Msg.From.ID] >= p.RegularMsgs {
+				r.RegularFP = append(r.RegularFP, hit)
+			}
+		}
+		res = append(res, r)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Threshold < res[j].Threshold })
+	return res, nil
+}
+
+// flagged checks if message with the verdict made without similarity check is a spam for the threshold
+func (s *SpamFilter) flagged(v SpamVerdict, threshold float64) bool {
+	if v.Len < s.MinMsgLen {
+		return false
+	}
+	return v.withSimilarity(threshold).IsSpam()
+}
+
+// withSimilarity returns verdict with similarity reason added if similarity reaches the threshold
+func (v SpamVerdict) withSimilarity(threshold float64) SpamVerdict {
+	if v.Sample == 0 || v.Similarity < threshold || v.Similarity <= v.HamSimilarity {
+		return v
+	}
+	v.Reasons = append([]string{"similarity"}, v.Reasons...)
+	return v
+}
@@ -0,0 +1,62 @@
+package bot
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpamFilter_Evaluate(t *testing.T) {
+	logs := t.TempDir()
+	lines := []string{}
+	for _, m := range []Message{
+		{ID: 1, Text: "new episode about go generics", From: User{ID: 1, Username: "regular"}},
+		{ID: 2, Text: "free iPhone for every listener", From: User{ID: 1, Username: "regular"}},
+		{ID: 3, Text: "who wants to win free iPhone", From: User{ID: 2, Username: "newbie"}},
+		{ID: 4, Text: "пишите в лс, заработок", From: User{ID: 3, Username: "spammer"}},
+		{ID: 5, Text: "short", From: User{ID: 4, Username: "other"}},
+		{ID: 6, From: User{ID: 2, Username: "newbie"}}, // no text
+	} {
+		data, err := json.Marshal(m)
+		require.NoError(t, err)
+		lines = append(lines, string(data))
+	}
+	require.NoError(t, os.WriteFile(path.Join(logs, "20240504.log"), []byte(strings.Join(lines, "\n")), 0o600))
+
+	s := NewSpamFilter(SpamParams{SpamSamples: strings.NewReader("win free iPhone\nlottery prize"),
+		SimilarityThreshold: 0.5, MinMsgLen: 10})
+	labeled := "spam\twin free iPhone today\nspam\tyou won lottery prize\nspam\tbuy crypto signals\n" +
+		"ham\tnew podcast episode\nham\tfree iPhone is a myth\nbad line\n"
+
+	res, err := s.Evaluate(SpamEvalParams{Labeled: strings.NewReader(labeled), LogsPath: logs,
+		Thresholds: []float64{0.9, 0.5}, RegularMsgs: 2})
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+
+	assert.Equal(t, 0.5, res[0].Threshold, "sorted by threshold")
+	assert.Equal(t, "threshold 0.50: precision 0.67, recall 0.67 (tp 2, fp 1, fn 1, tn 1), "+
+		"logs flagged 3 of 5, regular users flagged 1", res[0].String())
+	require.Len(t, res[0].Flagged, 3)
+	assert.Equal(t, 2, res[0].Flagged[0].Msg.ID)
+	assert.Equal(t, []string{"similarity"}, res[0].Flagged[0].Verdict.Reasons)
+	assert.Equal(t, []string{"stop words"}, res[0].Flagged[2].Verdict.Reasons)
+	require.Len(t, res[0].RegularFP, 1)
+	assert.Equal(t, "regular", res[0].RegularFP[0].Msg.From.Username)
+
+	assert.Equal(t, "threshold 0.90: precision 0.00, recall 0.00 (tp 0, fp 0, fn 3, tn 2), "+
+		"logs flagged 1 of 5, regular users flagged 0", res[1].String())
+	assert.Equal(t, 4, res[1].Flagged[0].Msg.ID)
+
+	res, err = s.Evaluate(SpamEvalParams{Labeled: strings.NewReader(labeled)})
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, 0.5, res[0].Threshold, "filter threshold by default")
+
+	_, err = s.Evaluate(SpamEvalParams{LogsPath: path.Join(logs, "[")})
+	assert.Error(t, err)
+}
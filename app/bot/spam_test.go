@@ -2,13 +2,22 @@ package bot
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/radio-t/super-bot/app/bayes"
 	"github.com/radio-t/super-bot/app/bot/mocks"
 )
 
@@ -56,13 +65,15 @@ func TestFilter_OnMessage(t *testing.T) {
 			Message{From: User{ID: 4, Username: "john", DisplayName: "John"}, Text: "Hello 😁🐶🍕 how are you? ", ID: 4},
 			Response{Text: "this is spam! go to ban, \"John\" (id:4)", Send: true,
 				BanInterval: permanentBanDuration, ReplyTo: 4, DeleteReplyTo: true,
-				User: User{ID: 4, Username: "john", DisplayName: "John"}},
+				User: User{ID: 4, Username: "john", DisplayName: "John"}, Reason: "spam: emoji",
+				Details: "similarity 0.00, emoji 3, stop words: none, cas: clean, len 32"},
 		},
 		{
 			Message{From: User{ID: 2, Username: "spammer", DisplayName: "Spammer"}, Text: "Win a free iPhone now!", ID: 2},
 			Response{Text: "this is spam! go to ban, \"Spammer\" (id:2)", Send: true,
 				ReplyTo: 2, BanInterval: permanentBanDuration, DeleteReplyTo: true,
-				User: User{ID: 2, Username: "spammer", DisplayName: "Spammer"},
+				User: User{ID: 2, Username: "spammer", DisplayName: "Spammer"}, Reason: "spam: similarity",
+				Details: `similarity 0.87 (sample 1 "win free iPhone", ham 0.00), emoji 0, stop words: none, cas: clean, len 22`,
 			},
 		},
 		{
@@ -73,14 +84,16 @@ func TestFilter_OnMessage(t *testing.T) {
 			Message{From: User{ID: 101, Username: "spammer", DisplayName: "blah"}, Text: "something something", ID: 10},
 			Response{Text: "this is spam! go to ban, \"blah\" (id:101)", Send: true,
 				ReplyTo: 10, BanInterval: permanentBanDuration, DeleteReplyTo: true,
-				User: User{ID: 101, Username: "spammer", DisplayName: "blah"},
+				User: User{ID: 101, Username: "spammer", DisplayName: "blah"}, Reason: "spam: cas",
+				Details: "similarity 0.00, emoji 0, stop words: none, cas: spam: Is a spammer, len 19",
 			},
 		},
 		{
 			Message{From: User{ID: 102, Username: "spammer", DisplayName: "blah"}, Text: "something пишите в лс something", ID: 10},
 			Response{Text: "this is spam! go to ban, \"blah\" (id:102)", Send: true,
 				ReplyTo: 10, BanInterval: permanentBanDuration, DeleteReplyTo: true,
-				User: User{ID: 102, Username: "spammer", DisplayName: "blah"},
+				User: User{ID: 102, Username: "spammer", DisplayName: "blah"}, Reason: "spam: stop words",
+				Details: `similarity 0.00, emoji 0, stop words: "пишите в лс", cas: clean, len 40`,
 			},
 		},
 	}
@@ -114,6 +127,7 @@ func TestIsSpam(t *testing.T) {
 		{"High Threshold", "You won a lottery prize!", 0.9, false},
 		{"Partial Match", "win free", 0.9, false},
 		{"Low Threshold", "win free", 0.8, true},
+		{"Lookalikes Match", "Wіn а frее іРhоnе now!", 0.5, true},
 	}
 
 	for _, test := range tests {
@@ -192,40 +206,54 @@ func TestStopWords(t *testing.T) {
 			message:  "Hello, please send me a message В ЛИЧКУ",
 			expected: true,
 		},
+		{
+			name:     "Stop word with latin lookalikes",
+			message:  "Лучший зaрaбoтoк в интeрнeтe",
+			expected: true,
+		},
+		{
+			name:     "Stop word with latin capitals",
+			message:  "пишите B ЛИЧKУ",
+			expected: true,
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			assert.Equal(t, test.expected, filter.stopWords(test.message))
+			assert.Equal(t, test.expected, len(filter.matchedStopWords(test.message)) > 0)
 		})
 	}
 }
 
-func TestSpam_isCasSpam(t *testing.T) {
+func TestSpam_casCheck(t *testing.T) {
 
 	tests := []struct {
 		name           string
 		mockResp       string
 		mockStatusCode int
 		expected       bool
+		result         string
 	}{
 		{
 			name:           "User is not a spammer",
 			mockResp:       `{"ok": false, "description": "Not a spammer"}`,
 			mockStatusCode: 200,
 			expected:       false,
+			result:         "clean",
 		},
 		{
 			name:           "User is a spammer",
 			mockResp:       `{"ok": true, "description": "Is a spammer"}`,
 			mockStatusCode: 200,
 			expected:       true,
+			result:         "spam: Is a spammer",
 		},
 		{
 			name:           "HTTP error",
 			mockResp:       "",
 			mockStatusCode: 500,
 			expected:       false,
+			result:         "error",
 		},
 	}
 
@@ -256,8 +284,9 @@ func TestSpam_isCasSpam(t *testing.T) {
 				Text: "Hello",
 			}
 
-			isSpam := s.isCasSpam(msg.From.ID)
+			isSpam, result := s.casCheck(msg.From.ID)
 			assert.Equal(t, tt.expected, isSpam)
+			assert.Equal(t, tt.result, result)
 		})
 	}
 }
@@ -298,3 +327,299 @@ func TestSpam_OnMessageCheckOnce(t *testing.T) {
 	assert.Equal(t, Response{}, res)
 	assert.Len(t, mockedHTTPClient.DoCalls(), 2, "Do should be called once more")
 }
+
+func TestSpam_OnMessageFeedback(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	tg := &mocks.TgBanClient{RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+		return &tbapi.APIResponse{Ok: true}, nil
+	}}
+	mockedHTTPClient := &mocks.HTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(`{"ok": false}`))}, nil
+	}}
+	tmp := t.TempDir()
+	modLog, err := NewModLog(path.Join(tmp, "modlog.jsonl"))
+	require.NoError(t, err)
+	params := SpamParams{
+		SuperUser:           su,
+		SpamSamples:         strings.NewReader("win free iPhone\nlottery prize"),
+		SimilarityThreshold: 0.5,
+		HTTPClient:          mockedHTTPClient,
+		SamplesFile:         path.Join(tmp, "spam.txt"),
+		HamFile:             path.Join(tmp, "ham.txt"),
+		ApprovedFile:        path.Join(tmp, "approved.jsonl"),
+		TgClient:            tg,
+		ModLog:              modLog,
+		BotUsername:         "bot",
+	}
+	s := NewSpamFilter(params)
+
+	spammer := User{ID: 10, Username: "spammer", DisplayName: "Spammer"}
+	spamText := "crypto signals\njoin my channel today"
+	assert.Equal(t, Response{}, s.OnMessage(Message{From: spammer, Text: spamText, ID: 1}), "slipped through")
+
+	assert.Equal(t, Response{}, s.OnMessage(Message{From: User{ID: 2, Username: "user"}, Text: "spam!"}), "not super")
+	assert.Equal(t, Response{Text: "ответьте на спам", Send: true, ReplyTo: 5},
+		s.OnMessage(Message{From: User{ID: 1, Username: "admin"}, Text: "spam!", ID: 5}))
+
+	botReport := Message{From: User{ID: 1, Username: "admin"}, Text: "spam!", ID: 4}
+	botReport.ReplyTo.ID, botReport.ReplyTo.From, botReport.ReplyTo.Text = 98, User{ID: 999, Username: "Bot"}, "bot answer text"
+	assert.Equal(t, Response{Text: "это сообщение бота, ответьте на спам", Send: true, ReplyTo: 4}, s.OnMessage(botReport))
+	_, err = os.Stat(params.SamplesFile)
+	assert.True(t, os.IsNotExist(err), "bot's message not saved as spam sample")
+
+	report := Message{From: User{ID: 1, Username: "admin"}, Text: "spam!", ID: 6}
+	report.ReplyTo.ID, report.ReplyTo.From, report.ReplyTo.Text = 1, spammer, spamText
+	assert.Equal(t, Response{Text: "спам от Spammer удален, образец сохранен", Send: true, ReplyTo: 1,
+		BanInterval: permanentBanDuration, DeleteReplyTo: true, User: spammer, Reason: "spam: reported"}, s.OnMessage(report))
+	data, err := os.ReadFile(params.SamplesFile)
+	require.NoError(t, err)
+	assert.Equal(t, "crypto signals join my channel today\n", string(data))
+
+	resp := s.OnMessage(Message{From: User{ID: 11, Username: "other"}, Text: "crypto signals, join my channel", ID: 7})
+	assert.Equal(t, "spam: similarity", resp.Reason, "learned immediately")
+
+	// reply to the bot's message which is not a ban notice
+	ham := Message{From: User{ID: 1, Username: "admin"}, Text: "ham!", ID: 9, ChatID: 123}
+	ham.ReplyTo.ID, ham.ReplyTo.From, ham.ReplyTo.Text = 99, User{ID: 999, Username: "Bot"}, "some answer"
+	assert.Equal(t, Response{Text: "это не уведомление о бане спамера, ответьте на него или на сообщение пользователя",
+		Send: true, ReplyTo: 9}, s.OnMessage(ham))
+	assert.Empty(t, tg.RequestCalls(), "bot not unrestricted")
+	assert.False(t, s.approvedUsers[999], "bot not approved")
+
+	// false positive banned by the filter, admin replies to the ban notice
+	innocent := User{ID: 12, Username: "innocent"}
+	require.NoError(t, modLog.Add(ModEntry{Action: ModRestrict, Source: "SpamFilter", Target: innocent,
+		Message: "free lottery prize results", NoticeID: 100}))
+	ham = Message{From: User{ID: 1, Username: "admin"}, Text: "ham!", ID: 8, ChatID: 123}
+	ham.ReplyTo.ID, ham.ReplyTo.From = 100, User{ID: 999, Username: "bot"}
+	assert.Equal(t, Response{Text: "innocent больше не считается спамером и разбанен", Send: true, ReplyTo: 8}, s.OnMessage(ham))
+	require.Len(t, tg.RequestCalls(), 1)
+	assert.Equal(t, int64(12), tg.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig).UserID)
+	assert.Empty(t, modLog.Active(time.Now()), "unban journaled")
+	data, err = os.ReadFile(params.HamFile)
+	require.NoError(t, err)
+	assert.Equal(t, "free lottery prize results\n", string(data))
+	assert.False(t, s.isSpamSimilarity("free lottery prize results"), "known false positive")
+
+	params.SpamSamples, params.HamSamples = strings.NewReader("lottery prize"), strings.NewReader("free lottery prize results")
+	s = NewSpamFilter(params)
+	assert.True(t, s.approvedUsers[12], "approved user persisted")
+	assert.False(t, s.isSpamSimilarity("free lottery prize results"), "ham samples loaded")
+	assert.True(t, s.isSpamSimilarity("lottery prize"))
+}
+
+func TestSpam_TrainAndBayes(t *testing.T) {
+	logs := t.TempDir()
+	lines := []string{}
+	for _, text := range []string{
+		"new episode about go generics is out",
+		"who is going to the meetup on friday",
+		"i use rust at work and go at home",
+		"win free iPhone now", // spam left in logs, skipped
+		"ok",                  // too short
+		"podcast about databases and go",
+	} {
+		data, err := json.Marshal(Message{Text: text, From: User{ID: 1, Username: "user"}})
+		require.NoError(t, err)
+		lines = append(lines, string(data))
+	}
+	require.NoError(t, os.WriteFile(path.Join(logs, "20240504.log"), []byte(strings.Join(lines, "\n")), 0o600))
+
+	s := NewSpamFilter(SpamParams{
+		SpamSamples: strings.NewReader("win free iPhone\nlottery prize\ncrypto signals join my channel\n" +
+			"earn money remote work write me"),
+		HamSamples:          strings.NewReader("free software episode"),
+		SimilarityThreshold: 0.5,
+		MinMsgLen:           5,
+	})
+	model, err := s.Train(logs)
+	require.NoError(t, err)
+	assert.Equal(t, 4, model.Docs[bayes.Spam])
+	assert.Equal(t, 5, model.Docs[bayes.Ham], "1 ham sample and 4 log messages")
+
+	_, err = s.Train(path.Join(logs, "[")) // bad glob pattern
+	assert.Error(t, err)
+
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return false }}
+	mockedHTTPClient := &mocks.HTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(`{"ok": false}`))}, nil
+	}}
+	s = NewSpamFilter(SpamParams{SpamSamples: strings.NewReader("win free iPhone"), SimilarityThreshold: 0.9,
+		SuperUser: su, HTTPClient: mockedHTTPClient, Classifier: model, BayesThreshold: 0.9})
+	resp := s.OnMessage(Message{From: User{ID: 2, Username: "spammer"}, Text: "join crypto channel and earn money", ID: 1})
+	assert.Equal(t, "spam: bayes", resp.Reason)
+	assert.Len(t, mockedHTTPClient.DoCalls(), 1, "cas checked even if detected locally")
+	resp = s.OnMessage(Message{From: User{ID: 3, Username: "user"}, Text: "new podcast episode about go", ID: 2})
+	assert.Equal(t, Response{}, resp)
+}
+
+func TestSpam_Check(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return false }}
+	mockedHTTPClient := &mocks.HTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(`{"ok": false}`))}, nil
+	}}
+	model := bayes.New()
+	model.Learn(bayes.Spam, map[string]int{"lottery": 1, "prize": 1})
+	model.Learn(bayes.Ham, map[string]int{"podcast": 1})
+	s := NewSpamFilter(SpamParams{SpamSamples: strings.NewReader("win free iPhone\nlottery prize"),
+		HamSamples: strings.NewReader("lottery results episode"), SimilarityThreshold: 0.5, SuperUser: su,
+		HTTPClient: mockedHTTPClient, Classifier: model, BayesThreshold: 0.99, Dry: true})
+
+	v := s.Check(Message{From: User{ID: 2}, Text: "lottery prize в личку"})
+	assert.Equal(t, []string{"similarity", "stop words"}, v.Reasons)
+	assert.Equal(t, 2, v.Sample)
+	assert.InDelta(t, 0.33, v.HamSimilarity, 0.01)
+	assert.Equal(t, []string{"в личку"}, v.StopWords)
+	assert.Equal(t, `similarity 0.82 (sample 2 "lottery prize", ham 0.33), emoji 0, stop words: "в личку", `+
+		`bayes 0.719, cas: clean, len 27`, v.String())
+	assert.Len(t, mockedHTTPClient.DoCalls(), 1)
+
+	v = s.Check(Message{From: User{ID: 3}, Text: "new podcast episode"})
+	assert.False(t, v.IsSpam())
+	assert.Equal(t, "similarity 0.00, emoji 0, stop words: none, bayes 0.286, cas: clean, len 19", v.String())
+	assert.Len(t, mockedHTTPClient.DoCalls(), 2)
+
+	resp := s.OnMessage(Message{From: User{ID: 4, Username: "spammer"}, Text: "win free iPhone", ID: 5})
+	assert.Equal(t, Response{Text: "this is spam from \"spammer\", but I'm in dry mode, so I'll do nothing yet\n" +
+		`similarity 1.00 (sample 1 "win free iPhone", ham 0.00), emoji 0, stop words: none, bayes 0.500, cas: clean, len 15`,
+		Send: true, ReplyTo: 5}, resp, "dry mode shows the breakdown in chat")
+}
+
+func TestSpam_OnMessageNewUsers(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return false }}
+	mockedHTTPClient := &mocks.HTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(`{"ok": false}`))}, nil
+	}}
+	params := SpamParams{SpamSamples: strings.NewReader("win free iPhone\nlottery prize"),
+		SimilarityThreshold: 0.5, SuperUser: su, HTTPClient: mockedHTTPClient, MinMsgLen: 30, FirstMessages: 2,
+		ApprovedFile: path.Join(t.TempDir(), "approved.jsonl")}
+	s := NewSpamFilter(params)
+
+	t.Run("caption", func(t *testing.T) {
+		msg := Message{ID: 1, From: User{ID: 10, Username: "photo"},
+			Image: &Image{FileID: "123", Caption: "win free iPhone, just write me in private messages"}}
+		resp := s.OnMessage(msg)
+		assert.Equal(t, "spam: similarity", resp.Reason)
+	})
+
+	t.Run("short text link to telegram", func(t *testing.T) {
+		msg := Message{ID: 2, From: User{ID: 11, Username: "linker"}, Text: "заходи сюда",
+			Entities: &[]Entity{{Type: "text_link", Offset: 0, Length: 11, URL: "https://t.me/spam_channel"}}}
+		resp := s.OnMessage(msg)
+		assert.Equal(t, "suspicious: link only, telegram link", resp.Reason)
+		assert.Contains(t, resp.Details, "links 1")
+		assert.Equal(t, time.Hour, resp.BanInterval, "muted for a while, not banned")
+		assert.False(t, resp.DeleteReplyTo, "message kept for admins")
+		assert.Equal(t, User{ID: 11, Username: "linker"}, resp.User)
+		assert.Equal(t, "подозрительное сообщение от linker (id:11): link only, telegram link, помолчите час. "+
+			"Админы, ответьте ham! если это не спам или spam! на сообщение, если спам", resp.Text)
+	})
+
+	t.Run("forward with mention", func(t *testing.T) {
+		msg := Message{ID: 3, From: User{ID: 12, Username: "forwarder"}, Forwarded: true,
+			Text: "the best signals for crypto traders, subscribe to @signals_channel and get rich"}
+		resp := s.OnMessage(msg)
+		assert.Equal(t, "suspicious: forward", resp.Reason)
+		assert.Contains(t, resp.Details, "mentions 1, forwarded")
+	})
+
+	t.Run("mention and email", func(t *testing.T) {
+		user := User{ID: 15, Username: "grateful"}
+		assert.Equal(t, Response{}, s.OnMessage(Message{ID: 11, From: user, Text: "@umputun спасибо"}))
+		v := s.inspect(Message{Text: "пишите на mail@example.com или @umputun, @bobuk_x"})
+		assert.Equal(t, 2, v.Mentions, "email is not a mention")
+		assert.Equal(t, 4, v.Words)
+	})
+
+	t.Run("first messages", func(t *testing.T) {
+		user := User{ID: 13, Username: "newbie"}
+		assert.Equal(t, Response{}, s.OnMessage(Message{ID: 4, From: user, Text: "thanks for the new episode, great one"}))
+		assert.False(t, s.approvedUsers[13], "one clean message is not enough")
+		resp := s.OnMessage(Message{ID: 6, From: user, Text: "look https://github.com"})
+		assert.Equal(t, "suspicious: link only", resp.Reason, "still checked with stricter rules")
+
+		user = User{ID: 14, Username: "regular"}
+		s.OnMessage(Message{ID: 7, From: user, Text: "thanks for the new episode, great one"})
+		s.OnMessage(Message{ID: 8, From: user, Text: "short"})
+		assert.True(t, s.approvedUsers[14], "approved after two clean messages, short ones count too")
+		assert.Equal(t, Response{}, s.OnMessage(Message{ID: 10, From: user, Text: "look https://t.me/radio_t"}))
+
+		params.SpamSamples = strings.NewReader("win free iPhone")
+		restarted := NewSpamFilter(params)
+		assert.True(t, restarted.approvedUsers[14], "approval persisted")
+		assert.False(t, restarted.approvedUsers[13])
+
+		blocklist, err := NewBlocklist(path.Join(t.TempDir(), "blocklist.jsonl"))
+		require.NoError(t, err)
+		require.NoError(t, blocklist.Add(user, "spam: reported"))
+		params.SpamSamples, params.Blocklist = strings.NewReader("win free iPhone"), blocklist
+		restarted = NewSpamFilter(params)
+		assert.False(t, restarted.approvedUsers[14], "blocklisted after approval")
+	})
+}
+
+func TestSpam_CasCacheAndBlocklist(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Query().Get("user_id") {
+		case "101":
+			_, _ = w.Write([]byte(`{"ok": true, "description": "Is a spammer"}`))
+		case "200": // slow
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		default:
+			_, _ = w.Write([]byte(`{"ok": false, "description": "Not a spammer"}`))
+		}
+	}))
+	defer ts.Close()
+
+	blocklist, err := NewBlocklist(path.Join(t.TempDir(), "blocklist.jsonl"))
+	require.NoError(t, err)
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	s := NewSpamFilter(SpamParams{SpamSamples: strings.NewReader("win free iPhone"), SimilarityThreshold: 0.5,
+		SuperUser: su, CasAPI: ts.URL, HTTPClient: &http.Client{}, CasTimeout: 50 * time.Millisecond,
+		CasTTL: time.Hour, Blocklist: blocklist})
+	now := time.Date(2024, 5, 4, 20, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	t.Run("cache", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		assert.Equal(t, "clean", s.Check(Message{From: User{ID: 100}, Text: "hello"}).CAS)
+		assert.Equal(t, "clean (cached)", s.Check(Message{From: User{ID: 100}, Text: "hello"}).CAS)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+		now = now.Add(2 * time.Hour)
+		assert.Equal(t, "clean", s.Check(Message{From: User{ID: 100}, Text: "hello"}).CAS, "expired")
+		assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("slow cas paused", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		for i := 0; i < casMaxFailures; i++ {
+			assert.Equal(t, "error", s.Check(Message{From: User{ID: 200}, Text: "hello"}).CAS)
+		}
+		assert.Equal(t, "unavailable", s.Check(Message{From: User{ID: 101}, Text: "hello"}).CAS)
+		assert.Equal(t, int32(casMaxFailures), atomic.LoadInt32(&requests), "not asked while paused")
+		now = now.Add(casPause)
+		assert.Equal(t, "spam: Is a spammer", s.Check(Message{From: User{ID: 101}, Text: "hello"}).CAS)
+	})
+
+	t.Run("blocklist", func(t *testing.T) {
+		resp := s.OnMessage(Message{ID: 1, From: User{ID: 300, Username: "spammer"}, Text: "win free iPhone"})
+		assert.Equal(t, "spam: similarity", resp.Reason)
+		assert.True(t, blocklist.Contains(300), "own ban added to blocklist")
+
+		atomic.StoreInt32(&requests, 0)
+		v := s.Check(Message{From: User{ID: 300}, Text: "hello"})
+		assert.Equal(t, []string{"blocklist"}, v.Reasons)
+		assert.Equal(t, "skipped", v.CAS)
+		assert.Equal(t, int32(0), atomic.LoadInt32(&requests), "blocklist checked before cas")
+
+		ham := Message{ID: 2, From: User{ID: 1, Username: "admin"}, Text: "ham!"}
+		ham.ReplyTo.ID, ham.ReplyTo.From, ham.ReplyTo.Text = 1, User{ID: 300, Username: "spammer"}, "win free iPhone"
+		s.OnMessage(ham)
+		assert.False(t, blocklist.Contains(300), "removed by ham!")
+	})
+}
@@ -11,9 +11,10 @@ import (
 )
 
 // Sys implements basic bot function to respond on ping and others from basic.data file.
-// also, reacts on say! with keys/values from say.data file
+// also, reacts on say! with keys/values from say.data file and saved quotes
 type Sys struct {
 	say          []string
+	quotes       *QuoteStore
 	dataLocation string
 	commands     []sysCommand
 }
@@ -25,16 +26,24 @@ type sysCommand struct {
 	message     string
 }
 
-// NewSys makes new sys bot and load data to []say and basic map
-func NewSys(dataLocation string) (*Sys, error) {
+// NewSys makes new sys bot and load data to []say and basic map.
+// If quotes store is set, say! picks from it, and missing say.data lines are merged to the store as authorless quotes on every start.
+func NewSys(dataLocation string, quotes *QuoteStore) (*Sys, error) {
 	log.Printf("[INFO] created sys bot, data location=%s", dataLocation)
-	res := Sys{dataLocation: dataLocation}
+	res := Sys{dataLocation: dataLocation, quotes: quotes}
 	if err := res.loadBasicData(); err != nil {
 		return nil, err
 	}
 	if err := res.loadSayData(); err != nil {
 		return nil, err
 	}
+	if quotes != nil {
+		count, err := quotes.Import(res.say)
+		if err != nil {
+			return nil, fmt.Errorf("can't import say.data to quotes: %w", err)
+		}
+		log.Printf("[INFO] merged %d new say.data records to quotes", count)
+	}
 	return &res, nil
 }
 
@@ -53,6 +62,12 @@ func (p *Sys) OnMessage(msg Message) (response Response) {
 	}
 
 	if strings.EqualFold(msg.Text, "say!") {
+		if p.quotes != nil {
+			if q, ok := p.quotes.Random(); ok {
+				return Response{Text: renderQuote(q), Send: true}
+			}
+			return Response{}
+		}
 		if p.say != nil && len(p.say) > 0 {
 			return Response{
 				Text: fmt.Sprintf("_%s_", EscapeMarkDownV1Text(p.say[rand.Intn(len(p.say))])), // nolint
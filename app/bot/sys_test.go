@@ -9,7 +9,7 @@ import (
 )
 
 func TestSys_OnMessage(t *testing.T) {
-	bot, err := NewSys("./../../data")
+	bot, err := NewSys("./../../data", nil)
 	require.NoError(t, err)
 	rand.Seed(0) // nolint
 	assert.Equal(t, Response{Text: "_никто не знает. пока не надоест_", Send: true}, bot.OnMessage(Message{Text: "доколе?"}))
@@ -19,7 +19,7 @@ func TestSys_OnMessage(t *testing.T) {
 }
 
 func TestSys_Help(t *testing.T) {
-	bot, err := NewSys("./../../data")
+	bot, err := NewSys("./../../data", nil)
 	require.NoError(t, err)
 	assert.Equal(t, "say! _– набраться мудрости_\n"+
 		"ping _– ответит pong_\n"+
@@ -32,6 +32,6 @@ func TestSys_Help(t *testing.T) {
 }
 
 func TestSys_Failed(t *testing.T) {
-	_, err := NewSys("/tmp/no-such-place")
+	_, err := NewSys("/tmp/no-such-place", nil)
 	require.Error(t, err)
 }
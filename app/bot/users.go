@@ -0,0 +1,253 @@
+package bot
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// KnownUser is a user seen in the chat, with all usernames and display names used before
+type KnownUser struct {
+	User
+	PrevUsernames []string  `json:"prev_usernames,omitempty"`
+	PrevNames     []string  `json:"prev_names,omitempty"`
+	FirstSeen     time.Time `json:"first_seen"`
+	Updated       time.Time `json:"updated"` // time of the most recent username or display name
+}
+
+// UserDirectory maps usernames to user ids. It is built from incoming messages and persisted to jsonl file,
+// so users can be resolved after restart and after username change.
+// The file has a record per change, the last record for the user wins.
+type UserDirectory struct {
+	file  *storage.JSONL[KnownUser]
+	lock  sync.RWMutex
+	users map[int64]*KnownUser
+}
+
+// NewUserDirectory loads users from the file
+func NewUserDirectory(path string) (*UserDirectory, error) {
+	file, err := storage.NewJSONL[KnownUser](path)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := file.Load()
+	if err != nil {
+		return nil, fmt.Errorf("can't load users: %w", err)
+	}
+	res := &UserDirectory{file: file, users: map[int64]*KnownUser{}}
+	for i := range recs {
+		res.users[recs[i].ID] = &recs[i]
+	}
+
+	if len(recs) > len(res.users) { // compact, keep the last record only
+		if err := file.Replace(res.list()); err != nil {
+			return nil, fmt.Errorf("can't compact users: %w", err)
+		}
+	}
+	log.Printf("[INFO] loaded %d users from %s", len(res.users), path)
+	return res, nil
+}
+
+// Observe updates directory with sender of the message and sender of replied message
+func (d *UserDirectory) Observe(msg Message) {
+	ts := msg.Sent
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	for _, u := range []User{msg.From, msg.ReplyTo.From} {
+		if err := d.update(u, ts); err != nil {
+			log.Printf("[WARN] can't update user %+v, %v", u, err)
+		}
+	}
+}
+
+// Lookup finds user by id or by username, current or previous, case-insensitive and with optional "@" prefix.
+// Current username takes precedence over previous one, as the name could be taken by another user.
+func (d *UserDirectory) Lookup(name string) (KnownUser, bool) {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "@")
+	if name == "" {
+		return KnownUser{}, false
+	}
+
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if id, err := strconv.ParseInt(name, 10, 64); err == nil {
+		if u, ok := d.users[id]; ok {
+			return *u, true
+		}
+	}
+
+	var current, prev *KnownUser
+	for _, u := range d.users {
+		if strings.EqualFold(u.Username, name) && (current == nil || u.Updated.After(current.Updated)) {
+			current = u
+		}
+		for _, p := range u.PrevUsernames {
+			if strings.EqualFold(p, name) && (prev == nil || u.Updated.After(prev.Updated)) {
+				prev = u
+			}
+		}
+	}
+	switch {
+	case current != nil:
+		return *current, true
+	case prev != nil:
+		return *prev, true
+	}
+	return KnownUser{}, false
+}
+
+// Len returns number of known users
+func (d *UserDirectory) Len() int {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return len(d.users)
+}
+
+// Backfill observes all messages from reporter's log files (*.log, json message per line) in logsPath,
+// returns number of messages processed
+func (d *UserDirectory) Backfill(logsPath string) (int, error) {
+	count := 0
+	_, err := readLogs(logsPath, func(msg Message) {
+		if msg.Sent.IsZero() {
+			return // don't let undated messages override newer names
+		}
+		d.Observe(msg)
+		count++
+	})
+	log.Printf("[INFO] backfilled users from %d messages, %d users known", count, d.Len())
+	return count, err
+}
+
+// readLogs calls fn for every message from reporter's log files (*.log, json message per line) in logsPath,
+// oldest first. Returns number of messages read.
+func readLogs(logsPath string, fn func(msg Message)) (int, error) {
+	files, err := filepath.Glob(filepath.Join(logsPath, "*.log"))
+	if err != nil {
+		return 0, fmt.Errorf("can't list logs in %s: %w", logsPath, err)
+	}
+	sort.Strings(files) // file names are dates, oldest first
+
+	count := 0
+	for _, fname := range files {
+		n, err := readLogFile(fname, fn)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+func readLogFile(fname string, fn func(msg Message)) (int, error) {
+	fh, err := os.Open(fname) // nolint
+	if err != nil {
+		return 0, fmt.Errorf("can't open %s: %w", fname, err)
+	}
+	defer fh.Close() // nolint
+
+	count := 0
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		msg := Message{}
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.Printf("[WARN] can't parse log line in %s, %v", fname, err)
+			continue
+		}
+		fn(msg)
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return count, fmt.Errorf("can't read %s: %w", fname, err)
+	}
+	return count, nil
+}
+
+// update adds or changes the user, persists the record on any change.
+// Names seen before the last update go to history only, so backfill doesn't override current names.
+func (d *UserDirectory) update(u User, ts time.Time) error {
+	if u.ID == 0 {
+		return nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	ku, ok := d.users[u.ID]
+	if !ok {
+		ku = &KnownUser{User: u, FirstSeen: ts, Updated: ts}
+		if err := d.file.Append(*ku); err != nil {
+			return fmt.Errorf("can't save user: %w", err)
+		}
+		d.users[u.ID] = ku
+		return nil
+	}
+
+	upd := *ku
+	upd.PrevUsernames = append([]string{}, ku.PrevUsernames...)
+	upd.PrevNames = append([]string{}, ku.PrevNames...)
+	if ts.Before(upd.FirstSeen) {
+		upd.FirstSeen = ts
+	}
+	newer := !ts.Before(upd.Updated)
+	if u.Username != "" && !strings.EqualFold(u.Username, upd.Username) {
+		if newer {
+			upd.PrevUsernames = appendUnique(upd.PrevUsernames, upd.Username)
+			upd.Username = u.Username
+			upd.Updated = ts
+		} else {
+			upd.PrevUsernames = appendUnique(upd.PrevUsernames, u.Username)
+		}
+	}
+	if u.DisplayName != "" && u.DisplayName != upd.DisplayName {
+		if newer {
+			upd.PrevNames = appendUnique(upd.PrevNames, upd.DisplayName)
+			upd.DisplayName = u.DisplayName
+			upd.Updated = ts
+		} else {
+			upd.PrevNames = appendUnique(upd.PrevNames, u.DisplayName)
+		}
+	}
+
+	if upd.Username == ku.Username && upd.DisplayName == ku.DisplayName && upd.FirstSeen.Equal(ku.FirstSeen) &&
+		len(upd.PrevUsernames) == len(ku.PrevUsernames) && len(upd.PrevNames) == len(ku.PrevNames) {
+		return nil // nothing changed
+	}
+	if err := d.file.Append(upd); err != nil {
+		return fmt.Errorf("can't save user: %w", err)
+	}
+	*ku = upd
+	return nil
+}
+
+func (d *UserDirectory) list() []KnownUser {
+	res := make([]KnownUser, 0, len(d.users))
+	for _, u := range d.users {
+		res = append(res, *u)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].FirstSeen.Before(res[j].FirstSeen) })
+	return res
+}
+
+func appendUnique(list []string, s string) []string {
+	if s == "" {
+		return list
+	}
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return list
+		}
+	}
+	return append(list, s)
+}
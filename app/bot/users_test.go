@@ -0,0 +1,96 @@
+package bot
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserDirectory(t *testing.T) {
+	fname := path.Join(t.TempDir(), "users.jsonl")
+	users, err := NewUserDirectory(fname)
+	require.NoError(t, err)
+
+	ts := time.Date(2024, 5, 4, 20, 0, 0, 0, time.UTC)
+	msg := Message{From: User{ID: 1, Username: "user1", DisplayName: "User One"}, Sent: ts}
+	msg.ReplyTo.From = User{ID: 2, Username: "user2"}
+	users.Observe(msg)
+	users.Observe(msg)
+	users.Observe(Message{From: User{ID: 1, Username: "user1_new", DisplayName: "User One"}, Sent: ts.Add(time.Hour)})
+	users.Observe(Message{From: User{ID: 3, Username: "user1"}, Sent: ts.Add(2 * time.Hour)}) // took old name
+	users.Observe(Message{From: User{Username: "no_id"}})
+	assert.Equal(t, 3, users.Len())
+
+	u, ok := users.Lookup("@User1_New")
+	require.True(t, ok)
+	assert.Equal(t, int64(1), u.ID)
+	assert.Equal(t, []string{"user1"}, u.PrevUsernames)
+	assert.Equal(t, ts, u.FirstSeen)
+
+	u, ok = users.Lookup("user1")
+	require.True(t, ok)
+	assert.Equal(t, int64(3), u.ID, "current name wins")
+
+	u, ok = users.Lookup("2")
+	require.True(t, ok)
+	assert.Equal(t, "user2", u.Username, "by id")
+
+	_, ok = users.Lookup("nobody")
+	assert.False(t, ok)
+	_, ok = users.Lookup("@")
+	assert.False(t, ok)
+
+	// older message doesn't override current name
+	users.Observe(Message{From: User{ID: 1, Username: "ancient", DisplayName: "Old Name"}, Sent: ts.Add(-time.Hour)})
+	u, _ = users.Lookup("ancient")
+	assert.Equal(t, "user1_new", u.Username)
+	assert.Equal(t, []string{"user1", "ancient"}, u.PrevUsernames)
+	assert.Equal(t, []string{"Old Name"}, u.PrevNames)
+	assert.Equal(t, ts.Add(-time.Hour), u.FirstSeen)
+
+	users, err = NewUserDirectory(fname)
+	require.NoError(t, err)
+	assert.Equal(t, 3, users.Len(), "reloaded")
+	u, ok = users.Lookup("user1_new")
+	require.True(t, ok)
+	assert.Equal(t, []string{"user1", "ancient"}, u.PrevUsernames)
+
+	data, err := os.ReadFile(fname) // nolint
+	require.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(data), "\n"), "compacted on load")
+}
+
+func TestUserDirectory_Backfill(t *testing.T) {
+	tmp := t.TempDir()
+	logs := path.Join(tmp, "logs")
+	require.NoError(t, os.MkdirAll(logs, 0o750))
+	require.NoError(t, os.WriteFile(path.Join(logs, "20240501.log"), []byte(
+		`{"ID":1,"From":{"ID":10,"Username":"user10","DisplayName":"Ten"},"Sent":"2024-05-01T10:00:00Z","Text":"hi"}
+broken line
+{"ID":2,"From":{"ID":11,"Username":"user11"},"Sent":"2024-05-01T11:00:00Z","Text":"hello"}
+`), 0o600))
+	require.NoError(t, os.WriteFile(path.Join(logs, "20240502.log"), []byte(
+		`{"ID":3,"From":{"ID":10,"Username":"user10_renamed"},"Sent":"2024-05-02T10:00:00Z","Text":"me again"}
+`), 0o600))
+
+	users, err := NewUserDirectory(path.Join(tmp, "users.jsonl"))
+	require.NoError(t, err)
+	count, err := users.Backfill(logs)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 2, users.Len())
+
+	u, ok := users.Lookup("user10")
+	require.True(t, ok)
+	assert.Equal(t, "user10_renamed", u.Username)
+	assert.Equal(t, "Ten", u.DisplayName)
+
+	count, err = users.Backfill(path.Join(tmp, "no-such-dir"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
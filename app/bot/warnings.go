@@ -0,0 +1,318 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// Warning is a warning given by superuser to the author of a message
+type Warning struct {
+	ID        int       `json:"id"`
+	Time      time.Time `json:"time"`
+	User      User      `json:"user"` // warned user
+	By        User      `json:"by"`   // superuser gave the warning
+	Reason    string    `json:"reason,omitempty"`
+	MessageID int       `json:"message_id,omitempty"` // message the warning given for
+	Message   string    `json:"message,omitempty"`
+	Retracted bool      `json:"retracted,omitempty"` // set by unwarn!
+}
+
+// WarningStore keeps all warnings in memory and persists them to jsonl file.
+// Retraction appends the updated warning, the last record with the same ID wins.
+type WarningStore struct {
+	file     *storage.JSONL[Warning]
+	lock     sync.RWMutex
+	warnings []Warning // sorted by ID
+}
+
+// NewWarningStore loads warnings from the file
+func NewWarningStore(path string) (*WarningStore, error) {
+	file, err := storage.NewJSONL[Warning](path)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := file.Load()
+	if err != nil {
+		return nil, fmt.Errorf("can't load warnings: %w", err)
+	}
+
+	byID := map[int]Warning{}
+	for _, r := range recs {
+		byID[r.ID] = r
+	}
+	res := &WarningStore{file: file, warnings: make([]Warning, 0, len(byID))}
+	for _, w := range byID {
+		res.warnings = append(res.warnings, w)
+	}
+	sort.Slice(res.warnings, func(i, j int) bool { return res.warnings[i].ID < res.warnings[j].ID })
+
+	if len(recs) > len(byID) { // compact, keep the last record only
+		if err := file.Replace(res.warnings); err != nil {
+			return nil, fmt.Errorf("can't compact warnings: %w", err)
+		}
+	}
+	log.Printf("[INFO] loaded %d warnings from %s", len(res.warnings), path)
+	return res, nil
+}
+
+// Add saves the warning with the next ID, sets time to now if not set
+func (s *WarningStore) Add(w Warning) (Warning, error) {
+	if w.Time.IsZero() {
+		w.Time = time.Now()
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	w.ID = 1
+	if len(s.warnings) > 0 {
+		w.ID = s.warnings[len(s.warnings)-1].ID + 1
+	}
+	if err := s.file.Append(w); err != nil {
+		return Warning{}, fmt.Errorf("can't save warning: %w", err)
+	}
+	s.warnings = append(s.warnings, w)
+	return w, nil
+}
+
+// Active returns not retracted warnings of the user given since the time, oldest first
+func (s *WarningStore) Active(userID int64, since time.Time) []Warning {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	res := []Warning{}
+	for _, w := range s.warnings {
+		if w.User.ID == userID && !w.Retracted && !w.Time.Before(since) {
+			res = append(res, w)
+		}
+	}
+	return res
+}
+
+// Retract marks the warning as retracted
+func (s *WarningStore) Retract(id int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i := range s.warnings {
+		if s.warnings[i].ID != id {
+			continue
+		}
+		w := s.warnings[i]
+		w.Retracted = true
+		if err := s.file.Append(w); err != nil {
+			return fmt.Errorf("can't save retracted warning: %w", err)
+		}
+		s.warnings[i] = w
+		return nil
+	}
+	return fmt.Errorf("warning %d not found", id)
+}
+
+// WarnStep is a penalty applied when user collected the number of active warnings
+type WarnStep struct {
+	Warnings int
+	Duration time.Duration // permanentBanDuration is a ban
+}
+
+// ParseWarnSteps parses penalties like "3:24h", number of warnings and mute duration, 0 duration is a ban
+func ParseWarnSteps(specs []string) ([]WarnStep, error) {
+	res := make([]WarnStep, 0, len(specs))
+	for _, spec := range specs {
+		count, dur, ok := strings.Cut(spec, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid warn step %q, expected warnings:duration", spec)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid number of warnings in %q", spec)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(dur))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid duration in warn step %q", spec)
+		}
+		if d == 0 {
+			d = permanentBanDuration
+		}
+		res = append(res, WarnStep{Warnings: n, Duration: d})
+	}
+	return res, nil
+}
+
+// Warnings bot allows superusers to warn users, repeated warnings lead to mute and ban
+type Warnings struct {
+	store     *WarningStore
+	superUser SuperUser
+	users     *UserDirectory // optional, resolves usernames for warnings! @user
+	expire    time.Duration  // warnings older than this are ignored
+	steps     []WarnStep     // penalties for active warnings, sorted by number of warnings
+	now       func() time.Time
+}
+
+// NewWarnings makes a warnings bot, warnings expire after the given period, 0 means never.
+// Steps set penalties for the number of active warnings, no steps means warnings without penalties.
+func NewWarnings(store *WarningStore, superUser SuperUser, users *UserDirectory, expire time.Duration, steps []WarnStep) *Warnings {
+	steps = append([]WarnStep(nil), steps...)
+	sort.Slice(steps, func(i, j int) bool { return steps[i].Warnings < steps[j].Warnings })
+	log.Printf("[INFO] warnings bot, expire: %v, escalation: %+v", expire, steps)
+	return &Warnings{store: store, superUser: superUser, users: users, expire: expire, steps: steps, now: time.Now}
+}
+
+// Help returns help message
+func (w *Warnings) Help() string {
+	return GenHelpMsg([]string{"warn!", "unwarn!"}, "предупредить пользователя или отменить предупреждение, "+
+		"ответом на сообщение (только для админов)") +
+		GenHelpMsg([]string{"warnings!"}, "активные предупреждения, warnings! @user для другого пользователя")
+}
+
+// ReactOn keys
+func (w *Warnings) ReactOn() []string {
+	return []string{"warn!", "unwarn!", "warnings!"}
+}
+
+// OnMessage handles warn!, unwarn! and warnings! commands
+func (w *Warnings) OnMessage(msg Message) (response Response) {
+	fields := strings.Fields(msg.Text)
+	if len(fields) == 0 {
+		return Response{}
+	}
+	cmd, args := strings.ToLower(fields[0]), fields[1:]
+	switch cmd {
+	case "warn!":
+		if !w.superUser.IsSuper(msg.From.Username) {
+			return Response{}
+		}
+		return w.warn(msg, strings.Join(args, " "))
+	case "unwarn!":
+		if !w.superUser.IsSuper(msg.From.Username) {
+			return Response{}
+		}
+		return w.unwarn(msg, args)
+	case "warnings!":
+		return w.list(msg, args)
+	}
+	return Response{}
+}
+
+// warn adds warning to the author of replied message and mutes or bans the author if escalation step reached
+func (w *Warnings) warn(msg Message, reason string) Response {
+	user := msg.ReplyTo.From
+	if user.ID == 0 || msg.ReplyTo.SenderChat.ID != 0 {
+		return Response{Text: "ответьте на сообщение пользователя", Send: true, ReplyTo: msg.ID}
+	}
+	if w.superUser.IsSuper(user.Username) {
+		return Response{}
+	}
+
+	warning, err := w.store.Add(Warning{Time: w.now(), User: user, By: msg.From, Reason: reason,
+		MessageID: msg.ReplyTo.ID, Message: msg.ReplyTo.Text})
+	if err != nil {
+		log.Printf("[WARN] can't add warning for %+v, %v", user, err)
+		return Response{Text: "не удалось сохранить предупреждение", Send: true, ReplyTo: msg.ID}
+	}
+	active := len(w.store.Active(user.ID, w.since()))
+	log.Printf("[INFO] warning %d for %+v by %s, active: %d, reason: %q", warning.ID, user, msg.From.Username, active, reason)
+
+	text := fmt.Sprintf("%s получает предупреждение", EscapeMarkDownV1Text(DisplayName(Message{From: user})))
+	if reason != "" {
+		text += ", причина: " + EscapeMarkDownV1Text(reason)
+	}
+	text += fmt.Sprintf(". Активных предупреждений: %d", active)
+
+	resp := Response{Text: text, Send: true, ReplyTo: msg.ReplyTo.ID}
+	var penalty *WarnStep // the highest step reached, warnings over it after unwarn or unban still count
+	for i, step := range w.steps {
+		if active >= step.Warnings {
+			penalty = &w.steps[i]
+		}
+	}
+	if penalty == nil {
+		return resp
+	}
+	resp.BanInterval, resp.User = penalty.Duration, user
+	resp.Reason = fmt.Sprintf("warnings: %d", active)
+	if penalty.Duration >= permanentBanDuration {
+		resp.Text += ", бан навсегда"
+	} else {
+		resp.Text += ", молчит " + HumanizeDuration(penalty.Duration)
+	}
+	return resp
+}
+
+// unwarn retracts the last active warning of the user set by reply or by name
+func (w *Warnings) unwarn(msg Message, args []string) Response {
+	user, err := w.target(msg, args)
+	if err != nil {
+		return Response{Text: err.Error(), Send: true, ReplyTo: msg.ID}
+	}
+	active := w.store.Active(user.ID, w.since())
+	if len(active) == 0 {
+		return Response{Text: fmt.Sprintf("у %s нет активных предупреждений", EscapeMarkDownV1Text(DisplayName(Message{From: user}))),
+			Send: true, ReplyTo: msg.ID}
+	}
+	last := active[len(active)-1]
+	if err := w.store.Retract(last.ID); err != nil {
+		log.Printf("[WARN] can't retract warning %d, %v", last.ID, err)
+		return Response{Text: "не удалось отменить предупреждение", Send: true, ReplyTo: msg.ID}
+	}
+	log.Printf("[INFO] warning %d for %+v retracted by %s", last.ID, user, msg.From.Username)
+	return Response{Text: fmt.Sprintf("предупреждение для %s от %s отменено, осталось активных: %d",
+		EscapeMarkDownV1Text(DisplayName(Message{From: user})), last.Time.Format("02.01.2006"), len(active)-1), Send: true, ReplyTo: msg.ID}
+}
+
+// list shows active warnings of the user set by name, by reply or of the sender
+func (w *Warnings) list(msg Message, args []string) Response {
+	user, err := w.target(msg, args)
+	if err != nil && len(args) > 0 {
+		return Response{Text: err.Error(), Send: true, ReplyTo: msg.ID}
+	}
+	if err != nil {
+		user = msg.From
+	}
+
+	mention := EscapeMarkDownV1Text(DisplayName(Message{From: user}))
+	active := w.store.Active(user.ID, w.since())
+	if len(active) == 0 {
+		return Response{Text: fmt.Sprintf("у %s нет активных предупреждений", mention), Send: true, ReplyTo: msg.ID}
+	}
+	lines := []string{fmt.Sprintf("предупреждения %s:", mention)}
+	for i, wr := range active {
+		line := fmt.Sprintf("%d. %s", i+1, wr.Time.Format("02.01.2006"))
+		if wr.Reason != "" {
+			line += " " + EscapeMarkDownV1Text(wr.Reason)
+		}
+		if w.expire > 0 {
+			line += ", истекает " + wr.Time.Add(w.expire).Format("02.01.2006")
+		}
+		lines = append(lines, line)
+	}
+	return Response{Text: strings.Join(lines, "\n"), Send: true, ReplyTo: msg.ID}
+}
+
+// since returns time of the oldest active warning, all warnings are active if expire is not set
+func (w *Warnings) since() time.Time {
+	if w.expire <= 0 {
+		return time.Time{}
+	}
+	return w.now().Add(-w.expire)
+}
+
+// target returns user set by name in args or by replied message
+func (w *Warnings) target(msg Message, args []string) (User, error) {
+	if len(args) > 0 {
+		if w.users != nil {
+			if ku, found := w.users.Lookup(args[0]); found {
+				return ku.User, nil
+			}
+		}
+		return User{}, fmt.Errorf("не знаю пользователя %s", EscapeMarkDownV1Text(args[0]))
+	}
+	if msg.ReplyTo.From.ID != 0 && msg.ReplyTo.SenderChat.ID == 0 {
+		return msg.ReplyTo.From, nil
+	}
+	return User{}, errors.New("кого? укажите @user или ответьте на сообщение")
+}
@@ -0,0 +1,122 @@
+package bot
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+)
+
+func TestWarningStore(t *testing.T) {
+	fname := path.Join(t.TempDir(), "warnings.jsonl")
+	store, err := NewWarningStore(fname)
+	require.NoError(t, err)
+
+	ts := time.Date(2024, 5, 4, 20, 0, 0, 0, time.UTC)
+	w1, err := store.Add(Warning{Time: ts, User: User{ID: 1, Username: "user1"}, Reason: "flood"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, w1.ID)
+	w2, err := store.Add(Warning{Time: ts.Add(time.Hour), User: User{ID: 1, Username: "user1"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, w2.ID)
+	_, err = store.Add(Warning{Time: ts.Add(time.Hour), User: User{ID: 2, Username: "user2"}})
+	require.NoError(t, err)
+
+	assert.Len(t, store.Active(1, time.Time{}), 2)
+	assert.Len(t, store.Active(1, ts.Add(time.Minute)), 1, "first warning expired")
+	assert.Len(t, store.Active(3, time.Time{}), 0)
+
+	require.NoError(t, store.Retract(1))
+	assert.Error(t, store.Retract(10))
+	assert.Equal(t, []Warning{w2}, store.Active(1, time.Time{}))
+
+	store, err = NewWarningStore(fname)
+	require.NoError(t, err)
+	assert.Equal(t, []Warning{w2}, store.Active(1, time.Time{}), "retraction persisted")
+	w4, err := store.Add(Warning{Time: ts, User: User{ID: 2}})
+	require.NoError(t, err)
+	assert.Equal(t, 4, w4.ID, "id continues after reload")
+}
+
+func TestWarnings_OnMessage(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	store, err := NewWarningStore(path.Join(t.TempDir(), "warnings.jsonl"))
+	require.NoError(t, err)
+	users, err := NewUserDirectory(path.Join(t.TempDir(), "users.jsonl"))
+	require.NoError(t, err)
+	b := NewWarnings(store, su, users, 30*Day, []WarnStep{{Warnings: 5, Duration: permanentBanDuration}, {Warnings: 3, Duration: Day}})
+	now := time.Date(2024, 5, 4, 20, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	offender := User{ID: 10, Username: "offender"}
+	users.Observe(Message{From: offender})
+	warn := func(text string) Message {
+		msg := Message{ID: 100, Text: text, From: User{ID: 1, Username: "admin"}}
+		msg.ReplyTo.ID = 42
+		msg.ReplyTo.Text = "bad message"
+		msg.ReplyTo.From = offender
+		return msg
+	}
+
+	assert.Equal(t, Response{}, b.OnMessage(Message{Text: "warn! spam", From: User{Username: "user"}}), "not super")
+	assert.Equal(t, Response{Text: "ответьте на сообщение пользователя", Send: true, ReplyTo: 1},
+		b.OnMessage(Message{ID: 1, Text: "warn! spam", From: User{Username: "admin"}}))
+
+	resp := b.OnMessage(warn("warn! flood"))
+	assert.Equal(t, Response{Text: "offender получает предупреждение, причина: flood. Активных предупреждений: 1",
+		Send: true, ReplyTo: 42}, resp)
+
+	now = now.Add(31 * Day) // first warning expired
+	b.OnMessage(warn("warn!"))
+	resp = b.OnMessage(warn("warn!"))
+	assert.Equal(t, Response{Text: "offender получает предупреждение. Активных предупреждений: 2", Send: true, ReplyTo: 42}, resp)
+	resp = b.OnMessage(warn("warn! again"))
+	assert.Equal(t, Response{Text: "offender получает предупреждение, причина: again. Активных предупреждений: 3, молчит 1дн",
+		Send: true, ReplyTo: 42, BanInterval: Day, User: offender, Reason: "warnings: 3"}, resp)
+
+	resp = b.OnMessage(Message{ID: 2, Text: "warnings! @offender", From: User{ID: 2, Username: "user"}})
+	assert.Equal(t, "предупреждения offender:\n1. 04.06.2024, истекает 04.07.2024\n2. 04.06.2024, истекает 04.07.2024\n"+
+		"3. 04.06.2024 again, истекает 04.07.2024", resp.Text)
+	resp = b.OnMessage(Message{ID: 2, Text: "warnings!", From: User{ID: 2, Username: "user"}})
+	assert.Equal(t, Response{Text: "у user нет активных предупреждений", Send: true, ReplyTo: 2}, resp)
+	resp = b.OnMessage(Message{ID: 2, Text: "warnings! @nobody", From: User{ID: 2, Username: "user"}})
+	assert.Equal(t, Response{Text: "не знаю пользователя @nobody", Send: true, ReplyTo: 2}, resp)
+
+	assert.Equal(t, Response{}, b.OnMessage(Message{Text: "unwarn! @offender", From: User{Username: "user"}}), "not super")
+	resp = b.OnMessage(Message{ID: 3, Text: "unwarn! @offender", From: User{ID: 1, Username: "admin"}})
+	assert.Equal(t, Response{Text: "предупреждение для offender от 04.06.2024 отменено, осталось активных: 2",
+		Send: true, ReplyTo: 3}, resp)
+
+	b.OnMessage(warn("warn!"))
+	resp = b.OnMessage(warn("warn!"))
+	assert.Equal(t, Day, resp.BanInterval, "4th warning mutes again")
+	assert.Equal(t, "offender получает предупреждение. Активных предупреждений: 4, молчит 1дн", resp.Text)
+	resp = b.OnMessage(warn("warn!"))
+	assert.Equal(t, permanentBanDuration, resp.BanInterval, "5th warning bans")
+	assert.Equal(t, "offender получает предупреждение. Активных предупреждений: 5, бан навсегда", resp.Text)
+	resp = b.OnMessage(warn("warn!"))
+	assert.Equal(t, permanentBanDuration, resp.BanInterval, "6th warning after unban bans again")
+
+	msg := warn("warn!")
+	msg.ReplyTo.From = User{ID: 1, Username: "admin"}
+	assert.Equal(t, Response{}, b.OnMessage(msg), "super can't be warned")
+}
+
+func TestParseWarnSteps(t *testing.T) {
+	steps, err := ParseWarnSteps([]string{"3:24h", "5:0"})
+	require.NoError(t, err)
+	assert.Equal(t, []WarnStep{{Warnings: 3, Duration: Day}, {Warnings: 5, Duration: permanentBanDuration}}, steps)
+
+	steps, err = ParseWarnSteps(nil)
+	require.NoError(t, err)
+	assert.Empty(t, steps)
+
+	for _, spec := range []string{"3", "x:1h", "0:1h", "3:1x", "3:-1h"} {
+		_, err = ParseWarnSteps([]string{spec})
+		assert.Error(t, err, spec)
+	}
+}
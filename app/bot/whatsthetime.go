@@ -64,6 +64,11 @@ func (w *WhatsTheTime) OnMessage(msg Message) (response Response) {
 	}
 }
 
+// HostsTime returns local time of the hosts, a line per host
+func (w *WhatsTheTime) HostsTime(now time.Time) string {
+	return buildResponseText(now, w.hosts)
+}
+
 func buildResponseText(now time.Time, hosts []Host) string {
 	responseString := ""
 	for _, host := range hosts {
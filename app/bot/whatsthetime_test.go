@@ -51,3 +51,10 @@ func TestWhatsTheTime_Help(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "время!, time!, который час? _– подcкажет время у ведущих_\n", b.Help())
 }
+
+func TestWhatsTheTime_HostsTime(t *testing.T) {
+	b, err := NewWhatsTheTime("./../../data")
+	require.NoError(t, err)
+	res := b.HostsTime(time.Date(1970, 1, 1, 20, 20, 0, 0, time.UTC))
+	assert.Contains(t, res, "У Umputun сейчас 14:20\n")
+}
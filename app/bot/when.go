@@ -38,8 +38,16 @@ func (w *When) ReactOn() []string {
 	return []string{"когда?", "when?"}
 }
 
+// avgShowDuration is a typical length of the show
+const avgShowDuration = 2 * time.Hour
+
+// Schedule returns start of the previous and the next shows, live is true if the previous one is likely still on air
+func (w *When) Schedule(now time.Time) (prev, next time.Time, live bool) {
+	prev, next = closestPrevNextShows(now.UTC())
+	return prev, next, now.Sub(prev) < avgShowDuration
+}
+
 func when(now time.Time) string {
-	const avgDuration = 2 * time.Hour
 	const whenPrefix = "[каждую субботу, 20:00 UTC](https://radio-t.com/online/)"
 
 	now = now.UTC()
@@ -48,7 +56,7 @@ func when(now time.Time) string {
 	diffToNext := nextStream.Sub(now)
 
 	var whenCountdown string
-	if diffToPrev < avgDuration {
+	if diffToPrev < avgShowDuration {
 		whenCountdown = fmt.Sprintf(
 			"\nНачался %s назад. \nСкорее всего еще идет. \nСледующий через %s",
 			HumanizeDuration(diffToPrev),
@@ -96,3 +96,16 @@ func TestWhenBot_closestPrevNextStreams(t *testing.T) {
 		})
 	}
 }
+
+func TestWhenBot_Schedule(t *testing.T) {
+	t.Parallel()
+
+	b := NewWhen()
+	prev, next, live := b.Schedule(time.Date(2022, 1, 1, 21, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2022, 1, 1, 20, 0, 0, 0, time.UTC), prev)
+	assert.Equal(t, time.Date(2022, 1, 8, 20, 0, 0, 0, time.UTC), next)
+	assert.True(t, live)
+
+	_, _, live = b.Schedule(time.Date(2022, 1, 1, 22, 1, 0, 0, time.UTC))
+	assert.False(t, live)
+}
@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"strings"
 	"time"
 )
 
 // WTF bot bans user for random interval
 type WTF struct {
 	superUser   SuperUser
+	ledger      *WTFLedger     // optional, keeps all outcomes for stats
+	users       *UserDirectory // optional, resolves usernames for stats
 	minDuration time.Duration
 	maxDuration time.Duration
 	rand        func(n int64) int64 // tests may change it
@@ -17,14 +20,18 @@ type WTF struct {
 	tooSoon     time.Duration // tests may change it
 }
 
-// NewWTF makes a random ban bot
-func NewWTF(minDuration, maxDuration time.Duration, superUser SuperUser) *WTF {
-	log.Printf("[INFO] WTF bot with %v-%v interval", minDuration, maxDuration)
-	return &WTF{minDuration: minDuration, maxDuration: maxDuration, rand: rand.Int63n, superUser: superUser, tooSoon: time.Minute}
+// NewWTF makes a random ban bot, ledger and users are optional
+func NewWTF(minDuration, maxDuration time.Duration, superUser SuperUser, ledger *WTFLedger, users *UserDirectory) *WTF {
+	log.Printf("[INFO] WTF bot with %v-%v interval, ledger: %v", minDuration, maxDuration, ledger != nil)
+	return &WTF{minDuration: minDuration, maxDuration: maxDuration, rand: rand.Int63n, superUser: superUser,
+		ledger: ledger, users: users, tooSoon: time.Minute}
 }
 
 // OnMessage sets duration of ban randomly
 func (w *WTF) OnMessage(msg Message) (response Response) {
+	if resp, ok := w.onStats(msg); ok {
+		return resp
+	}
 
 	wtfContains := WTFSteroidChecker{
 		Message: msg.Text}
@@ -36,10 +43,12 @@ func (w *WTF) OnMessage(msg Message) (response Response) {
 	wtfUser := msg.From
 	var wtfChannelID int64
 	var wtfChannelUsername string
+	var replyBan bool
 	if w.superUser.IsSuper(msg.From.Username) {
 		if msg.ReplyTo.From.ID == 0 { // not reply, ignore for supers
 			return Response{}
 		}
+		replyBan = true
 		wtfRequested := fmt.Sprintf("[INFO] wtf requested by %q for %q, id:%d", msg.From.Username, msg.ReplyTo.From.Username, msg.ReplyTo.From.ID)
 		if msg.ReplyTo.SenderChat.ID != 0 {
 			wtfChannelID = msg.ReplyTo.SenderChat.ID
@@ -69,7 +78,10 @@ func (w *WTF) OnMessage(msg Message) (response Response) {
 		mention = "@" + wtfChannelUsername
 	}
 
-	banDuration := w.minDuration + time.Second*time.Duration(w.rand(int64(w.maxDuration.Seconds()-w.minDuration.Seconds())))
+	banDuration := w.minDuration
+	if w.maxDuration > w.minDuration {
+		banDuration += time.Second * time.Duration(w.rand(int64(w.maxDuration.Seconds()-w.minDuration.Seconds())))
+	}
 	if time.Since(w.lastWtf) < w.tooSoon { // if last wtf was less than 1 minute ago, add more time to ban duration
 		increase := time.Hour * 5 * time.Duration(w.tooSoon.Seconds()-time.Since(w.lastWtf).Seconds())
 		log.Printf("[INFO] wtf from %v in %v is too soon, adding %v to ban duration", mention, time.Since(w.lastWtf), increase)
@@ -83,26 +95,118 @@ func (w *WTF) OnMessage(msg Message) (response Response) {
 	}
 	w.lastWtf = time.Now()
 
+	if w.ledger != nil {
+		rec := WTFRecord{Time: w.lastWtf, Trigger: msg.From, Banned: wtfUser, ChannelID: wtfChannelID,
+			ChannelName: wtfChannelUsername, Duration: banDuration, Reply: replyBan}
+		if wtfChannelID != 0 {
+			rec.Duration = 0 // telegram bans channels forever, until unbanned
+		}
+		if err := w.ledger.Add(rec); err != nil {
+			log.Printf("[WARN] can't save wtf record %+v, %v", rec, err)
+		}
+	}
+
 	durationString := HumanizeDuration(banDuration)
 	if wtfChannelID != 0 {
 		durationString = "навсегда"
 	}
 
+	reason := "wtf"
+	if replyBan {
+		reason = "wtf by superuser"
+	}
 	return Response{
 		Text:        fmt.Sprintf("%s получает бан на %v", EscapeMarkDownV1Text(mention), durationString),
 		Send:        true,
 		BanInterval: banDuration,
 		User:        wtfUser,
 		ChannelID:   wtfChannelID,
+		Reason:      reason,
+	}
+}
+
+// onStats responds to wtfstats! and wtftop! commands, ok is false for other messages
+func (w *WTF) onStats(msg Message) (resp Response, ok bool) {
+	fields := strings.Fields(strings.ToLower(msg.Text))
+	if w.ledger == nil || len(fields) == 0 {
+		return Response{}, false
+	}
+
+	switch fields[0] {
+	case "wtfstats!":
+		user := msg.From
+		if len(fields) > 1 {
+			user = User{Username: strings.TrimPrefix(strings.Fields(msg.Text)[1], "@")}
+			if ku, found := w.lookup(user.Username); found {
+				user = ku.User // match by id, including records made under previous username
+			}
+		}
+		return Response{Text: w.statsText(user), Send: true, ReplyTo: msg.ID}, true
+	case "wtftop!":
+		return Response{Text: w.topText(time.Now()), Send: true}, true
+	}
+	return Response{}, false
+}
+
+func (w *WTF) lookup(name string) (KnownUser, bool) {
+	if w.users == nil {
+		return KnownUser{}, false
+	}
+	return w.users.Lookup(name)
+}
+
+func (w *WTF) statsText(user User) string {
+	mention := EscapeMarkDownV1Text(DisplayName(Message{From: user}))
+
+	st := w.ledger.Stats(user)
+	if st.Triggered == 0 && st.Banned == 0 {
+		return fmt.Sprintf("%s еще не играл в wtf", mention)
+	}
+	res := fmt.Sprintf("%s: wtf запрошен %d раз, получено банов %d", mention, st.Triggered, st.Banned)
+	if st.Banned > 0 {
+		res += fmt.Sprintf(" на %s, самый большой %s, последний %s", HumanizeDuration(st.Total),
+			HumanizeDuration(st.Biggest), st.Last.Format("02.01.2006"))
 	}
+	return res
+}
+
+func (w *WTF) topText(now time.Time) string {
+	const topSize = 5
+	lines := []string{"*самые большие баны:*"}
+	for i, r := range w.ledger.Biggest(topSize) {
+		lines = append(lines, fmt.Sprintf("%d. %s – %s, %s", i+1, EscapeMarkDownV1Text(r.Mention()),
+			HumanizeDuration(r.Duration), r.Time.Format("02.01.2006")))
+	}
+	if len(lines) == 1 {
+		return "в wtf еще никто не играл"
+	}
+
+	leaders := w.ledger.Leaders(now.Add(-7*Day), topSize)
+	if len(leaders) == 0 {
+		return strings.Join(lines, "\n")
+	}
+	lines = append(lines, "", "*лидеры недели:*")
+	for i, l := range leaders {
+		rec := WTFRecord{Banned: l.User}
+		lines = append(lines, fmt.Sprintf("%d. %s – банов %d на %s", i+1, EscapeMarkDownV1Text(rec.Mention()),
+			l.Bans, HumanizeDuration(l.Total)))
+	}
+	return strings.Join(lines, "\n")
 }
 
 // ReactOn keys
 func (w *WTF) ReactOn() []string {
-	return []string{"wtf!", "wtf?"}
+	if w.ledger == nil {
+		return []string{"wtf!", "wtf?"}
+	}
+	return []string{"wtf!", "wtf?", "wtfstats!", "wtftop!"}
 }
 
 // Help returns help message
 func (w *WTF) Help() string {
-	return GenHelpMsg(w.ReactOn(), "если не повезет, блокирует пользователя на какое-то время")
+	res := GenHelpMsg([]string{"wtf!", "wtf?"}, "если не повезет, блокирует пользователя на какое-то время")
+	if w.ledger != nil {
+		res += GenHelpMsg([]string{"wtfstats!", "wtftop!"}, "статистика wtf банов, wtfstats! @user для другого пользователя")
+	}
+	return res
 }
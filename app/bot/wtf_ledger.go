@@ -0,0 +1,165 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// WTFRecord is a single outcome of WTF game
+type WTFRecord struct {
+	Time        time.Time     `json:"time"`
+	Trigger     User          `json:"trigger"`                // user sent wtf
+	Banned      User          `json:"banned"`                 // user got the ban, same as Trigger unless reply-ban
+	ChannelID   int64         `json:"channel_id,omitempty"`   // banned channel, if any
+	ChannelName string        `json:"channel_name,omitempty"` // banned channel username
+	Duration    time.Duration `json:"duration"`               // 0 for channels, banned forever
+	Reply       bool          `json:"reply,omitempty"`        // reply-ban by superuser
+}
+
+// Mention returns name of banned user or channel
+func (r WTFRecord) Mention() string {
+	if r.ChannelID != 0 {
+		return "@" + r.ChannelName
+	}
+	return DisplayName(Message{From: r.Banned})
+}
+
+// WTFStats is a summary of WTF records for a single user
+type WTFStats struct {
+	Triggered int           // number of wtf sent
+	Banned    int           // number of bans received
+	Total     time.Duration // total ban time received
+	Biggest   time.Duration // biggest ban received
+	Last      time.Time     // last ban received
+}
+
+// WTFLeader is a user with total ban time for a period
+type WTFLeader struct {
+	User  User
+	Bans  int
+	Total time.Duration
+}
+
+// WTFLedger keeps all WTF outcomes in memory and persists them to jsonl file
+type WTFLedger struct {
+	file    *storage.JSONL[WTFRecord]
+	lock    sync.RWMutex
+	records []WTFRecord
+}
+
+// NewWTFLedger loads WTF records from the file
+func NewWTFLedger(path string) (*WTFLedger, error) {
+	file, err := storage.NewJSONL[WTFRecord](path)
+	if err != nil {
+		return nil, err
+	}
+	records, err := file.Load()
+	if err != nil {
+		return nil, fmt.Errorf("can't load wtf ledger: %w", err)
+	}
+	log.Printf("[INFO] loaded %d wtf records from %s", len(records), path)
+	return &WTFLedger{file: file, records: records}, nil
+}
+
+// Add saves a record
+func (l *WTFLedger) Add(rec WTFRecord) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if err := l.file.Append(rec); err != nil {
+		return fmt.Errorf("can't save wtf record: %w", err)
+	}
+	l.records = append(l.records, rec)
+	return nil
+}
+
+// Records returns records made in [from, to) interval, zero time means no limit
+func (l *WTFLedger) Records(from, to time.Time) []WTFRecord {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	res := []WTFRecord{}
+	for _, r := range l.records {
+		if (!from.IsZero() && r.Time.Before(from)) || (!to.IsZero() && !r.Time.Before(to)) {
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// Stats returns summary for the user matched by id or, if id is 0, by username
+func (l *WTFLedger) Stats(user User) WTFStats {
+	match := func(u User) bool {
+		if user.ID != 0 {
+			return u.ID == user.ID
+		}
+		return user.Username != "" && strings.EqualFold(u.Username, user.Username)
+	}
+
+	res := WTFStats{}
+	for _, r := range l.Records(time.Time{}, time.Time{}) {
+		if match(r.Trigger) {
+			res.Triggered++
+		}
+		if r.ChannelID != 0 || !match(r.Banned) {
+			continue
+		}
+		res.Banned++
+		res.Total += r.Duration
+		if r.Duration > res.Biggest {
+			res.Biggest = r.Duration
+		}
+		if r.Time.After(res.Last) {
+			res.Last = r.Time
+		}
+	}
+	return res
+}
+
+// Biggest returns up to n biggest bans of users, channels are banned forever and not counted
+func (l *WTFLedger) Biggest(n int) []WTFRecord {
+	res := []WTFRecord{}
+	for _, r := range l.Records(time.Time{}, time.Time{}) {
+		if r.ChannelID == 0 {
+			res = append(res, r)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Duration > res[j].Duration })
+	if len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+// Leaders returns up to n users with the biggest total ban time since given time
+func (l *WTFLedger) Leaders(since time.Time, n int) []WTFLeader {
+	byUser := map[string]*WTFLeader{}
+	keys := []string{}
+	for _, r := range l.Records(since, time.Time{}) {
+		if r.ChannelID != 0 {
+			continue
+		}
+		key := fmt.Sprintf("%d:%s", r.Banned.ID, r.Banned.Username)
+		if _, ok := byUser[key]; !ok {
+			byUser[key] = &WTFLeader{User: r.Banned}
+			keys = append(keys, key)
+		}
+		byUser[key].Bans++
+		byUser[key].Total += r.Duration
+	}
+
+	res := make([]WTFLeader, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, *byUser[k])
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Total > res[j].Total })
+	if len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
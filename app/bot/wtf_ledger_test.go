@@ -0,0 +1,122 @@
+package bot
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+)
+
+func TestWTFLedger(t *testing.T) {
+	fname := path.Join(t.TempDir(), "wtf.jsonl")
+	ledger, err := NewWTFLedger(fname)
+	require.NoError(t, err)
+
+	now := time.Now()
+	user1, user2 := User{ID: 1, Username: "user1"}, User{ID: 2, Username: "user2"}
+	require.NoError(t, ledger.Add(WTFRecord{Time: now.Add(-30 * Day), Trigger: user1, Banned: user1, Duration: 666 * time.Hour}))
+	require.NoError(t, ledger.Add(WTFRecord{Time: now.Add(-time.Hour), Trigger: user1, Banned: user1, Duration: time.Hour}))
+	require.NoError(t, ledger.Add(WTFRecord{Time: now.Add(-time.Minute), Trigger: User{Username: "admin"}, Banned: user2,
+		Duration: 2 * time.Hour, Reply: true}))
+	require.NoError(t, ledger.Add(WTFRecord{Time: now, Trigger: user2, Banned: user2, ChannelID: 123, ChannelName: "chan",
+		Duration: time.Minute}))
+
+	ledger, err = NewWTFLedger(fname)
+	require.NoError(t, err)
+	assert.Len(t, ledger.Records(time.Time{}, time.Time{}), 4, "reloaded")
+	assert.Len(t, ledger.Records(now.Add(-2*time.Hour), now), 2)
+
+	st := ledger.Stats(User{ID: 1})
+	assert.Equal(t, WTFStats{Triggered: 2, Banned: 2, Total: 667 * time.Hour, Biggest: 666 * time.Hour,
+		Last: ledger.Records(time.Time{}, time.Time{})[1].Time}, st)
+	st = ledger.Stats(User{Username: "USER2"})
+	assert.Equal(t, 1, st.Triggered)
+	assert.Equal(t, 1, st.Banned, "channel ban not counted")
+
+	biggest := ledger.Biggest(2)
+	require.Len(t, biggest, 2)
+	assert.Equal(t, 666*time.Hour, biggest[0].Duration)
+	assert.Equal(t, "user2", biggest[1].Mention())
+
+	leaders := ledger.Leaders(now.Add(-7*Day), 5)
+	assert.Equal(t, []WTFLeader{{User: user2, Bans: 1, Total: 2 * time.Hour}, {User: user1, Bans: 1, Total: time.Hour}}, leaders)
+}
+
+func TestWTF_Stats(t *testing.T) {
+	su := &mocks.SuperUser{IsSuperFunc: func(userName string) bool { return userName == "admin" }}
+	ledger, err := NewWTFLedger(path.Join(t.TempDir(), "wtf.jsonl"))
+	require.NoError(t, err)
+	b := NewWTF(time.Hour, 2*time.Hour, su, ledger, nil)
+	b.rand = func(n int64) int64 { return 0 }
+	b.tooSoon = 0
+
+	resp := b.OnMessage(Message{ID: 1, Text: "wtfstats!", From: User{ID: 1, Username: "user_1"}})
+	assert.Equal(t, Response{Text: "user\\_1 еще не играл в wtf", Send: true, ReplyTo: 1}, resp)
+	resp = b.OnMessage(Message{Text: "wtftop!"})
+	assert.Equal(t, Response{Text: "в wtf еще никто не играл", Send: true}, resp)
+
+	resp = b.OnMessage(Message{Text: "wtf!", From: User{ID: 1, Username: "user_1"}})
+	require.True(t, resp.Send)
+	msg := Message{Text: "wtf!", From: User{ID: 2, Username: "admin"}}
+	msg.ReplyTo.From = User{ID: 3, Username: "user3"}
+	resp = b.OnMessage(msg)
+	require.True(t, resp.Send)
+
+	recs := ledger.Records(time.Time{}, time.Time{})
+	require.Len(t, recs, 2)
+	assert.Equal(t, User{ID: 1, Username: "user_1"}, recs[0].Banned)
+	assert.False(t, recs[0].Reply)
+	assert.Equal(t, User{ID: 3, Username: "user3"}, recs[1].Banned)
+	assert.Equal(t, "admin", recs[1].Trigger.Username)
+	assert.True(t, recs[1].Reply)
+
+	resp = b.OnMessage(Message{ID: 2, Text: "wtfstats!", From: User{ID: 1, Username: "user_1"}})
+	assert.Contains(t, resp.Text, "user\\_1: wtf запрошен 1 раз, получено банов 1 на 1ч, самый большой 1ч, последний ")
+	resp = b.OnMessage(Message{ID: 3, Text: "wtfstats! @User3", From: User{ID: 1, Username: "user_1"}})
+	assert.Contains(t, resp.Text, "User3: wtf запрошен 0 раз, получено банов 1")
+
+	resp = b.OnMessage(Message{Text: "WTFtop!"})
+	assert.Equal(t, "*самые большие баны:*\n"+
+		"1. user\\_1 – 1ч, "+time.Now().Format("02.01.2006")+"\n"+
+		"2. user3 – 1ч, "+time.Now().Format("02.01.2006")+"\n\n"+
+		"*лидеры недели:*\n"+
+		"1. user\\_1 – банов 1 на 1ч\n"+
+		"2. user3 – банов 1 на 1ч", resp.Text)
+
+	msg = Message{Text: "wtf!", From: User{ID: 2, Username: "admin"}}
+	msg.ReplyTo.From = User{Username: "ChannelBot", ID: 136817688}
+	msg.ReplyTo.SenderChat = SenderChat{ID: 123, UserName: "channel"}
+	resp = b.OnMessage(msg)
+	require.True(t, resp.Send)
+	recs = ledger.Records(time.Time{}, time.Time{})
+	require.Len(t, recs, 3)
+	assert.Equal(t, time.Duration(0), recs[2].Duration, "channels banned forever")
+	assert.Len(t, ledger.Biggest(5), 2, "channel bans not in the biggest")
+
+	assert.Equal(t, []string{"wtf!", "wtf?", "wtfstats!", "wtftop!"}, b.ReactOn())
+	assert.Contains(t, b.Help(), "wtfstats!, wtftop!")
+}
+
+func TestWTF_StatsWithUsers(t *testing.T) {
+	tmp := t.TempDir()
+	ledger, err := NewWTFLedger(path.Join(tmp, "wtf.jsonl"))
+	require.NoError(t, err)
+	users, err := NewUserDirectory(path.Join(tmp, "users.jsonl"))
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, ledger.Add(WTFRecord{Time: now.Add(-time.Hour), Trigger: User{ID: 1, Username: "old_name"},
+		Banned: User{ID: 1, Username: "old_name"}, Duration: time.Hour}))
+	users.Observe(Message{From: User{ID: 1, Username: "old_name"}, Sent: now.Add(-time.Hour)})
+	users.Observe(Message{From: User{ID: 1, Username: "new_name"}, Sent: now})
+
+	b := NewWTF(time.Hour, 2*time.Hour, nil, ledger, users)
+	resp := b.OnMessage(Message{Text: "wtfstats! @new_name"})
+	assert.Contains(t, resp.Text, "new\\_name: wtf запрошен 1 раз, получено банов 1 на 1ч")
+	resp = b.OnMessage(Message{Text: "wtfstats! @OLD_NAME"})
+	assert.Contains(t, resp.Text, "new\\_name: wtf запрошен 1 раз")
+}
@@ -19,7 +19,7 @@ func TestWTF_OnMessage(t *testing.T) {
 	}}
 	min := time.Hour * 24
 	max := 7 * time.Hour * 24
-	b := NewWTF(min, max, su)
+	b := NewWTF(min, max, su, nil, nil)
 	b.rand = func(n int64) int64 { return 10 }
 
 	t.Run("not a wtf message", func(t *testing.T) {
@@ -110,6 +110,18 @@ func TestWTF_OnMessage(t *testing.T) {
 	assert.Equal(t, 19, len(su.IsSuperCalls()))
 }
 
+func TestWTF_OnMessageFixedDuration(t *testing.T) {
+	b := NewWTF(time.Hour, time.Hour, &mocks.SuperUser{IsSuperFunc: func(string) bool { return false }}, nil, nil)
+	b.tooSoon = 0
+	b.rand = func(n int64) int64 {
+		require.Equal(t, int64(10), n, "no random part, only magic durations")
+		return 0
+	}
+	resp := b.OnMessage(Message{Text: "WTF!", From: User{Username: "user", ID: 1}})
+	assert.Equal(t, "@user получает бан на 1ч", resp.Text)
+	assert.Equal(t, time.Hour, resp.BanInterval)
+}
+
 func TestWTF_Help(t *testing.T) {
 	require.Equal(t, "wtf!, wtf? _– если не повезет, блокирует пользователя на какое-то время_\n", (&WTF{}).Help())
 }
@@ -32,7 +32,12 @@ type TelegramListener struct {
 	BotsActivityTerm       Terminator // bot-only activity for given user
 	OverallBotActivityTerm Terminator // bot-only activity for all users
 	SuperUsers             SuperUser
+	Users                  *bot.UserDirectory // optional, collects usernames and ids of all chat members seen
+	ModLog                 *bot.ModLog        // optional, journal of all bans, deletes and pins
+	LiftInterval           time.Duration      // how often expired restrictions from ModLog lifted, default 1m
+	Blocklist              *bot.Blocklist     // optional, known spammers, fed by permanent bans of users
 	chatID                 int64
+	liftFails              map[liftKey]int // failed lifts of expired restrictions, used by lift loop only
 
 	msgs struct {
 		once sync.Once
@@ -65,8 +70,17 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 		if l.IdleDuration == 0 {
 			l.IdleDuration = 30 * time.Second
 		}
+		if l.LiftInterval == 0 {
+			l.LiftInterval = time.Minute
+		}
 	})
 
+	if l.ModLog != nil {
+		liftCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go l.liftLoop(liftCtx)
+	}
+
 	u := tbapi.NewUpdate(0)
 	u.Timeout = 60
 
@@ -110,6 +124,9 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 			msg := l.transform(update.Message)
 			if fromChat == l.chatID {
 				l.MsgLogger.Save(msg) // save an incoming update to report
+				if l.Users != nil {
+					l.Users.Observe(*msg)
+				}
 			}
 
 			log.Printf("[DEBUG] incoming msg: %+v", msg)
@@ -121,20 +138,27 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 				log.Printf("[INFO] detected channel/group message, initiating ban: %d %s",
 					msg.SenderChat.ID, msg.SenderChat.UserName)
 				permBanDuration := time.Hour * 24 * 400
-				if err := l.banUserOrChannel(permBanDuration, fromChat, 0, msg.SenderChat.ID); err != nil {
+				entry := bot.ModEntry{Action: bot.ModBan, Source: "channel_ban", Actor: msg.From, ChannelID: msg.SenderChat.ID,
+					ChannelName: msg.SenderChat.UserName, Reason: "message from channel", MessageID: msg.ID, Message: msg.Text}
+				err := l.banUserOrChannel(permBanDuration, fromChat, 0, msg.SenderChat.ID)
+				if err != nil {
 					log.Printf("[ERROR] can't ban channel/group: %v", err)
 				}
-				_, err := l.TbAPI.Request(tbapi.DeleteMessageConfig{ChatID: l.chatID, MessageID: update.Message.MessageID})
+				l.journal(entry, err)
+
+				_, err = l.TbAPI.Request(tbapi.DeleteMessageConfig{ChatID: l.chatID, MessageID: update.Message.MessageID})
 				if err != nil {
 					log.Printf("[WARN] failed to delete message %d, %v", update.Message.MessageID, err)
 				}
+				entry.Action, entry.ChannelID, entry.ChannelName = bot.ModDelete, 0, ""
+				l.journal(entry, err)
 				continue
 			}
 
 			// check for all-activity ban
 			if b := l.AllActivityTerm.check(msg.From, msg.SenderChat, msg.Sent, fromChat); b.active {
 				if b.new && !l.SuperUsers.IsSuper(update.Message.From.UserName) && fromChat == l.chatID {
-					if err := l.applyBan(*msg, l.AllActivityTerm.BanDuration, fromChat, update.Message.From.ID); err != nil {
+					if err := l.applyBan(*msg, l.AllActivityTerm.BanDuration, fromChat, update.Message.From.ID, "all_activity"); err != nil {
 						log.Printf("[ERROR] can't ban for all activity, %v", err)
 					}
 				}
@@ -148,9 +172,13 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 				continue
 			}
 
-			if err := l.sendBotResponse(resp, fromChat); err != nil {
+			noticeID, err := l.sendBotResponse(resp, fromChat)
+			if err != nil {
 				log.Printf("[WARN] failed to respond on update, %v", err)
 			}
+			if sl, ok := l.Bots.(bot.SentListener); ok && noticeID != 0 {
+				sl.OnSent(*msg, noticeID)
+			}
 
 			isBanInvoked := resp.Send && resp.BanInterval > 0 &&
 				(!l.SuperUsers.IsSuper(resp.User.Username) || resp.ChannelID != 0) && // should not ban superusers, but ban channels
@@ -166,11 +194,21 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 					banSuccessMessage = fmt.Sprintf("[INFO] %v channel banned by bot forever", banUserStr)
 				}
 
-				if err := l.banUserOrChannel(resp.BanInterval, fromChat, resp.User.ID, resp.ChannelID); err != nil {
+				err := l.banUserOrChannel(resp.BanInterval, fromChat, resp.User.ID, resp.ChannelID)
+				if err != nil {
 					log.Printf("[ERROR] can't ban %s on bot response, %v", banUserStr, err)
 				} else {
 					log.Print(banSuccessMessage)
 				}
+				entry := bot.ModEntry{Action: bot.ModRestrict, Source: resp.Source, Actor: msg.From, Target: resp.User,
+					Reason: resp.Reason, Details: resp.Details, Duration: journalDuration(resp.BanInterval), MessageID: msg.ID,
+					Message: msg.Text, NoticeID: noticeID}
+				if resp.ChannelID != 0 { // telegram bans channels forever, until unbanned
+					entry.Action, entry.Target, entry.Duration = bot.ModBan, bot.User{}, 0
+					entry.ChannelID, entry.ChannelName = resp.ChannelID, getBanChannel(resp, update).UserName
+				}
+				l.journal(entry, err)
+				l.block(entry, err)
 			}
 
 			// delete message if requested by bot
@@ -179,16 +217,22 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 				if err != nil {
 					log.Printf("[WARN] failed to delete message %d, %v", resp.ReplyTo, err)
 				}
+				entry := bot.ModEntry{Action: bot.ModDelete, Source: resp.Source, Actor: msg.From, Reason: resp.Reason,
+					Details: resp.Details, MessageID: resp.ReplyTo}
+				if resp.ReplyTo == msg.ID {
+					entry.Target, entry.Message = msg.From, msg.Text
+				}
+				l.journal(entry, err)
 			}
 
 		case resp := <-l.msgs.ch: // publish messages from outside clients
-			if err := l.sendBotResponse(resp, l.chatID); err != nil {
+			if _, err := l.sendBotResponse(resp, l.chatID); err != nil {
 				log.Printf("[WARN] failed to respond on rtjc event, %v", err)
 			}
 
 		case <-time.After(l.IdleDuration): // hit bots on idle timeout
 			resp := l.Bots.OnMessage(bot.Message{Text: "idle"})
-			if err := l.sendBotResponse(resp, l.chatID); err != nil {
+			if _, err := l.sendBotResponse(resp, l.chatID); err != nil {
 				log.Printf("[WARN] failed to respond on idle, %v", err)
 			}
 		}
@@ -199,6 +243,11 @@ func getBanUsername(resp bot.Response, update tbapi.Update) string {
 	if resp.ChannelID == 0 {
 		return fmt.Sprintf("%v", resp.User)
 	}
+	return fmt.Sprintf("%v", getBanChannel(resp, update))
+}
+
+// getBanChannel returns channel requested to ban by bot, with username if known
+func getBanChannel(resp bot.Response, update tbapi.Update) bot.SenderChat {
 	botChat := bot.SenderChat{
 		ID: resp.ChannelID,
 	}
@@ -206,10 +255,10 @@ func getBanUsername(resp bot.Response, update tbapi.Update) string {
 		botChat.UserName = update.Message.SenderChat.UserName
 	}
 	// if not set, that means the ban comes from superuser and username should be taken from ReplyToMessage
-	if botChat.UserName == "" && update.Message.ReplyToMessage.SenderChat != nil {
+	if botChat.UserName == "" && update.Message.ReplyToMessage != nil && update.Message.ReplyToMessage.SenderChat != nil {
 		botChat.UserName = update.Message.ReplyToMessage.SenderChat.UserName
 	}
-	return fmt.Sprintf("%v", botChat)
+	return botChat
 }
 
 func (l *TelegramListener) botActivityBan(resp bot.Response, msg bot.Message, fromChat, fromID int64) bool {
@@ -224,7 +273,7 @@ func (l *TelegramListener) botActivityBan(resp bot.Response, msg bot.Message, fr
 	// check for bot-activity ban for given users
 	if b := l.BotsActivityTerm.check(msg.From, msg.SenderChat, msg.Sent, fromChat); b.active {
 		if b.new {
-			if err := l.applyBan(msg, l.BotsActivityTerm.BanDuration, fromChat, fromID); err != nil {
+			if err := l.applyBan(msg, l.BotsActivityTerm.BanDuration, fromChat, fromID, "bot_activity"); err != nil {
 				log.Printf("[ERROR] can't ban on bot activity for given user, %v", err)
 			}
 		}
@@ -234,7 +283,7 @@ func (l *TelegramListener) botActivityBan(resp bot.Response, msg bot.Message, fr
 	// check for bot-activity ban for all users
 	if b := l.OverallBotActivityTerm.check(bot.User{}, bot.SenderChat{}, msg.Sent, fromChat); b.active {
 		if b.new {
-			if err := l.applyBan(msg, l.BotsActivityTerm.BanDuration, fromChat, fromID); err != nil {
+			if err := l.applyBan(msg, l.BotsActivityTerm.BanDuration, fromChat, fromID, "overall_bot_activity"); err != nil {
 				log.Printf("[ERROR] can't ban on bot activity for all users, %v", err)
 			}
 		}
@@ -244,10 +293,64 @@ func (l *TelegramListener) botActivityBan(resp bot.Response, msg bot.Message, fr
 	return false
 }
 
-// sendBotResponse sends bot's answer to tg channel and saves it to log
-func (l *TelegramListener) sendBotResponse(resp bot.Response, chatID int64) error {
+// maxLiftAttempts limits attempts to lift an expired restriction, telegram lifts it by itself anyway
+const maxLiftAttempts = 5
+
+// liftKey identifies restriction in the journal
+type liftKey struct {
+	userID, channelID, time int64
+}
+
+// liftLoop lifts expired restrictions every LiftInterval, apart from messages processing, until ctx is done
+func (l *TelegramListener) liftLoop(ctx context.Context) {
+	ticker := time.NewTicker(l.LiftInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.liftExpired(now)
+		}
+	}
+}
+
+// liftExpired lifts temporary restrictions from the journal expired during the last day and journals them as unbans.
+// Telegram lifts them by itself, this keeps the journal in sync and retries if telegram missed it.
+// Failed lifts are not journaled, they are retried on the next calls up to maxLiftAttempts times.
+func (l *TelegramListener) liftExpired(now time.Time) {
+	fails := make(map[liftKey]int) // only expired restrictions kept, older ones dropped
+	for _, e := range l.ModLog.Expired(now.Add(-24*time.Hour), now) {
+		key := liftKey{userID: e.Target.ID, channelID: e.ChannelID, time: e.Time.UnixNano()}
+		if l.liftFails[key] >= maxLiftAttempts {
+			fails[key] = l.liftFails[key]
+			continue
+		}
+		resp, err := l.TbAPI.Request(bot.LiftRequest(e, l.chatID))
+		if err == nil && !resp.Ok {
+			err = fmt.Errorf("response is not Ok: %s", resp.Description)
+		}
+		if err != nil {
+			fails[key] = l.liftFails[key] + 1
+			if fails[key] < maxLiftAttempts {
+				log.Printf("[WARN] can't lift expired %s for %s, will retry, %v", e.Action, e.TargetName(), err)
+				continue
+			}
+			log.Printf("[WARN] can't lift expired %s for %s, giving up after %d attempts, %v",
+				e.Action, e.TargetName(), fails[key], err)
+			continue
+		}
+		log.Printf("[INFO] expired %s lifted for %s", e.Action, e.TargetName())
+		l.journal(bot.ModEntry{Action: bot.ModUnban, Source: "expired", Target: e.Target, ChannelID: e.ChannelID,
+			ChannelName: e.ChannelName, Reason: fmt.Sprintf("%s by %s expired", e.Action, e.Source)}, nil)
+	}
+	l.liftFails = fails
+}
+
+// sendBotResponse sends bot's answer to tg channel and saves it to log, returns id of the sent message
+func (l *TelegramListener) sendBotResponse(resp bot.Response, chatID int64) (int, error) {
 	if !resp.Send {
-		return nil
+		return 0, nil
 	}
 
 	log.Printf("[DEBUG] bot response - %+v, pin: %t, reply-to:%d, parse-mode:%s", resp.Text, resp.Pin, resp.ReplyTo, resp.ParseMode)
@@ -267,7 +370,7 @@ func (l *TelegramListener) sendBotResponse(resp bot.Response, chatID int64) erro
 			res, err = l.TbAPI.Send(tbMsg)
 		}
 		if err != nil {
-			return fmt.Errorf("can't send message to telegram %q: %w", resp.Text, err)
+			return 0, fmt.Errorf("can't send message to telegram %q: %w", resp.Text, err)
 		}
 	}
 
@@ -275,23 +378,25 @@ func (l *TelegramListener) sendBotResponse(resp bot.Response, chatID int64) erro
 
 	if resp.Pin {
 		_, err = l.TbAPI.Request(tbapi.PinChatMessageConfig{ChatID: chatID, MessageID: res.MessageID, DisableNotification: true})
+		l.journal(bot.ModEntry{Action: bot.ModPin, Source: resp.Source, MessageID: res.MessageID, Message: resp.Text}, err)
 		if err != nil {
-			return fmt.Errorf("can't pin message to telegram: %w", err)
+			return res.MessageID, fmt.Errorf("can't pin message to telegram: %w", err)
 		}
 	}
 
 	if resp.Unpin {
 		_, err = l.TbAPI.Request(tbapi.UnpinChatMessageConfig{ChatID: chatID})
+		l.journal(bot.ModEntry{Action: bot.ModUnpin, Source: resp.Source}, err)
 		if err != nil {
-			return fmt.Errorf("can't unpin message to telegram: %w", err)
+			return res.MessageID, fmt.Errorf("can't unpin message to telegram: %w", err)
 		}
 	}
 
-	return nil
+	return res.MessageID, nil
 }
 
-// bans user or a channel
-func (l *TelegramListener) applyBan(msg bot.Message, duration time.Duration, chatID, userID int64) error {
+// bans user or a channel, source is a name of terminator for moderation journal
+func (l *TelegramListener) applyBan(msg bot.Message, duration time.Duration, chatID, userID int64, source string) error {
 	mention := "@" + msg.From.Username
 	if msg.From.Username == "" {
 		mention = msg.From.DisplayName
@@ -308,16 +413,60 @@ func (l *TelegramListener) applyBan(msg bot.Message, duration time.Duration, cha
 		m = fmt.Sprintf("%s _пал смертью храбрых, заблокирован навечно..._", bot.EscapeMarkDownV1Text(mention))
 	}
 
-	if err := l.sendBotResponse(bot.Response{Text: m, Send: true}, chatID); err != nil {
+	noticeID, err := l.sendBotResponse(bot.Response{Text: m, Send: true}, chatID)
+	if err != nil {
 		return fmt.Errorf("failed to send ban message for %v: %w", msg.From, err)
 	}
-	err := l.banUserOrChannel(duration, chatID, userID, channelID)
+	err = l.banUserOrChannel(duration, chatID, userID, channelID)
+	entry := bot.ModEntry{Action: bot.ModRestrict, Source: source, Actor: msg.From, Target: msg.From, Reason: "too active",
+		Duration: journalDuration(duration), MessageID: msg.ID, Message: msg.Text, NoticeID: noticeID}
+	if channelID != 0 { // telegram bans channels forever, until unbanned
+		entry.Action, entry.Target, entry.Duration = bot.ModBan, bot.User{}, 0
+		entry.ChannelID, entry.ChannelName = channelID, msg.SenderChat.UserName
+	}
+	l.journal(entry, err)
+	l.block(entry, err)
 	if err != nil {
 		return fmt.Errorf("failed to ban user %s: %w", banUserStr, err)
 	}
 	return nil
 }
 
+// journal saves moderation action to ModLog, if set. Failed action saved with error
+func (l *TelegramListener) journal(entry bot.ModEntry, actionErr error) {
+	if l.ModLog == nil {
+		return
+	}
+	if entry.Source == "" {
+		entry.Source = "listener"
+	}
+	if actionErr != nil {
+		entry.Error = actionErr.Error()
+	}
+	if err := l.ModLog.Add(entry); err != nil {
+		log.Printf("[WARN] can't save moderation record %+v, %v", entry, err)
+	}
+}
+
+// block adds permanently banned user to the Blocklist, if set. Temporary bans and channels are not blocklisted
+func (l *TelegramListener) block(entry bot.ModEntry, actionErr error) {
+	if l.Blocklist == nil || actionErr != nil || entry.Target.ID == 0 || entry.Duration != 0 {
+		return
+	}
+	if err := l.Blocklist.Add(entry.Target, entry.Reason); err != nil {
+		log.Printf("[WARN] can't add %+v to blocklist, %v", entry.Target, err)
+	}
+}
+
+// journalDuration converts ban duration to journal one, telegram treats restrictions
+// for more than 366 days as forever, journal keeps 0 for them
+func journalDuration(d time.Duration) time.Duration {
+	if d > 366*24*time.Hour {
+		return 0
+	}
+	return d
+}
+
 // Submit message text to telegram's group
 func (l *TelegramListener) Submit(ctx context.Context, text string, pin bool) error {
 	l.msgs.once.Do(func() { l.msgs.ch = make(chan bot.Response, 100) })
@@ -420,9 +569,10 @@ func (l *TelegramListener) banUserOrChannel(duration time.Duration, chatID, user
 
 func (l *TelegramListener) transform(msg *tbapi.Message) *bot.Message {
 	message := bot.Message{
-		ID:   msg.MessageID,
-		Sent: msg.Time(),
-		Text: msg.Text,
+		ID:        msg.MessageID,
+		Sent:      msg.Time(),
+		Text:      msg.Text,
+		Forwarded: msg.ForwardDate != 0,
 	}
 
 	if msg.Chat != nil {
@@ -437,6 +587,11 @@ func (l *TelegramListener) transform(msg *tbapi.Message) *bot.Message {
 		}
 	}
 
+	for _, u := range msg.NewChatMembers {
+		message.NewMembers = append(message.NewMembers, bot.User{ID: u.ID, Username: u.UserName,
+			DisplayName: u.FirstName + " " + u.LastName})
+	}
+
 	if msg.SenderChat != nil {
 		message.SenderChat = bot.SenderChat{
 			ID:       msg.SenderChat.ID,
@@ -449,21 +604,17 @@ func (l *TelegramListener) transform(msg *tbapi.Message) *bot.Message {
 		message.Entities = l.transformEntities(msg.Entities)
 
 	case msg.Photo != nil && len(msg.Photo) > 0:
-		sizes := msg.Photo
-		lastSize := sizes[len(sizes)-1]
-		message.Image = &bot.Image{
-			FileID:   lastSize.FileID,
-			Width:    lastSize.Width,
-			Height:   lastSize.Height,
-			Caption:  msg.Caption,
-			Entities: l.transformEntities(msg.CaptionEntities),
-		}
+		message.Image = l.transformPhoto(msg)
 	}
 
 	// fill in the message's reply-to message
 	if msg.ReplyToMessage != nil {
+		message.ReplyTo.ID = msg.ReplyToMessage.MessageID
 		message.ReplyTo.Text = msg.ReplyToMessage.Text
 		message.ReplyTo.Sent = msg.ReplyToMessage.Time()
+		if len(msg.ReplyToMessage.Photo) > 0 {
+			message.ReplyTo.Image = l.transformPhoto(msg.ReplyToMessage)
+		}
 		if msg.ReplyToMessage.From != nil {
 			message.ReplyTo.From = bot.User{
 				ID:          msg.ReplyToMessage.From.ID,
@@ -482,6 +633,18 @@ func (l *TelegramListener) transform(msg *tbapi.Message) *bot.Message {
 	return &message
 }
 
+// transformPhoto makes image of the largest photo size with caption
+func (l *TelegramListener) transformPhoto(msg *tbapi.Message) *bot.Image {
+	lastSize := msg.Photo[len(msg.Photo)-1]
+	return &bot.Image{
+		FileID:   lastSize.FileID,
+		Width:    lastSize.Width,
+		Height:   lastSize.Height,
+		Caption:  msg.Caption,
+		Entities: l.transformEntities(msg.CaptionEntities),
+	}
+}
+
 func (l *TelegramListener) transformEntities(entities []tbapi.MessageEntity) *[]bot.Entity {
 	if len(entities) == 0 {
 		return nil
@@ -115,6 +115,45 @@ func TestTelegramListener_DoWithBots(t *testing.T) {
 	assert.Equal(t, "bot's answer", mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
 }
 
+type sentListenerBot struct {
+	bot.InterfaceMock
+	sent map[int]int // request id -> sent id
+}
+
+func (b *sentListenerBot) OnSent(msg bot.Message, sentID int) { b.sent[msg.ID] = sentID }
+
+func TestTelegramListener_DoNotifiesSent(t *testing.T) {
+	mockLogger := &msgLoggerMock{SaveFunc: func(msg *bot.Message) {}}
+	mockAPI := &tbAPIMock{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{MessageID: 501, Text: c.(tbapi.MessageConfig).Text}, nil
+		},
+	}
+	b := &sentListenerBot{sent: map[int]int{}, InterfaceMock: bot.InterfaceMock{
+		OnMessageFunc: func(msg bot.Message) bot.Response {
+			if msg.Text == "chat! hi" {
+				return bot.Response{Send: true, Text: "hello", ReplyTo: msg.ID}
+			}
+			return bot.Response{}
+		}}}
+	l := TelegramListener{MsgLogger: mockLogger, TbAPI: mockAPI, Bots: bot.MultiBot{b}, Group: "gr"}
+
+	updChan := make(chan tbapi.Update, 2)
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 10, Chat: &tbapi.Chat{ID: 123}, Text: "chat! hi",
+		From: &tbapi.User{ID: 1, UserName: "user"}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 11, Chat: &tbapi.Chat{ID: 123}, Text: "no answer",
+		From: &tbapi.User{ID: 2, UserName: "other"}}}
+	close(updChan)
+	mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(context.Background())
+	assert.EqualError(t, err, "telegram update chan closed")
+	assert.Equal(t, map[int]int{10: 501}, b.sent, "only sent responses reported")
+}
+
 func TestTelegramListener_DoWithRtjc(t *testing.T) {
 	mockLogger := &msgLoggerMock{SaveFunc: func(msg *bot.Message) {}}
 	mockAPI := &tbAPIMock{
@@ -764,6 +803,62 @@ func TestTelegram_transformTextMessage(t *testing.T) {
 	)
 }
 
+func TestTelegram_transformReply(t *testing.T) {
+	l := TelegramListener{}
+	msg := l.transform(&tbapi.Message{
+		MessageID: 31,
+		Date:      1578627415,
+		Text:      "quote!",
+		ReplyToMessage: &tbapi.Message{
+			MessageID: 30,
+			Date:      1578627400,
+			Text:      "Message",
+			From:      &tbapi.User{ID: 100000001, UserName: "username", FirstName: "First", LastName: "Last"},
+		},
+	})
+	assert.Equal(t, 30, msg.ReplyTo.ID)
+	assert.Equal(t, "Message", msg.ReplyTo.Text)
+	assert.Equal(t, time.Unix(1578627400, 0), msg.ReplyTo.Sent)
+	assert.Equal(t, bot.User{ID: 100000001, Username: "username", DisplayName: "First Last"}, msg.ReplyTo.From)
+}
+
+func TestTelegram_transformReplyPhoto(t *testing.T) {
+	l := TelegramListener{}
+	msg := l.transform(&tbapi.Message{
+		MessageID: 31,
+		Date:      1578627415,
+		Text:      "chat! что на картинке?",
+		ReplyToMessage: &tbapi.Message{
+			MessageID: 30,
+			Date:      1578627400,
+			Caption:   "caption",
+			Photo: []tbapi.PhotoSize{
+				{FileID: "small", Width: 90, Height: 60},
+				{FileID: "large", Width: 900, Height: 600},
+			},
+			From: &tbapi.User{ID: 100000001, UserName: "username"},
+		},
+	})
+	assert.Nil(t, msg.Image)
+	require.NotNil(t, msg.ReplyTo.Image)
+	assert.Equal(t, bot.Image{FileID: "large", Width: 900, Height: 600, Caption: "caption"}, *msg.ReplyTo.Image)
+}
+
+func TestTelegram_transformForwarded(t *testing.T) {
+	l := TelegramListener{}
+	msg := l.transform(&tbapi.Message{MessageID: 32, Date: 1578627415, Text: "join @channel", ForwardDate: 1578627400,
+		ForwardFromChat: &tbapi.Chat{ID: -100500, UserName: "channel"}})
+	assert.True(t, msg.Forwarded)
+	assert.False(t, l.transform(&tbapi.Message{MessageID: 33, Text: "hello"}).Forwarded)
+}
+
+func TestTelegram_transformNewMembers(t *testing.T) {
+	l := TelegramListener{}
+	msg := l.transform(&tbapi.Message{MessageID: 34, From: &tbapi.User{ID: 1, UserName: "inviter"},
+		NewChatMembers: []tbapi.User{{ID: 2, UserName: "new", FirstName: "New", LastName: "User"}}})
+	assert.Equal(t, []bot.User{{ID: 2, Username: "new", DisplayName: "New User"}}, msg.NewMembers)
+}
+
 func TestTelegram_transformPhoto(t *testing.T) {
 	l := TelegramListener{}
 	assert.Equal(
@@ -860,3 +955,203 @@ func TestTelegram_transformEntities(t *testing.T) {
 		),
 	)
 }
+
+func TestTelegramListener_DoObservesUsers(t *testing.T) {
+	mockLogger := &msgLoggerMock{SaveFunc: func(msg *bot.Message) {}}
+	mockAPI := &tbAPIMock{GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+		return tbapi.Chat{ID: 123}, nil
+	}}
+	bots := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		return bot.Response{Send: false}
+	}}
+	users, err := bot.NewUserDirectory(t.TempDir() + "/users.jsonl")
+	require.NoError(t, err)
+
+	l := TelegramListener{
+		MsgLogger: mockLogger,
+		TbAPI:     mockAPI,
+		Bots:      bots,
+		Group:     "gr",
+		Users:     users,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	updChan := make(chan tbapi.Update, 2)
+	updChan <- tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}, Text: "text 123",
+		From: &tbapi.User{ID: 1, UserName: "user1"}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 456}, Text: "other chat",
+		From: &tbapi.User{ID: 2, UserName: "user2"}}}
+	close(updChan)
+	mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err = l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+
+	assert.Equal(t, 1, users.Len())
+	u, ok := users.Lookup("user1")
+	require.True(t, ok)
+	assert.Equal(t, int64(1), u.ID)
+}
+
+func TestTelegramListener_DoModLog(t *testing.T) {
+	mockLogger := &msgLoggerMock{SaveFunc: func(msg *bot.Message) {}}
+	mockAPI := &tbAPIMock{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{MessageID: 99, Text: c.(tbapi.MessageConfig).Text, From: &tbapi.User{UserName: "bot"}}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+	}
+	bots := &bot.InterfaceMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		switch msg.Text {
+		case "spam":
+			return bot.Response{Send: true, Text: "spam!", BanInterval: 400 * 24 * time.Hour, User: msg.From,
+				ReplyTo: msg.ID, DeleteReplyTo: true, Reason: "spam: stop words", Details: "stop words: \"в личку\"",
+				Source: "SpamFilter"}
+		case "pin":
+			return bot.Response{Send: true, Text: "pinned", Pin: true, Source: "PrepPost"}
+		}
+		return bot.Response{}
+	}}
+	modLog, err := bot.NewModLog(t.TempDir() + "/modlog.jsonl")
+	require.NoError(t, err)
+	blocklist, err := bot.NewBlocklist(t.TempDir() + "/blocklist.jsonl")
+	require.NoError(t, err)
+
+	l := TelegramListener{
+		MsgLogger:  mockLogger,
+		TbAPI:      mockAPI,
+		Bots:       bots,
+		SuperUsers: SuperUser{"admin"},
+		Group:      "gr",
+		ModLog:     modLog,
+		Blocklist:  blocklist,
+		// high penalties to prevent activity bans
+		AllActivityTerm:        Terminator{BanPenalty: 10},
+		BotsActivityTerm:       Terminator{BanPenalty: 10},
+		OverallBotActivityTerm: Terminator{BanPenalty: 10},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	updChan := make(chan tbapi.Update, 3)
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 1, Chat: &tbapi.Chat{ID: 123}, Text: "spam",
+		From: &tbapi.User{ID: 1, UserName: "spammer"}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 2, Chat: &tbapi.Chat{ID: 123}, Text: "pin",
+		From: &tbapi.User{ID: 2, UserName: "user2"}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 3, Chat: &tbapi.Chat{ID: 123}, Text: "from channel",
+		From: &tbapi.User{ID: 136817688, UserName: "Channel_Bot"}, SenderChat: &tbapi.Chat{ID: 555, UserName: "chan"}}}
+	close(updChan)
+	mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err = l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+
+	entries := modLog.Find(bot.ModQuery{})
+	require.Len(t, entries, 5)
+
+	assert.Equal(t, bot.ModRestrict, entries[0].Action)
+	assert.Equal(t, "SpamFilter", entries[0].Source)
+	assert.Equal(t, "spam: stop words", entries[0].Reason)
+	assert.Equal(t, `stop words: "в личку"`, entries[0].Details)
+	assert.Equal(t, int64(1), entries[0].Target.ID)
+	assert.Equal(t, time.Duration(0), entries[0].Duration, "forever")
+	assert.Equal(t, "spam", entries[0].Message)
+	assert.Equal(t, 99, entries[0].NoticeID, "bot message announced the ban")
+
+	assert.Equal(t, bot.ModDelete, entries[1].Action)
+	assert.Equal(t, 1, entries[1].MessageID)
+	assert.Equal(t, "spammer", entries[1].Target.Username)
+
+	assert.Equal(t, bot.ModPin, entries[2].Action)
+	assert.Equal(t, "PrepPost", entries[2].Source)
+	assert.Equal(t, 99, entries[2].MessageID)
+
+	assert.Equal(t, bot.ModBan, entries[3].Action)
+	assert.Equal(t, "channel_ban", entries[3].Source)
+	assert.Equal(t, int64(555), entries[3].ChannelID)
+	assert.Equal(t, "chan", entries[3].ChannelName)
+	assert.Equal(t, bot.ModDelete, entries[4].Action)
+	assert.Equal(t, 3, entries[4].MessageID)
+
+	assert.True(t, blocklist.Contains(1), "permanently banned user blocklisted")
+	assert.Equal(t, 1, blocklist.Len(), "channel not blocklisted")
+}
+
+func TestTelegramListener_liftLoop(t *testing.T) {
+	mockAPI := &tbAPIMock{
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+	}
+	modLog, err := bot.NewModLog(t.TempDir() + "/modlog.jsonl")
+	require.NoError(t, err)
+	require.NoError(t, modLog.Add(bot.ModEntry{Time: time.Now().Add(-time.Hour), Action: bot.ModRestrict, Source: "WTF",
+		Target: bot.User{ID: 1, Username: "user1"}, Duration: 30 * time.Minute}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	l := TelegramListener{TbAPI: mockAPI, ModLog: modLog, chatID: 123, LiftInterval: 10 * time.Millisecond}
+	go func() {
+		l.liftLoop(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return len(modLog.Find(bot.ModQuery{Action: bot.ModUnban})) == 1 },
+		time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+	assert.Len(t, mockAPI.RequestCalls(), 1, "lifted once")
+}
+
+func TestTelegramListener_liftExpired(t *testing.T) {
+	mockAPI := &tbAPIMock{
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			if c.(tbapi.RestrictChatMemberConfig).UserID == 2 {
+				return &tbapi.APIResponse{Ok: false, Description: "not enough rights"}, nil
+			}
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+	}
+	modLog, err := bot.NewModLog(t.TempDir() + "/modlog.jsonl")
+	require.NoError(t, err)
+	now := time.Now()
+	require.NoError(t, modLog.Add(bot.ModEntry{Time: now.Add(-time.Hour), Action: bot.ModRestrict, Source: "WTF",
+		Target: bot.User{ID: 1, Username: "user1"}, Duration: 30 * time.Minute}))
+	require.NoError(t, modLog.Add(bot.ModEntry{Time: now.Add(-time.Hour), Action: bot.ModRestrict, Source: "all_activity",
+		Target: bot.User{ID: 2}, Duration: 5 * time.Minute}))
+	require.NoError(t, modLog.Add(bot.ModEntry{Time: now.Add(-time.Hour), Action: bot.ModRestrict, Source: "WTF",
+		Target: bot.User{ID: 3}, Duration: 2 * time.Hour}))
+	require.NoError(t, modLog.Add(bot.ModEntry{Time: now.Add(-time.Hour), Action: bot.ModBan, Source: "channel_ban",
+		ChannelID: -100500}))
+
+	l := TelegramListener{TbAPI: mockAPI, ModLog: modLog, chatID: 123}
+	l.liftExpired(now)
+
+	require.Len(t, mockAPI.RequestCalls(), 2)
+	lift := mockAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig)
+	assert.Equal(t, int64(1), lift.UserID)
+	assert.Equal(t, int64(123), lift.ChatID)
+	assert.True(t, lift.Permissions.CanSendMessages)
+
+	unbans := modLog.Find(bot.ModQuery{Action: bot.ModUnban})
+	require.Len(t, unbans, 1, "failed lift not journaled")
+	assert.Equal(t, "expired", unbans[0].Source)
+	assert.Equal(t, "restrict by WTF expired", unbans[0].Reason)
+	assert.Equal(t, int64(1), unbans[0].Target.ID)
+
+	l.liftExpired(now.Add(time.Minute))
+	assert.Len(t, mockAPI.RequestCalls(), 3, "failed lift retried, lifted one skipped")
+	assert.Len(t, modLog.Find(bot.ModQuery{Action: bot.ModUnban}), 1, "retry not journaled again")
+	assert.Len(t, modLog.Active(now), 2)
+
+	for i := 2; i <= maxLiftAttempts+1; i++ {
+		l.liftExpired(now.Add(time.Duration(i) * time.Minute))
+	}
+	assert.Len(t, mockAPI.RequestCalls(), 1+maxLiftAttempts, "failed lift given up after max attempts")
+	assert.Len(t, modLog.Find(bot.ModQuery{Action: bot.ModUnban}), 1)
+}
@@ -0,0 +1,30 @@
+package homoglyph
+
+// confusables maps characters of other scripts to the Latin letters and digits they can't be told apart from.
+// It is a subset of Unicode confusables.txt (https://www.unicode.org/Public/security/latest/confusables.txt)
+// limited to Cyrillic, Greek, Armenian and Latin extensions used to spoof names and bypass word filters.
+// Characters with compatibility decomposition (fullwidth, mathematical, circled letters and so on)
+// are not listed here, NFKD takes care of them.
+//
+// The map is applied to lowercased text, so the key is the lowercase letter even if only uppercase one
+// is confusable, e.g. "в" stands for "В" looking like "B". If both cases are confusable with different
+// letters, like greek "Ν" and "ν", the uppercase wins.
+var confusables = map[rune]string{
+	// cyrillic
+	'а': "a", 'в': "b", 'е': "e", 'к': "k", 'м': "m", 'н': "h", 'о': "o", 'р': "p", 'с': "c", 'т': "t",
+	'у': "y", 'х': "x", 'ѕ': "s", 'і': "i", 'ј': "j", 'ԛ': "q", 'ԝ': "w", 'һ': "h", 'ӏ': "l", 'ү': "y",
+
+	// greek
+	'α': "a", 'β': "b", 'ε': "e", 'ζ': "z", 'η': "h", 'ι': "i", 'κ': "k", 'μ': "m", 'ν': "n", 'ο': "o",
+	'ρ': "p", 'τ': "t", 'υ': "y", 'χ': "x", 'ϲ': "c", 'ϳ': "j",
+
+	// armenian
+	'օ': "o", 'տ': "s", 'ս': "u", 'հ': "h", 'ո': "n", 'ց': "g", 'զ': "q",
+
+	// latin extensions
+	'ı': "i", 'ȷ': "j", 'ɑ': "a", 'ɩ': "i", 'ʏ': "y", 'ᴄ': "c", 'ᴏ': "o", 'ᴠ': "v", 'ᴢ': "z", 'ꜱ': "s",
+	'ɡ': "g", 'ℓ': "l", 'ǀ': "l",
+
+	// ascii digits and symbols
+	'0': "o", '1': "l", '|': "l",
+}
@@ -0,0 +1,107 @@
+// Package homoglyph makes confusable skeletons of text, in the spirit of Unicode TR39.
+// Two strings that look the same to a human have the same skeleton, e.g. "зaрaбoтка" written with latin "a" and "o"
+// and "заработка" written in cyrillic only. Skeleton is meant for comparison only, it is not readable text.
+package homoglyph
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	diacriticLookalikes = newReplacer(DiacriticLookalikes(), nil)
+	lookalikes          = newReplacer(Lookalikes(), nil)
+
+	// skeletonLookalikes skips ascii and russian letters from Lookalikes, like "в" for "w" or "7" for "?".
+	// Those are fine to catch "втф!" but would mangle regular text.
+	skeletonLookalikes = newReplacer(Lookalikes(), func(s string) bool {
+		for _, r := range s {
+			if r > unicode.MaxASCII && !isRussian(r) {
+				return true
+			}
+		}
+		return false
+	})
+)
+
+// Skeleton returns confusable skeleton of the text. It lowercases the text, replaces lookalikes,
+// decomposes compatibility characters (fullwidth, mathematical and so on), removes diacritic marks
+// and maps confusable characters to their latin prototypes.
+func Skeleton(s string) string {
+	s = strings.ToLower(diacriticLookalikes.Replace(s))
+	s = skeletonLookalikes.Replace(s)
+	s, _, _ = transform.String(transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), s)
+	return skeletonLookalikes.Replace(mapConfusables(strings.ToLower(s))) // NFKD may produce uppercase, like "𝐀"
+}
+
+// Contains reports whether skeleton of substr is within skeleton of s
+func Contains(s, substr string) bool {
+	return strings.Contains(Skeleton(s), Skeleton(substr))
+}
+
+// RemoveDiacritics removes diacritic marks, i.e. all characters in Unicode Mn category after NFD
+// Example ẃŧḟ! -> wtf!
+// https://blog.golang.org/normalization#TOC_10.
+func RemoveDiacritics(s string) string {
+	res, _, _ := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), s)
+	return res
+}
+
+// ReplaceLookalikes replaces characters that look like "w","t","f","!","?" with their ASCII representation
+func ReplaceLookalikes(s string) string {
+	return lookalikes.Replace(s)
+}
+
+// ReplaceDiacriticLookalikes replaces diacritic characters that look like "w","t","f","!","?"
+// with their ASCII representation. Should be called before RemoveDiacritics
+func ReplaceDiacriticLookalikes(s string) string {
+	return diacriticLookalikes.Replace(s)
+}
+
+// newReplacer makes replacer from target -> lookalikes table, filter allows to skip some lookalikes.
+// Longer lookalikes go first, so "ʌʌ" is replaced with "w" before "ʌ" is considered.
+func newReplacer(table map[string][]string, filter func(string) bool) *strings.Replacer {
+	type pair struct{ from, to string }
+	pairs := []pair{}
+	for to, list := range table {
+		for _, from := range list {
+			if filter != nil && !filter(from) {
+				continue
+			}
+			pairs = append(pairs, pair{from: from, to: to})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if len(pairs[i].from) != len(pairs[j].from) {
+			return len(pairs[i].from) > len(pairs[j].from)
+		}
+		return pairs[i].from < pairs[j].from
+	})
+	oldnew := make([]string, 0, len(pairs)*2)
+	for _, p := range pairs {
+		oldnew = append(oldnew, p.from, p.to)
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+func mapConfusables(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for _, r := range s {
+		if proto, ok := confusables[r]; ok {
+			sb.WriteString(proto)
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func isRussian(r rune) bool {
+	return (r >= 'а' && r <= 'я') || (r >= 'А' && r <= 'Я') || r == 'ё' || r == 'Ё'
+}
@@ -0,0 +1,48 @@
+package homoglyph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkeleton(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"latin in cyrillic", "зaрaбoтка", "заработка"},
+		{"cyrillic in latin", "Umputun", "Umрutun"},
+		{"case", "В ЛИЧКУ", "в личку"},
+		{"capital cyrillic", "Bobuk", "Вobuk"},
+		{"greek", "ΑΡΙ", "API"},
+		{"fullwidth", "ｆｒｅｅ", "free"},
+		{"math", "𝐟𝐫𝐞𝐞", "free"},
+		{"diacritic", "ẃtḟ", "wtf"},
+		{"lookalikes", "ʍtf", "wtf"},
+		{"digits", "l0gin", "1ogin"},
+		{"short й", "мой", "мои"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Skeleton(tt.a), Skeleton(tt.b))
+		})
+	}
+
+	assert.NotEqual(t, Skeleton("втф"), Skeleton("wtf"), "russian letters are not lookalikes for skeleton")
+	assert.NotEqual(t, Skeleton("заработка"), Skeleton("работа"))
+	assert.Equal(t, "", Skeleton(""))
+}
+
+func TestContains(t *testing.T) {
+	assert.True(t, Contains("Пишитe в личныe cooбщeния", "ЛИЧНЫЕ СООБЩЕНИЯ"))
+	assert.True(t, Contains("для yдaлённoгo зaрaбoткa", "удаленного заработка"))
+	assert.False(t, Contains("hello world", "личку"))
+}
+
+func TestReplaceLookalikes(t *testing.T) {
+	assert.Equal(t, "wtf!", ReplaceLookalikes("ʍтf!"))
+	assert.Equal(t, "wtf!", ReplaceLookalikes("ʌʌtf!"), "longer lookalike first")
+	assert.Equal(t, "wtf!", RemoveDiacritics("ẃtḟ!"))
+	assert.Equal(t, "f", ReplaceDiacriticLookalikes("ᷥ"))
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"time"
 
@@ -19,6 +20,7 @@ import (
 	"github.com/jessevdk/go-flags"
 	"golang.org/x/time/rate"
 
+	"github.com/radio-t/super-bot/app/bayes"
 	"github.com/radio-t/super-bot/app/bot"
 	"github.com/radio-t/super-bot/app/bot/openai"
 	"github.com/radio-t/super-bot/app/events"
@@ -33,43 +35,110 @@ var opts struct {
 		Timeout time.Duration `long:"timeout" env:"TIMEOUT" description:"http client timeout for getting files from Telegram" default:"30s"`
 	} `group:"telegram" namespace:"telegram" env-namespace:"TELEGRAM"`
 
-	RtjcPort             int              `short:"p" long:"port" env:"RTJC_PORT" default:"18001" description:"rtjc port room"`
-	LogsPath             string           `short:"l" long:"logs" env:"TELEGRAM_LOGS" default:"logs" description:"path to logs"`
-	SuperUsers           events.SuperUser `long:"super" description:"super-users"`
-	MashapeToken         string           `long:"mashape" env:"MASHAPE_TOKEN" description:"mashape token"`
-	SysData              string           `long:"sys-data" env:"SYS_DATA" default:"data" description:"location of sys data"`
-	NewsArticles         int              `long:"max-articles" env:"MAX_ARTICLES" default:"5" description:"max number of news articles"`
-	IdleDuration         time.Duration    `long:"idle" env:"IDLE" default:"30s" description:"idle duration"`
-	ExportNum            int              `long:"export-num" description:"show number for export"`
-	ExportPath           string           `long:"export-path" default:"logs" description:"path to export directory"`
-	ExportDay            int              `long:"export-day" description:"day in yyyymmdd"`
-	TemplateFile         string           `long:"export-template" default:"logs.html" description:"path to template file"`
-	ExportBroadcastUsers events.SuperUser `long:"broadcast" description:"broadcast-users"`
+	RtjcPort              int              `short:"p" long:"port" env:"RTJC_PORT" default:"18001" description:"rtjc port room"`
+	LogsPath              string           `short:"l" long:"logs" env:"TELEGRAM_LOGS" default:"logs" description:"path to logs"`
+	SuperUsers            events.SuperUser `long:"super" description:"super-users"`
+	MashapeToken          string           `long:"mashape" env:"MASHAPE_TOKEN" description:"mashape token"`
+	SysData               string           `long:"sys-data" env:"SYS_DATA" default:"data" description:"location of sys data"`
+	StoragePath           string           `long:"storage" env:"STORAGE_PATH" default:"var" description:"location of persistent bot data"`
+	NewsArticles          int              `long:"max-articles" env:"MAX_ARTICLES" default:"5" description:"max number of news articles"`
+	IdleDuration          time.Duration    `long:"idle" env:"IDLE" default:"30s" description:"idle duration"`
+	ExportNum             int              `long:"export-num" description:"show number for export"`
+	ExportPath            string           `long:"export-path" default:"logs" description:"path to export directory"`
+	ExportDay             int              `long:"export-day" description:"day in yyyymmdd"`
+	TemplateFile          string           `long:"export-template" default:"logs.html" description:"path to template file"`
+	ExportBroadcastUsers  events.SuperUser `long:"broadcast" description:"broadcast-users"`
+	ExportQuotes          string           `long:"export-quotes" description:"export saved quotes to markdown file"`
+	QuoteVotes            int              `long:"quote-votes" env:"QUOTE_VOTES" default:"3" description:"votes required to save a quote, 0 disables voting"`
+	Banhammer             bool             `long:"banhammer" env:"BANHAMMER" description:"enable ban!, mute! and unban! commands for superusers"`
+	WarnExpire            time.Duration    `long:"warn-expire" env:"WARN_EXPIRE" default:"720h" description:"warnings expiration period, 0 for never"`
+	WarnSteps             []string         `long:"warn-step" env:"WARN_STEPS" env-delim:"," default:"3:24h" default:"5:0" description:"penalty for active warnings, warnings:mute duration, 0 duration for ban"`
+	ImpersonationRestrict time.Duration    `long:"impersonation-restrict" env:"IMPERSONATION_RESTRICT" default:"0" description:"mute period for users looking like hosts or superusers, 0 for alert only"`
 
 	SpamFilter struct {
 		Enabled   bool          `long:"enabled" env:"ENABLED" description:"enable spam filter"`
 		API       string        `long:"api" env:"CAS_API" default:"https://api.cas.chat" description:"CAS API"`
 		TimeOut   time.Duration `long:"timeout" env:"TIMEOUT" default:"5s" description:"CAS timeout"`
+		CasTTL    time.Duration `long:"cas-ttl" env:"CAS_TTL" default:"24h" description:"CAS results cache period, 0 disables caching"`
+		Blocklist string        `long:"blocklist" env:"BLOCKLIST" default:"" description:"path to blocklist of known spammers, can be shared between chats, spam_blocklist.jsonl in storage by default"`
 		Samples   string        `long:"samples" env:"SAMPLES" default:"" description:"path to spam samples"`
 		Threshold float64       `long:"threshold" env:"THRESHOLD" default:"0.5" description:"spam threshold"`
 		MinMsgLen int           `long:"min-msg-len" env:"MIN_MSG_LEN" default:"100" description:"min message length to check"`
 		Dry       bool          `long:"dry" env:"DRY" description:"dry mode, no bans"`
+
+		FirstMessages int `long:"first-messages" env:"FIRST_MESSAGES" default:"3" description:"clean messages to approve new user, checked with stricter rules for links and forwards before"`
+
+		Ham            string  `long:"ham" env:"HAM" default:"" description:"path to ham samples, known false positives"`
+		Model          string  `long:"model" env:"MODEL" default:"" description:"path to naive bayes model, spam_model.json in storage by default"`
+		BayesThreshold float64 `long:"bayes-threshold" env:"BAYES_THRESHOLD" default:"0.95" description:"naive bayes spam probability threshold, 0 disables it"`
+		Train          bool    `long:"train" description:"train naive bayes model from samples and chat logs and exit"`
+
+		Eval           bool      `long:"eval" description:"evaluate spam filter on labeled messages and chat logs and exit"`
+		Labeled        string    `long:"labeled" description:"labeled messages for evaluation, spam<tab>text or ham<tab>text per line"`
+		EvalThresholds []float64 `long:"eval-threshold" description:"similarity threshold to evaluate, repeat for multiple"`
+		RegularMsgs    int       `long:"regular-msgs" default:"20" description:"min messages in logs to treat author as a regular user"`
+		EvalShow       int       `long:"eval-show" default:"20" description:"max flagged messages to show per threshold"`
 	} `group:"spam-filter" namespace:"spam-filter" env-namespace:"SPAM_FILTER"`
 
-	OpenAI struct {
-		AuthToken         string `long:"token" env:"AUTH_TOKEN" description:"OpenAI auth token"`
-		MaxTokensResponse int    `long:"max-tokens" env:"MAX_TOKENS" default:"1000" description:"OpenAI max_tokens in response"`
-		MaxTokensRequest  int    `long:"max-tokens-request" env:"MAX_TOKENS_REQUEST" default:"3000" description:"OpenAI max tokens in request"`
-		MaxSymbolsRequest int    `long:"max-symbols-request" env:"MAX_SYMBOLS_REQUEST" default:"12000" description:"OpenAI max symbols in request for fallback logic"`
-		Prompt            string `long:"prompt" env:"PROMPT" default:"" description:"OpenAI prompt"`
+	WTF struct {
+		Enabled bool          `long:"enabled" env:"ENABLED" description:"enable wtf! random bans"`
+		MinBan  time.Duration `long:"min-ban" env:"MIN_BAN" default:"24h" description:"min wtf! ban duration"`
+		MaxBan  time.Duration `long:"max-ban" env:"MAX_BAN" default:"168h" description:"max wtf! ban duration"`
+	} `group:"wtf" namespace:"wtf" env-namespace:"WTF"`
+
+	ModLog struct {
+		Show   bool          `long:"show" description:"print moderation journal and exit"`
+		Target string        `long:"target" description:"show actions for the user or channel, username or id"`
+		Action string        `long:"action" description:"show actions of the kind, like ban, restrict or delete"`
+		Source string        `long:"source" description:"show actions made by the source, like WTF or Banhammer"`
+		Since  time.Duration `long:"since" description:"show actions made during the interval, like 24h"`
+		Limit  int           `long:"limit" default:"100" description:"max number of actions to show, 0 for all"`
+	} `group:"modlog" namespace:"modlog"`
 
-		EnableAutoResponse      bool `long:"auto-response" env:"AUTO_RESPONSE" description:"enable auto response from OpenAI"`
-		HistorySize             int  `long:"history-size" env:"HISTORY_SIZE" default:"10" description:"OpenAI history size for context answers"`
-		HistoryReplyProbability int  `long:"history-reply-probability" env:"HISTORY_REPLY_PROBABILITY" default:"25" description:"percentage of the probability to reply with history (0%-100%)"`
+	OpenAI struct {
+		AuthToken         string  `long:"token" env:"AUTH_TOKEN" description:"OpenAI auth token"`
+		BaseURL           string  `long:"base-url" env:"BASE_URL" description:"OpenAI-compatible API base url, OpenAI if empty"`
+		Model             string  `long:"model" env:"MODEL" default:"gpt-4o-2024-08-06" description:"OpenAI model for chat"`
+		SummaryModel      string  `long:"summary-model" env:"SUMMARY_MODEL" description:"OpenAI model for summaries, same as model if empty"`
+		Temperature       float32 `long:"temperature" env:"TEMPERATURE" description:"OpenAI sampling temperature, model default if 0"`
+		TopP              float32 `long:"top-p" env:"TOP_P" description:"OpenAI nucleus sampling top_p, model default if 0"`
+		MaxTokensResponse int     `long:"max-tokens" env:"MAX_TOKENS" default:"1000" description:"OpenAI max_tokens in response"`
+		MaxTokensRequest  int     `long:"max-tokens-request" env:"MAX_TOKENS_REQUEST" default:"3000" description:"OpenAI max tokens in request, with system prompt and history"`
+		MaxSymbolsRequest int     `long:"max-symbols-request" env:"MAX_SYMBOLS_REQUEST" default:"12000" description:"OpenAI max symbols in request for fallback logic"`
+		Prompt            string  `long:"prompt" env:"PROMPT" default:"" description:"OpenAI prompt"`
+
+		EnableAutoResponse      bool          `long:"auto-response" env:"AUTO_RESPONSE" description:"enable auto response from OpenAI"`
+		HistorySize             int           `long:"history-size" env:"HISTORY_SIZE" default:"10" description:"OpenAI history size for context answers"`
+		HistoryReplyProbability int           `long:"history-reply-probability" env:"HISTORY_REPLY_PROBABILITY" default:"25" description:"percentage of the probability to reply with history to a question (0%-100%)"`
+		RandomReplyProbability  int           `long:"random-reply-probability" env:"RANDOM_REPLY_PROBABILITY" default:"10" description:"percentage of the probability to reply with history to other messages (0%-100%)"`
+		AutoResponseLive        bool          `long:"auto-response-live" env:"AUTO_RESPONSE_LIVE" description:"auto response during live broadcasts too, quiet by default"`
+		AddressedResponse       bool          `long:"addressed-response" env:"ADDRESSED_RESPONSE" description:"respond to messages addressed to the bot: mentions, replies to its AI answers and bot names"`
+		BotNames                []string      `long:"bot-name" env:"BOT_NAMES" env-delim:"," description:"names of the bot in messages for addressed response, like бот"`
+		ThreadTTL               time.Duration `long:"thread-ttl" env:"THREAD_TTL" default:"12h" description:"how long replies to bot's answers continue the conversation, 0 disables"`
+		UserDailyTokens         int           `long:"user-daily-tokens" env:"USER_DAILY_TOKENS" default:"20000" description:"daily token budget per user, 0 for unlimited"`
+		DailyTokens             int           `long:"daily-tokens" env:"DAILY_TOKENS" default:"0" description:"daily token budget for all requests, 0 for unlimited"`
+		ImageMaxSize            int64         `long:"image-max-size" env:"IMAGE_MAX_SIZE" default:"5242880" description:"max size of image for chat! about photos in bytes, 0 disables images"`
+		ImageCooldown           time.Duration `long:"image-cooldown" env:"IMAGE_COOLDOWN" default:"5m" description:"min interval between chat! requests with images per user"`
+		MaxToolRounds           int           `long:"tool-rounds" env:"TOOL_ROUNDS" default:"3" description:"max rounds of tool calls (schedule, podcasts search, news, hosts time) per chat! request, 0 disables tools"`
+
+		Personas map[string]string `long:"persona" env:"PERSONAS" env-delim:"," description:"persona of openai_prompts.tmpl in sys data per command (chat!, gpt!, auto, summary, digest), like gpt!:expert"`
+		Language string            `long:"language" env:"LANGUAGE" default:"russian" description:"language of summaries and digests, available in prompts"`
+
+		ModerationBlocklist string `long:"moderation-blocklist" env:"MODERATION_BLOCKLIST" default:"" description:"file with words and phrases not allowed in AI responses, a line per entry"`
+		ModerationMaxLength int    `long:"moderation-max-length" env:"MODERATION_MAX_LENGTH" default:"2000" description:"max length of AI response in symbols, 0 for unlimited"`
+		ModerationEndpoint  bool   `long:"moderation-endpoint" env:"MODERATION_ENDPOINT" description:"check AI responses with moderation endpoint of the API"`
+		ModerationRetry     bool   `long:"moderation-retry" env:"MODERATION_RETRY" description:"retry rejected AI response once with stricter prompt instead of staying silent"`
+
+		TldrMessages    int           `long:"tldr-messages" env:"TLDR_MESSAGES" default:"100" description:"number of the last messages for tldr! digest"`
+		TldrPeriod      time.Duration `long:"tldr-period" env:"TLDR_PERIOD" default:"1h" description:"max period for tldr! 30m"`
+		TldrSuperPeriod time.Duration `long:"tldr-super-period" env:"TLDR_SUPER_PERIOD" default:"24h" description:"max period for tldr! from superusers"`
+		TldrCache       time.Duration `long:"tldr-cache" env:"TLDR_CACHE" default:"5m" description:"how long the same tldr! answered from cache"`
 
 		Timeout time.Duration `long:"timeout" env:"TIMEOUT" default:"60s" description:"OpenAI timeout in seconds"`
 	} `group:"openai" namespace:"openai" env-namespace:"OPENAI"`
 
+	SiteAPI              string `long:"site-api" env:"SITE_API" default:"https://radio-t.com/site-api" description:"Radio-T site API, for podcasts search"`
+	NewsAPI              string `long:"news-api" env:"NEWS_API" default:"https://news.radio-t.com/api" description:"Radio-T news API"`
 	RemarkAPI            string `long:"remark-api" env:"REMARK_API" default:"https://remark42.radio-t.com/api/v1/find" description:"Remark API"`
 	UreadabilityAPI      string `long:"ur-api" env:"UREADABILITY_API" default:"https://ureadability.radio-t.com/api/content/v1/parser" description:"uReadability API"`
 	UreadabilityToken    string `long:"ur-token" env:"UREADABILITY_TOKEN" default:"undefined" description:"uReadability token"`
@@ -102,6 +171,22 @@ func main() {
 		export()
 		return
 	}
+	if opts.ExportQuotes != "" {
+		exportQuotes()
+		return
+	}
+	if opts.ModLog.Show {
+		showModLog()
+		return
+	}
+	if opts.SpamFilter.Train {
+		trainSpamModel()
+		return
+	}
+	if opts.SpamFilter.Eval {
+		evalSpamFilter()
+		return
+	}
 
 	tbAPI, err := tbapi.NewBotAPI(opts.Telegram.Token)
 	if err != nil {
@@ -112,8 +197,59 @@ func main() {
 	httpClient := &http.Client{Timeout: 5 * time.Second}
 	// 5 seconds is not enough for OpenAI requests
 	httpClientOpenAI := makeOpenAIHttpClient()
+	openAIUsage, err := openai.NewUsage(filepath.Join(opts.StoragePath, "openai_usage.jsonl"),
+		openai.UsageParams{UserDailyTokens: opts.OpenAI.UserDailyTokens, DailyTokens: opts.OpenAI.DailyTokens})
+	if err != nil {
+		log.Fatalf("[ERROR] can't load OpenAI usage, %v", err)
+	}
+	var openAIImages reporter.FileRecipient // chat! about photos disabled if not set
+	if opts.OpenAI.ImageMaxSize > 0 {
+		openAIImages = reporter.NewTelegramFileRecipient(tbAPI, opts.Telegram.Timeout)
+	}
+	openAIModeration := openai.ModerationParams{MaxLength: opts.OpenAI.ModerationMaxLength,
+		Endpoint: opts.OpenAI.ModerationEndpoint, Retry: opts.OpenAI.ModerationRetry}
+	if opts.OpenAI.ModerationBlocklist != "" {
+		if openAIModeration.Blocklist, err = openai.ReadBlocklist(opts.OpenAI.ModerationBlocklist); err != nil {
+			log.Fatalf("[ERROR] can't load OpenAI moderation blocklist, %v", err)
+		}
+	}
+	podcasts := bot.NewPodcasts(httpClient, opts.SiteAPI, 5)
+	openAIPrompts, err := openai.NewPrompts(openai.PromptParams{
+		Path:       filepath.Join(opts.SysData, "openai_prompts.tmpl"),
+		Personas:   opts.OpenAI.Personas,
+		Chat:       opts.Telegram.Group,
+		Language:   opts.OpenAI.Language,
+		ShowNumber: podcasts.LastShow,
+	})
+	if err != nil {
+		log.Fatalf("[ERROR] can't load OpenAI prompts, %v", err)
+	}
+	when := bot.NewWhen()
+	openAITools := []openai.Tool{
+		openai.ScheduleTool(when),
+		openai.PodcastsTool(podcasts),
+		openai.NewsTool(bot.NewNews(httpClient, opts.NewsAPI, 5)),
+	}
+	if wt, err := bot.NewWhatsTheTime(opts.SysData); err == nil {
+		openAITools = append(openAITools, openai.HostsTimeTool(wt))
+	} else {
+		log.Printf("[WARN] no hosts time tool for OpenAI, %v", err)
+	}
+	var openAILive func(now time.Time) bool // auto-responses are quiet during live broadcasts if set
+	if !opts.OpenAI.AutoResponseLive {
+		openAILive = func(now time.Time) bool {
+			_, _, live := when.Schedule(now)
+			return live
+		}
+	}
+	var multiBot bot.MultiBot // used by OpenAI bot to skip commands of other bots, filled below
 	openAIBot := openai.NewOpenAI(openai.Params{
 		AuthToken:               opts.OpenAI.AuthToken,
+		BaseURL:                 opts.OpenAI.BaseURL,
+		Model:                   opts.OpenAI.Model,
+		SummaryModel:            opts.OpenAI.SummaryModel,
+		Temperature:             opts.OpenAI.Temperature,
+		TopP:                    opts.OpenAI.TopP,
 		MaxTokensResponse:       opts.OpenAI.MaxTokensResponse,
 		MaxTokensRequest:        opts.OpenAI.MaxTokensRequest,
 		MaxSymbolsRequest:       opts.OpenAI.MaxSymbolsRequest,
@@ -121,21 +257,103 @@ func main() {
 		HistorySize:             opts.OpenAI.HistorySize,
 		HistoryReplyProbability: opts.OpenAI.HistoryReplyProbability,
 		EnableAutoResponse:      opts.OpenAI.EnableAutoResponse,
+		RandomReplyProbability:  opts.OpenAI.RandomReplyProbability,
+		Live:                    openAILive,
+		AddressedResponse:       opts.OpenAI.AddressedResponse,
+		BotUsername:             tbAPI.Self.UserName,
+		BotNames:                opts.OpenAI.BotNames,
+		ThreadTTL:               opts.OpenAI.ThreadTTL,
+		Commands:                func() []string { return multiBot.ReactOn() },
+		Usage:                   openAIUsage,
+		Images:                  openAIImages,
+		MaxImageSize:            opts.OpenAI.ImageMaxSize,
+		ImageCooldown:           opts.OpenAI.ImageCooldown,
+		Tools:                   openAITools,
+		MaxToolRounds:           opts.OpenAI.MaxToolRounds,
+		Moderation:              openAIModeration,
+		Prompts:                 openAIPrompts,
 	}, httpClientOpenAI, opts.SuperUsers)
 
-	multiBot := bot.MultiBot{
+	multiBot = bot.MultiBot{
 		bot.NewAnecdote(httpClient),
 		bot.NewStackOverflow(),
 		bot.NewDuck(opts.MashapeToken, httpClient),
 		openAIBot,
+		openai.NewTldr(openAIBot, opts.SuperUsers, openai.TldrParams{
+			LogsPath:       opts.LogsPath,
+			Messages:       opts.OpenAI.TldrMessages,
+			MaxPeriod:      opts.OpenAI.TldrPeriod,
+			MaxSuperPeriod: opts.OpenAI.TldrSuperPeriod,
+			MaxTokens:      opts.OpenAI.MaxTokensRequest,
+			CacheTTL:       opts.OpenAI.TldrCache,
+		}),
 	}
 
-	if sb, err := bot.NewSys(opts.SysData); err == nil {
+	quotes, err := bot.NewQuoteStore(filepath.Join(opts.StoragePath, "quotes.jsonl"))
+	if err == nil {
+		multiBot = append(multiBot, bot.NewQuotes(quotes, opts.SuperUsers, opts.QuoteVotes, opts.Telegram.Group))
+	} else {
+		log.Printf("[ERROR] failed to load quotes bot, %v", err)
+	}
+
+	if sb, err := bot.NewSys(opts.SysData, quotes); err == nil {
 		multiBot = append(multiBot, sb)
 	} else {
 		log.Printf("[ERROR] failed to load sysbot, %v", err)
 	}
 
+	if ib, err := bot.NewImpersonation(opts.SuperUsers, opts.SuperUsers, opts.SysData, opts.ImpersonationRestrict); err == nil {
+		multiBot = append(multiBot, ib)
+	} else {
+		log.Printf("[ERROR] failed to load impersonation bot, %v", err)
+	}
+
+	users, err := bot.NewUserDirectory(filepath.Join(opts.StoragePath, "users.jsonl"))
+	if err != nil {
+		log.Fatalf("[ERROR] can't make users directory, %v", err)
+	}
+	if users.Len() == 0 { // first start, collect users from logs
+		if _, err := users.Backfill(opts.LogsPath); err != nil {
+			log.Printf("[WARN] can't backfill users from %s, %v", opts.LogsPath, err)
+		}
+	}
+
+	modLog, err := bot.NewModLog(filepath.Join(opts.StoragePath, "modlog.jsonl"))
+	if err != nil {
+		log.Fatalf("[ERROR] can't make moderation journal, %v", err)
+	}
+	multiBot = append(multiBot, bot.NewModLogBot(modLog, opts.SuperUsers))
+	var blocklist *bot.Blocklist // known spammers, kept only with spam filter enabled
+	if opts.SpamFilter.Enabled {
+		if blocklist, err = bot.NewBlocklist(spamBlocklistPath()); err != nil {
+			log.Fatalf("[ERROR] can't make spam blocklist, %v", err)
+		}
+	}
+	if opts.Banhammer {
+		multiBot = append(multiBot, bot.NewBanhammer(tbAPI, opts.SuperUsers, users, modLog, blocklist))
+	}
+	if opts.SpamFilter.Enabled {
+		multiBot = append(multiBot, liveSpamFilter(httpClient, tbAPI, modLog, blocklist, tbAPI.Self.UserName))
+	}
+
+	if opts.WTF.Enabled {
+		wtfLedger, err := bot.NewWTFLedger(filepath.Join(opts.StoragePath, "wtf.jsonl"))
+		if err != nil {
+			log.Fatalf("[ERROR] can't make wtf ledger, %v", err)
+		}
+		multiBot = append(multiBot, bot.NewWTF(opts.WTF.MinBan, opts.WTF.MaxBan, opts.SuperUsers, wtfLedger, users))
+	}
+
+	warnings, err := bot.NewWarningStore(filepath.Join(opts.StoragePath, "warnings.jsonl"))
+	if err != nil {
+		log.Fatalf("[ERROR] can't make warnings store, %v", err)
+	}
+	warnSteps, err := bot.ParseWarnSteps(opts.WarnSteps)
+	if err != nil {
+		log.Fatalf("[ERROR] can't parse warn steps, %v", err)
+	}
+	multiBot = append(multiBot, bot.NewWarnings(warnings, opts.SuperUsers, users, opts.WarnExpire, warnSteps))
+
 	allActivityTerm := events.Terminator{
 		BanDuration:   time.Minute * 5,
 		BanPenalty:    10,
@@ -168,6 +386,9 @@ func main() {
 		Debug:                  opts.Dbg,
 		IdleDuration:           opts.IdleDuration,
 		SuperUsers:             opts.SuperUsers,
+		Users:                  users,
+		ModLog:                 modLog,
+		Blocklist:              blocklist,
 	}
 
 	remarkClient := openai.RemarkClient{
@@ -226,6 +447,16 @@ func export() {
 		log.Fatalf("[ERROR] storage creation failed: %v", err)
 	}
 
+	wtfLedger, err := bot.NewWTFLedger(filepath.Join(opts.StoragePath, "wtf.jsonl"))
+	if err != nil {
+		log.Fatalf("[ERROR] can't load wtf ledger: %v", err)
+	}
+
+	modLog, err := bot.NewModLog(filepath.Join(opts.StoragePath, "modlog.jsonl"))
+	if err != nil {
+		log.Fatalf("[ERROR] can't load moderation journal: %v", err)
+	}
+
 	params := reporter.ExporterParams{
 		InputRoot:    opts.LogsPath,
 		OutputRoot:   opts.ExportPath,
@@ -238,6 +469,8 @@ func export() {
 				opts.ExportBroadcastUsers...,
 			),
 		),
+		WTFLedger: wtfLedger,
+		ModLog:    modLog,
 	}
 	err = reporter.NewExporter(fileRecipient, s, params).Export(opts.ExportNum, opts.ExportDay)
 	if err != nil {
@@ -245,6 +478,172 @@ func export() {
 	}
 }
 
+func exportQuotes() {
+	log.Printf("[INFO] export quotes to %s", opts.ExportQuotes)
+	quotes, err := bot.NewQuoteStore(filepath.Join(opts.StoragePath, "quotes.jsonl"))
+	if err != nil {
+		log.Fatalf("[ERROR] can't load quotes, %v", err)
+	}
+	fh, err := os.Create(opts.ExportQuotes)
+	if err != nil {
+		log.Fatalf("[ERROR] can't create %s, %v", opts.ExportQuotes, err)
+	}
+	if err := quotes.Export(fh); err != nil {
+		_ = fh.Close()
+		log.Fatalf("[ERROR] export quotes failed: %v", err)
+	}
+	if err := fh.Close(); err != nil {
+		log.Fatalf("[ERROR] can't close %s, %v", opts.ExportQuotes, err)
+	}
+}
+
+func showModLog() {
+	modLog, err := bot.NewModLog(filepath.Join(opts.StoragePath, "modlog.jsonl"))
+	if err != nil {
+		log.Fatalf("[ERROR] can't load moderation journal, %v", err)
+	}
+	q := bot.ModQuery{Target: opts.ModLog.Target, Action: bot.ModAction(opts.ModLog.Action),
+		Source: opts.ModLog.Source, Limit: opts.ModLog.Limit}
+	if opts.ModLog.Since > 0 {
+		q.From = time.Now().Add(-opts.ModLog.Since)
+	}
+	for _, e := range modLog.Find(q) {
+		fmt.Println(e.String())
+	}
+}
+
+func trainSpamModel() {
+	model, err := offlineSpamFilter().Train(opts.LogsPath)
+	if err != nil {
+		log.Fatalf("[ERROR] can't train spam model, %v", err)
+	}
+	modelPath := spamModelPath()
+	if err := model.Save(modelPath); err != nil {
+		log.Fatalf("[ERROR] can't save spam model, %v", err)
+	}
+	log.Printf("[INFO] spam model saved to %s", modelPath)
+}
+
+func evalSpamFilter() {
+	filter := offlineSpamFilter()
+	filter.Classifier, filter.BayesThreshold = loadSpamModel()
+
+	params := bot.SpamEvalParams{LogsPath: opts.LogsPath, Thresholds: opts.SpamFilter.EvalThresholds,
+		RegularMsgs: opts.SpamFilter.RegularMsgs}
+	if opts.SpamFilter.Labeled != "" {
+		fh, err := os.Open(opts.SpamFilter.Labeled)
+		if err != nil {
+			log.Fatalf("[ERROR] can't open labeled messages, %v", err)
+		}
+		defer fh.Close() // nolint
+		params.Labeled = fh
+	}
+	results, err := filter.Evaluate(params)
+	if err != nil {
+		log.Fatalf("[ERROR] can't evaluate spam filter, %v", err)
+	}
+
+	printHits := func(title string, hits []bot.SpamEvalHit) {
+		if len(hits) == 0 {
+			return
+		}
+		fmt.Printf("  %s:\n", title)
+		for i, h := range hits {
+			if i >= opts.SpamFilter.EvalShow {
+				fmt.Printf("    ... %d more\n", len(hits)-i)
+				break
+			}
+			fmt.Printf("    %s %s (id:%d): %q\n      %s\n", h.Msg.Sent.Format("2006-01-02 15:04"),
+				bot.DisplayName(h.Msg), h.Msg.From.ID, h.Msg.Text, h.Verdict)
+		}
+	}
+	for _, r := range results {
+		fmt.Println(r.String())
+		printHits("false positives among regular users", r.RegularFP)
+		printHits("flagged in logs", r.Flagged)
+	}
+}
+
+// offlineSpamFilter makes spam filter with samples for training and evaluation, without CAS and telegram
+func offlineSpamFilter() *bot.SpamFilter {
+	if opts.SpamFilter.Samples == "" {
+		log.Fatalf("[ERROR] spam samples not set")
+	}
+	return newSpamFilter(bot.SpamParams{SimilarityThreshold: opts.SpamFilter.Threshold,
+		MinMsgLen: opts.SpamFilter.MinMsgLen, FirstMessages: opts.SpamFilter.FirstMessages})
+}
+
+// liveSpamFilter makes spam filter for the chat, with CAS checks, bans and spam!/ham! feedback saved to samples
+func liveSpamFilter(httpClient bot.HTTPClient, tgClient bot.TgBanClient, modLog *bot.ModLog, blocklist *bot.Blocklist,
+	botUsername string) *bot.SpamFilter {
+	model, threshold := loadSpamModel()
+	return newSpamFilter(bot.SpamParams{
+		SuperUser:           opts.SuperUsers,
+		SimilarityThreshold: opts.SpamFilter.Threshold,
+		MinMsgLen:           opts.SpamFilter.MinMsgLen,
+		CasAPI:              opts.SpamFilter.API,
+		CasTimeout:          opts.SpamFilter.TimeOut,
+		CasTTL:              opts.SpamFilter.CasTTL,
+		HTTPClient:          httpClient,
+		Blocklist:           blocklist,
+		Dry:                 opts.SpamFilter.Dry,
+		FirstMessages:       opts.SpamFilter.FirstMessages,
+		SamplesFile:         opts.SpamFilter.Samples,
+		HamFile:             opts.SpamFilter.Ham,
+		ApprovedFile:        filepath.Join(opts.StoragePath, "spam_approved.jsonl"),
+		TgClient:            tgClient,
+		ModLog:              modLog,
+		BotUsername:         botUsername,
+		Classifier:          model,
+		BayesThreshold:      threshold,
+	})
+}
+
+func spamBlocklistPath() string {
+	if opts.SpamFilter.Blocklist != "" {
+		return opts.SpamFilter.Blocklist
+	}
+	return filepath.Join(opts.StoragePath, "spam_blocklist.jsonl")
+}
+
+// loadSpamModel loads naive bayes model trained by --spam-filter.train, nil model and 0 threshold if not available
+func loadSpamModel() (*bayes.Classifier, float64) {
+	model, err := bayes.Load(spamModelPath())
+	if err != nil {
+		log.Printf("[WARN] naive bayes model not used, %v", err)
+		return nil, 0
+	}
+	return model, opts.SpamFilter.BayesThreshold
+}
+
+// newSpamFilter makes spam filter with spam and ham samples read from files set in options
+func newSpamFilter(params bot.SpamParams) *bot.SpamFilter {
+	if opts.SpamFilter.Samples != "" {
+		samples, err := os.Open(opts.SpamFilter.Samples)
+		if err != nil {
+			log.Fatalf("[ERROR] can't open spam samples, %v", err)
+		}
+		defer samples.Close() // nolint
+		params.SpamSamples = samples
+	}
+	if opts.SpamFilter.Ham != "" {
+		ham, err := os.Open(opts.SpamFilter.Ham)
+		if err != nil {
+			log.Fatalf("[ERROR] can't open ham samples, %v", err)
+		}
+		defer ham.Close() // nolint
+		params.HamSamples = ham
+	}
+	return bot.NewSpamFilter(params) // samples read by constructor
+}
+
+func spamModelPath() string {
+	if opts.SpamFilter.Model != "" {
+		return opts.SpamFilter.Model
+	}
+	return filepath.Join(opts.StoragePath, "spam_model.json")
+}
+
 // makeOpenAIHttpClient creates http client with retry middleware
 func makeOpenAIHttpClient() *http.Client {
 	rpt := repeater.NewDefault(10, time.Second*5)
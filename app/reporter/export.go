@@ -38,6 +38,8 @@ type ExporterParams struct {
 	BroadcastUsers SuperUser // Users who can send "bot.MsgBroadcastStarted" and "bot.MsgBroadcastStarted" messages.
 	// it may be just bot, or bot + some or all SuperUsers.
 	// Cannot use SuperUsers field for same purpose because they used to mark messages as "from host" in template
+	WTFLedger *bot.WTFLedger // optional, wtf bans made during the show added to the report
+	ModLog    *bot.ModLog    // optional, moderation summary for the show added to the report
 }
 
 // SuperUser knows which user is a superuser
@@ -118,12 +120,61 @@ func (e *Exporter) toHTML(messages []bot.Message, num int) (string, error) {
 		IsBot  bool
 	}
 
+	type WTFBan struct {
+		Time     string
+		Mention  string
+		Duration string
+		Reply    bool
+	}
+
+	type ModRecord struct {
+		Time     string
+		Action   string
+		Target   string
+		Duration string
+		Source   string
+		Reason   string
+	}
+
 	type Data struct {
-		Num     int
-		Records []Record
+		Num        int
+		Records    []Record
+		WTF        []WTFBan
+		ModSummary string
+		Moderation []ModRecord // bans and restrictions, except wtf ones shown separately
 	}
 
 	data := Data{Num: num}
+	var from, to time.Time
+	if len(messages) > 0 {
+		from, to = messages[0].Sent, messages[len(messages)-1].Sent.Add(time.Second)
+	}
+	if e.WTFLedger != nil && len(messages) > 0 {
+		for _, r := range e.WTFLedger.Records(from, to) {
+			data.WTF = append(data.WTF, WTFBan{
+				Time:     e.timestampHuman(r.Time),
+				Mention:  r.Mention(),
+				Duration: bot.HumanizeDuration(r.Duration),
+				Reply:    r.Reply,
+			})
+		}
+	}
+	if e.ModLog != nil && len(messages) > 0 {
+		entries := e.ModLog.Find(bot.ModQuery{From: from, To: to})
+		data.ModSummary = modSummary(entries)
+		for _, r := range entries {
+			if (r.Action != bot.ModBan && r.Action != bot.ModRestrict) || r.Source == "WTF" || r.Error != "" {
+				continue
+			}
+			duration := "навсегда"
+			if r.Duration > 0 {
+				duration = bot.HumanizeDuration(r.Duration)
+			}
+			data.Moderation = append(data.Moderation, ModRecord{Time: e.timestampHuman(r.Time), Action: string(r.Action),
+				Target: r.TargetName(), Duration: duration, Source: r.Source, Reason: r.Reason})
+		}
+	}
+
 	for _, msg := range messages {
 
 		if msg.Image != nil {
@@ -259,7 +310,7 @@ func readMessages(path string, broadcastUsers SuperUser) ([]bot.Message, error)
 			}
 		}
 
-		if filter(msg) {
+		if Filter(msg) {
 			continue
 		}
 		messages = append(messages, msg)
@@ -279,7 +330,8 @@ func readMessages(path string, broadcastUsers SuperUser) ([]bot.Message, error)
 	return messages, scanner.Err()
 }
 
-func filter(msg bot.Message) bool {
+// Filter returns true for noise messages, like +1 and -1, skipped in exported logs and digests
+func Filter(msg bot.Message) bool {
 	contains := func(s []string, e string) bool {
 		e = strings.TrimSpace(strings.ToLower(e))
 		for _, a := range s {
@@ -400,3 +452,23 @@ func cleanPhoneNumber(phoneNumber string) string {
 	reg := regexp.MustCompile(`[^\d+]`)
 	return reg.ReplaceAllString(phoneNumber, "")
 }
+
+// modSummary makes counts of successful moderation actions, like "банов 1, удалено сообщений 2"
+func modSummary(entries []bot.ModEntry) string {
+	counts := map[bot.ModAction]int{}
+	for _, e := range entries {
+		if e.Error == "" {
+			counts[e.Action]++
+		}
+	}
+	parts := []string{}
+	for _, a := range []struct {
+		action bot.ModAction
+		name   string
+	}{{bot.ModBan, "банов"}, {bot.ModRestrict, "ограничений"}, {bot.ModUnban, "разбанов"}, {bot.ModDelete, "удалено сообщений"}} {
+		if counts[a.action] > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", a.name, counts[a.action]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -65,6 +65,65 @@ func TestExporter_Export(t *testing.T) {
 	}
 }
 
+func TestExporter_toHTMLWithWTF(t *testing.T) {
+	ledger, err := bot.NewWTFLedger(t.TempDir() + "/wtf.jsonl")
+	assert.NoError(t, err)
+	showStart := time.Date(2024, 5, 4, 20, 0, 0, 0, time.UTC)
+	assert.NoError(t, ledger.Add(bot.WTFRecord{Time: showStart.Add(-time.Hour), Banned: bot.User{Username: "before"}, Duration: time.Hour}))
+	assert.NoError(t, ledger.Add(bot.WTFRecord{Time: showStart.Add(time.Minute), Banned: bot.User{Username: "during"},
+		Duration: 666 * time.Hour, Reply: true}))
+
+	params := testExportParams
+	params.TemplateFile = "../../data/logs.html"
+	params.WTFLedger = ledger
+	e := NewExporter(nil, nil, params)
+
+	h, err := e.toHTML([]bot.Message{{Text: "1st", Sent: showStart}, {Text: "2nd", Sent: showStart.Add(time.Hour)}}, 1)
+	assert.NoError(t, err)
+	assert.Contains(t, h, "WTF баны")
+	assert.Contains(t, h, "<td>during</td>")
+	assert.Contains(t, h, "27дн 18ч (666 часов) (от ведущего)")
+	assert.NotContains(t, h, "before")
+
+	params.WTFLedger = nil
+	h, err = NewExporter(nil, nil, params).toHTML([]bot.Message{{Text: "1st", Sent: showStart}}, 1)
+	assert.NoError(t, err)
+	assert.NotContains(t, h, "WTF баны")
+}
+
+func TestExporter_toHTMLWithModLog(t *testing.T) {
+	modLog, err := bot.NewModLog(t.TempDir() + "/modlog.jsonl")
+	assert.NoError(t, err)
+	showStart := time.Date(2024, 5, 4, 20, 0, 0, 0, time.UTC)
+	assert.NoError(t, modLog.Add(bot.ModEntry{Time: showStart.Add(-time.Hour), Action: bot.ModBan, Source: "Banhammer",
+		Target: bot.User{Username: "before"}}))
+	assert.NoError(t, modLog.Add(bot.ModEntry{Time: showStart.Add(time.Minute), Action: bot.ModRestrict, Source: "SpamFilter",
+		Target: bot.User{Username: "spammer"}, Reason: "spam: cas"}))
+	assert.NoError(t, modLog.Add(bot.ModEntry{Time: showStart.Add(time.Minute), Action: bot.ModDelete, Source: "SpamFilter"}))
+	assert.NoError(t, modLog.Add(bot.ModEntry{Time: showStart.Add(2 * time.Minute), Action: bot.ModRestrict, Source: "WTF",
+		Target: bot.User{Username: "wtf_user"}, Duration: time.Hour}))
+	assert.NoError(t, modLog.Add(bot.ModEntry{Time: showStart.Add(3 * time.Minute), Action: bot.ModPin, Source: "PrepPost"}))
+
+	params := testExportParams
+	params.TemplateFile = "../../data/logs.html"
+	params.ModLog = modLog
+	e := NewExporter(nil, nil, params)
+
+	h, err := e.toHTML([]bot.Message{{Text: "1st", Sent: showStart}, {Text: "2nd", Sent: showStart.Add(time.Hour)}}, 1)
+	assert.NoError(t, err)
+	assert.Contains(t, h, "Модерация")
+	assert.Contains(t, h, "ограничений 2, удалено сообщений 1")
+	assert.Contains(t, h, "@spammer")
+	assert.Contains(t, h, "SpamFilter: spam: cas")
+	assert.NotContains(t, h, "@wtf_user", "wtf bans shown separately")
+	assert.NotContains(t, h, "before")
+
+	params.ModLog = nil
+	h, err = NewExporter(nil, nil, params).toHTML([]bot.Message{{Text: "1st", Sent: showStart}}, 1)
+	assert.NoError(t, err)
+	assert.NotContains(t, h, "Модерация")
+}
+
 func Test_filter(t *testing.T) {
 	tbl := []struct {
 		input  bot.Message
@@ -79,7 +138,7 @@ func Test_filter(t *testing.T) {
 	}
 	for i, tt := range tbl {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			filtered := filter(tt.input)
+			filtered := Filter(tt.input)
 			assert.Equal(t, tt.output, filtered)
 		})
 	}
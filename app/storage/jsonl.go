@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JSONL is a file with one JSON record per line.
+// Used by bots to persist small datasets, like quotes or ledgers, without a database.
+type JSONL[T any] struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewJSONL makes JSONL for the file, creates parent directory if needed
+func NewJSONL[T any](path string) (*JSONL[T], error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("can't make directory for %s: %w", path, err)
+	}
+	return &JSONL[T]{path: path}, nil
+}
+
+// Path returns location of the file
+func (j *JSONL[T]) Path() string {
+	return j.path
+}
+
+// Append adds a record to the end of the file
+func (j *JSONL[T]) Append(rec T) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("can't marshal record: %w", err)
+	}
+
+	fh, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) // nolint
+	if err != nil {
+		return fmt.Errorf("can't open %s: %w", j.path, err)
+	}
+	defer fh.Close() // nolint
+
+	if _, err = fh.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("can't write to %s: %w", j.path, err)
+	}
+	return nil
+}
+
+// Load reads all records from the file. Missing file is not an error, broken lines are skipped.
+func (j *JSONL[T]) Load() ([]T, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	fh, err := os.Open(j.path) // nolint
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []T{}, nil
+		}
+		return nil, fmt.Errorf("can't open %s: %w", j.path, err)
+	}
+	defer fh.Close() // nolint
+
+	res := []T{}
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec T
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			log.Printf("[WARN] failed to unmarshal %s from %s, %v", scanner.Text(), j.path, err)
+			continue
+		}
+		res = append(res, rec)
+	}
+	return res, scanner.Err()
+}
+
+// Replace rewrites the file with given records. Writes to a temp file first, so the file is never half-written.
+func (j *JSONL[T]) Replace(recs []T) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	tmp := j.path + ".tmp"
+	fh, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600) // nolint
+	if err != nil {
+		return fmt.Errorf("can't open %s: %w", tmp, err)
+	}
+
+	w := bufio.NewWriter(fh)
+	enc := json.NewEncoder(w)
+	for _, rec := range recs {
+		if err = enc.Encode(rec); err != nil {
+			_ = fh.Close()
+			return fmt.Errorf("can't write record to %s: %w", tmp, err)
+		}
+	}
+	if err = w.Flush(); err != nil {
+		_ = fh.Close()
+		return fmt.Errorf("can't flush %s: %w", tmp, err)
+	}
+	if err = fh.Close(); err != nil {
+		return fmt.Errorf("can't close %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, j.path)
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONL(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	type rec struct {
+		Name string
+		Num  int
+	}
+
+	j, err := NewJSONL[rec](path.Join(tmp, "sub", "recs.jsonl"))
+	require.NoError(t, err)
+
+	recs, err := j.Load()
+	require.NoError(t, err)
+	assert.Empty(t, recs, "missing file is empty")
+
+	require.NoError(t, j.Append(rec{Name: "one", Num: 1}))
+	require.NoError(t, j.Append(rec{Name: "two", Num: 2}))
+	recs, err = j.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []rec{{"one", 1}, {"two", 2}}, recs)
+
+	require.NoError(t, j.Replace([]rec{{"three", 3}}))
+	recs, err = j.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []rec{{"three", 3}}, recs)
+}
+
+func TestJSONL_LoadSkipsBroken(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	fname := path.Join(tmp, "recs.jsonl")
+	require.NoError(t, os.WriteFile(fname, []byte("{\"Num\":1}\nbroken\n\n{\"Num\":2}\n"), 0o600))
+
+	j, err := NewJSONL[struct{ Num int }](fname)
+	require.NoError(t, err)
+	recs, err := j.Load()
+	require.NoError(t, err)
+	assert.Len(t, recs, 2)
+	assert.Equal(t, 2, recs[1].Num)
+}